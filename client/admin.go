@@ -0,0 +1,844 @@
+package client
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"dbuggen/server/auth"
+	"dbuggen/server/database"
+	"dbuggen/server/hodis"
+	"dbuggen/server/media"
+)
+
+// The key under which requests from editors are marked in the gin context
+const editorKey = "editor"
+
+// The format of <input type="datetime-local">
+const datetimeLocal = "2006-01-02T15:04"
+
+// Editors is a middleware which marks requests from redaqtionen, as told by
+// isEditor, so that they get to see issues before they are published and
+// can preview darkmode, see AdminPreviewDarkmode. What they see is never
+// cached.
+func Editors(isEditor func(c *gin.Context) bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !isEditor(c) {
+			c.Next()
+			return
+		}
+
+		c.Set(editorKey, true)
+		c.Header("Cache-Control", "private, no-store")
+
+		if cookie, err := c.Cookie(previewCookie); err == nil {
+			if preview, err := strconv.ParseBool(cookie); err == nil {
+				c.Set(previewKey, preview)
+			}
+		}
+		c.Next()
+	}
+}
+
+// Whether issues which aren't published yet should be shown, which is only
+// to redaqtionen
+func requestDrafts(c *gin.Context) bool {
+	return c.GetBool(editorKey)
+}
+
+// Overview of all issues, from where redaqtionen can edit them
+func AdminHome(db database.Store, rendered *RenderCache) func(c *gin.Context) {
+	type adminIssue struct {
+		EditLink       string
+		Title          string
+		PublishingDate string
+		Publication    database.Publication
+		Status         database.IssueStatus
+	}
+
+	return func(c *gin.Context) {
+		issuesRaw, err := db.GetIssues()
+		if err != nil {
+			pageError(c, err)
+			return
+		}
+
+		var issues []adminIssue
+		for _, iss := range issuesRaw {
+			issues = append(issues, adminIssue{
+				EditLink:       fmt.Sprintf("/admin/issue/%v", iss.ID),
+				Title:          iss.Title,
+				PublishingDate: iss.PublishingDate.Format(time.DateOnly),
+				Publication:    iss.Publication,
+				Status:         iss.Status,
+			})
+		}
+
+		c.HTML(http.StatusOK, "admin.html", gin.H{
+			"pagetitle":   "admin",
+			"issues":      issues,
+			"renderStats": rendered.Stats(),
+		})
+	}
+}
+
+// Form for creating a new issue
+func AdminAddIssueForm() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		c.HTML(http.StatusOK, "add-dbuggen.html", gin.H{
+			"pagetitle": "+dbuggen",
+			"today":     time.Now().Format(time.DateOnly),
+		})
+	}
+}
+
+// Creates a new issue and sends the user on to edit it
+func AdminAddIssue(db database.Store) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		title, publishingDate, publication, err := issueForm(c)
+		if err != nil {
+			pageErrorStatus(c, http.StatusBadRequest, err)
+			return
+		}
+
+		issueID, err := db.CreateIssue(title, publishingDate, publication)
+		if err != nil {
+			pageError(c, err)
+			return
+		}
+
+		c.Redirect(http.StatusSeeOther, fmt.Sprintf("/admin/issue/%v", issueID))
+	}
+}
+
+// Edit page for an issue, listing its articles in order
+func AdminIssue(db database.Store) func(c *gin.Context) {
+	type adminArticle struct {
+		ID        int
+		Title     string
+		EditLink  string
+		N0lleSafe bool
+		First     bool
+		Last      bool
+	}
+
+	return func(c *gin.Context) {
+		issueID, err := pathIntSeparator(c.Param("issue"))
+		if err != nil {
+			pageErrorStatus(c, http.StatusBadRequest, err)
+			return
+		}
+
+		issue, err := db.GetIssue(issueID, false, true)
+		if err != nil {
+			pageError(c, err)
+			return
+		}
+
+		articles, err := db.GetArticles(issueID, false)
+		if err != nil {
+			pageError(c, err)
+			return
+		}
+
+		adminArticles := make([]adminArticle, len(articles))
+		for i, article := range articles {
+			adminArticles[i] = adminArticle{
+				ID:        article.ID,
+				Title:     article.Title,
+				EditLink:  fmt.Sprintf("/admin/article/%v", article.ID),
+				N0lleSafe: article.N0lleSafe,
+				First:     i == 0,
+				Last:      i == len(articles)-1,
+			}
+		}
+
+		publishAt := ""
+		if issue.PublishAt.Valid {
+			publishAt = issue.PublishAt.Time.In(time.Local).Format(datetimeLocal)
+		}
+
+		c.HTML(http.StatusOK, "admin-issue.html", gin.H{
+			"pagetitle":      issue.Title,
+			"issueID":        issue.ID,
+			"issueTitle":     issue.Title,
+			"publishingDate": issue.PublishingDate.Format(time.DateOnly),
+			"publication":    string(issue.Publication),
+			"status":         string(issue.Status),
+			"publishAt":      publishAt,
+			"articles":       adminArticles,
+		})
+	}
+}
+
+// Updates the title, publishing date and publication of an issue
+func AdminUpdateIssue(db database.Store) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		issueID, err := pathIntSeparator(c.Param("issue"))
+		if err != nil {
+			pageErrorStatus(c, http.StatusBadRequest, err)
+			return
+		}
+
+		title, publishingDate, publication, err := issueForm(c)
+		if err != nil {
+			pageErrorStatus(c, http.StatusBadRequest, err)
+			return
+		}
+
+		if err := db.UpdateIssue(issueID, title, publishingDate, publication); err != nil {
+			pageError(c, err)
+			return
+		}
+
+		c.Redirect(http.StatusSeeOther, fmt.Sprintf("/admin/issue/%v", issueID))
+	}
+}
+
+// Publishes an issue right away, schedules it to come out by itself later,
+// or turns it back into a draft
+func AdminSetIssueStatus(db database.Store) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		issueID, err := pathIntSeparator(c.Param("issue"))
+		if err != nil {
+			pageErrorStatus(c, http.StatusBadRequest, err)
+			return
+		}
+
+		var publishAt sql.NullTime
+		status := database.IssueStatus(c.PostForm("status"))
+		switch status {
+		case database.IssueDraft, database.IssuePublished:
+		case database.IssueScheduled:
+			t, err := time.ParseInLocation(datetimeLocal, c.PostForm("publish_at"), time.Local)
+			if err != nil {
+				pageErrorStatus(c, http.StatusBadRequest, fmt.Errorf("a scheduled issue needs a time to come out: %w", err))
+				return
+			}
+			publishAt = sql.NullTime{Time: t, Valid: true}
+		default:
+			pageErrorStatus(c, http.StatusBadRequest, fmt.Errorf("unknown issue status %q", status))
+			return
+		}
+
+		if err := db.SetIssueStatus(issueID, status, publishAt); err != nil {
+			pageError(c, err)
+			return
+		}
+
+		c.Redirect(http.StatusSeeOther, fmt.Sprintf("/admin/issue/%v", issueID))
+	}
+}
+
+// Adds a new, empty article last in an issue and sends the user on to edit it
+func AdminAddArticle(db database.Store) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		issueID, err := pathIntSeparator(c.Param("issue"))
+		if err != nil {
+			pageErrorStatus(c, http.StatusBadRequest, err)
+			return
+		}
+
+		title := strings.TrimSpace(c.PostForm("title"))
+		if title == "" {
+			pageErrorStatus(c, http.StatusBadRequest, errors.New("the article needs a title"))
+			return
+		}
+
+		article, err := db.CreateArticle(issueID, title, sql.NullString{}, "", false)
+		if err != nil {
+			pageError(c, err)
+			return
+		}
+
+		c.Redirect(http.StatusSeeOther, fmt.Sprintf("/admin/article/%v", article.ID))
+	}
+}
+
+// Moves an article one step up or down in its issue
+func AdminMoveArticle(db database.Store) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		issueID, errI := pathIntSeparator(c.Param("issue"))
+		articleID, errA := pathIntSeparator(c.PostForm("article"))
+		if errI != nil || errA != nil {
+			pageErrorStatus(c, http.StatusBadRequest, errors.Join(errI, errA))
+			return
+		}
+
+		articles, err := db.GetArticles(issueID, false)
+		if err != nil {
+			pageError(c, err)
+			return
+		}
+
+		order := make([]int, len(articles))
+		for i, article := range articles {
+			order[i] = article.ID
+		}
+
+		order, err = moveArticle(order, articleID, c.PostForm("direction"))
+		if err != nil {
+			pageErrorStatus(c, http.StatusBadRequest, err)
+			return
+		}
+
+		if err := db.ReorderArticles(issueID, order); err != nil {
+			pageError(c, err)
+			return
+		}
+
+		c.Redirect(http.StatusSeeOther, fmt.Sprintf("/admin/issue/%v", issueID))
+	}
+}
+
+// Edit page for a single article and its authors
+func AdminArticle(db database.Store, names *hodis.Resolver) func(c *gin.Context) {
+	type adminAuthor struct {
+		KthID string
+		Name  string
+	}
+
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		articleID, err := pathIntSeparator(c.Param("article"))
+		if err != nil {
+			pageErrorStatus(c, http.StatusBadRequest, err)
+			return
+		}
+
+		article, err := db.GetArticleByID(articleID)
+		if err != nil {
+			pageError(c, err)
+			return
+		}
+
+		authors, err := db.GetAuthorsForArticle(articleID)
+		if err != nil {
+			pageError(c, err)
+			return
+		}
+
+		members, err := db.GetMembers()
+		if err != nil {
+			pageError(c, err)
+			return
+		}
+
+		resolveAuthors(ctx, names, authors)
+		adminAuthors := make([]adminAuthor, len(authors))
+		for i, author := range authors {
+			adminAuthors[i] = adminAuthor{author.KthID, authorsName(ctx, names, author)}
+		}
+
+		// only suggest the members who aren't already authors
+		members = slices.DeleteFunc(members, func(m database.Member) bool {
+			return slices.ContainsFunc(authors, func(a database.Author) bool { return a.KthID == m.KthID })
+		})
+
+		c.HTML(http.StatusOK, "admin-article.html", gin.H{
+			"pagetitle":  article.Title,
+			"article":    article,
+			"issueLink":  fmt.Sprintf("/admin/issue/%v", article.Issue),
+			"authorText": article.AuthorText.String,
+			"authors":    adminAuthors,
+			"members":    members,
+		})
+	}
+}
+
+// Saves the changes made to an article
+func AdminUpdateArticle(db database.Store, rendered *RenderCache) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		articleID, err := pathIntSeparator(c.Param("article"))
+		if err != nil {
+			pageErrorStatus(c, http.StatusBadRequest, err)
+			return
+		}
+
+		title := strings.TrimSpace(c.PostForm("title"))
+		if title == "" {
+			pageErrorStatus(c, http.StatusBadRequest, errors.New("the article needs a title"))
+			return
+		}
+
+		authorText := strings.TrimSpace(c.PostForm("author_text"))
+		article := database.Article{
+			ID:         articleID,
+			Title:      title,
+			AuthorText: sql.NullString{String: authorText, Valid: authorText != ""},
+			Content:    c.PostForm("content"),
+			N0lleSafe:  c.PostForm("n0lle_safe") == "on",
+		}
+
+		if err := saveArticle(db, rendered, article, auth.KthID(c)); err != nil {
+			pageError(c, err)
+			return
+		}
+
+		c.Redirect(http.StatusSeeOther, fmt.Sprintf("/admin/article/%v", articleID))
+	}
+}
+
+// Saves an article and which images from the media library it uses
+func saveArticle(db database.Store, rendered *RenderCache, article database.Article, editor string) error {
+	if err := db.UpdateArticle(article, editor); err != nil {
+		return err
+	}
+	rendered.Invalidate(article.ID)
+
+	images, err := db.GetImages()
+	if err != nil {
+		return err
+	}
+	return db.SetPicturesUsedInArticle(article.ID, media.Used(article.Content, images))
+}
+
+// Every saved version of an article, newest first, from where they can be
+// compared and restored
+func AdminRevisions(db database.Store, names *hodis.Resolver) func(c *gin.Context) {
+	type adminRevision struct {
+		ID       int
+		Title    string
+		EditedBy string
+		EditedAt string
+		// Comparing with the revision before it
+		DiffLink string
+	}
+
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		articleID, err := pathIntSeparator(c.Param("article"))
+		if err != nil {
+			pageErrorStatus(c, http.StatusBadRequest, err)
+			return
+		}
+
+		article, err := db.GetArticleByID(articleID)
+		if err != nil {
+			pageError(c, err)
+			return
+		}
+
+		revisions, err := db.GetRevisions(articleID)
+		if err != nil {
+			pageError(c, err)
+			return
+		}
+
+		adminRevisions := make([]adminRevision, len(revisions))
+		for i, revision := range revisions {
+			editedBy := "from before revisions were kept"
+			if revision.EditedBy.Valid {
+				editedBy = names.Name(ctx, revision.EditedBy.String)
+			}
+
+			diffLink := ""
+			if i+1 < len(revisions) {
+				diffLink = fmt.Sprintf("/admin/article/%v/diff?from=%v&to=%v", articleID, revisions[i+1].ID, revision.ID)
+			}
+
+			adminRevisions[i] = adminRevision{
+				ID:       revision.ID,
+				Title:    revision.Title,
+				EditedBy: editedBy,
+				EditedAt: revision.EditedAt.In(time.Local).Format(time.DateTime),
+				DiffLink: diffLink,
+			}
+		}
+
+		c.HTML(http.StatusOK, "admin-revisions.html", gin.H{
+			"pagetitle": article.Title,
+			"article":   article,
+			"revisions": adminRevisions,
+		})
+	}
+}
+
+// Two revisions of an article next to each other, with what changed in
+// between marked
+func AdminDiff(db database.Store) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		articleID, err := pathIntSeparator(c.Param("article"))
+		if err != nil {
+			pageErrorStatus(c, http.StatusBadRequest, err)
+			return
+		}
+
+		var revisions [2]database.Revision
+		for i, param := range []string{"from", "to"} {
+			revisionID, err := strconv.Atoi(c.Query(param))
+			if err != nil {
+				pageErrorStatus(c, http.StatusBadRequest, err)
+				return
+			}
+
+			revisions[i], err = articleRevision(db, articleID, revisionID)
+			if err != nil {
+				pageError(c, err)
+				return
+			}
+		}
+		from, to := revisions[0], revisions[1]
+
+		c.HTML(http.StatusOK, "admin-diff.html", gin.H{
+			"pagetitle":    to.Title,
+			"articleID":    articleID,
+			"from":         from,
+			"to":           to,
+			"fromEditedAt": from.EditedAt.In(time.Local).Format(time.DateTime),
+			"toEditedAt":   to.EditedAt.In(time.Local).Format(time.DateTime),
+			"titleChanged": from.Title != to.Title,
+			"rows":         sideBySide(from.Content, to.Content),
+		})
+	}
+}
+
+// Makes an old revision of an article the current one. The article's other
+// settings are left as they are, and the restored version is saved as a new
+// revision so that nothing is lost.
+func AdminRestoreRevision(db database.Store, rendered *RenderCache) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		articleID, errA := pathIntSeparator(c.Param("article"))
+		revisionID, errR := pathIntSeparator(c.Param("revision"))
+		if errA != nil || errR != nil {
+			pageErrorStatus(c, http.StatusBadRequest, errors.Join(errA, errR))
+			return
+		}
+
+		revision, err := articleRevision(db, articleID, revisionID)
+		if err != nil {
+			pageError(c, err)
+			return
+		}
+
+		article, err := db.GetArticleByID(articleID)
+		if err != nil {
+			pageError(c, err)
+			return
+		}
+
+		article.Title = revision.Title
+		article.Content = revision.Content
+		if err := saveArticle(db, rendered, article, auth.KthID(c)); err != nil {
+			pageError(c, err)
+			return
+		}
+
+		c.Redirect(http.StatusSeeOther, fmt.Sprintf("/admin/article/%v", articleID))
+	}
+}
+
+// A revision, as long as it belongs to the article
+func articleRevision(db database.Store, articleID int, revisionID int) (database.Revision, error) {
+	revision, err := db.GetRevision(revisionID)
+	if err != nil {
+		return revision, err
+	}
+	if revision.Article != articleID {
+		return database.Revision{}, sql.ErrNoRows
+	}
+	return revision, nil
+}
+
+// Deletes an article and sends the user back to its issue
+func AdminDeleteArticle(db database.Store, rendered *RenderCache) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		articleID, err := pathIntSeparator(c.Param("article"))
+		if err != nil {
+			pageErrorStatus(c, http.StatusBadRequest, err)
+			return
+		}
+
+		article, err := db.GetArticleByID(articleID)
+		if err != nil {
+			pageError(c, err)
+			return
+		}
+
+		if err := db.DeleteArticle(articleID); err != nil {
+			pageError(c, err)
+			return
+		}
+		rendered.Invalidate(articleID)
+
+		c.Redirect(http.StatusSeeOther, fmt.Sprintf("/admin/issue/%v", article.Issue))
+	}
+}
+
+// Adds a member as an author of an article
+func AdminAddAuthor(db database.Store) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		articleID, err := pathIntSeparator(c.Param("article"))
+		if err != nil {
+			pageErrorStatus(c, http.StatusBadRequest, err)
+			return
+		}
+
+		kthID := strings.TrimSpace(c.PostForm("kth_id"))
+		if kthID == "" {
+			pageErrorStatus(c, http.StatusBadRequest, errors.New("no author given"))
+			return
+		}
+
+		err = db.AddAuthor(articleID, kthID)
+		if errors.Is(err, database.ErrUnknownMember) {
+			pageErrorStatus(c, http.StatusBadRequest, fmt.Errorf("unknown member %v", kthID))
+			return
+		}
+		if err != nil {
+			pageError(c, err)
+			return
+		}
+
+		c.Redirect(http.StatusSeeOther, fmt.Sprintf("/admin/article/%v", articleID))
+	}
+}
+
+// Removes a member from the authors of an article
+func AdminRemoveAuthor(db database.Store) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		articleID, err := pathIntSeparator(c.Param("article"))
+		if err != nil {
+			pageErrorStatus(c, http.StatusBadRequest, err)
+			return
+		}
+
+		if err := db.RemoveAuthor(articleID, c.PostForm("kth_id")); err != nil {
+			pageError(c, err)
+			return
+		}
+
+		c.Redirect(http.StatusSeeOther, fmt.Sprintf("/admin/article/%v", articleID))
+	}
+}
+
+// How much can be uploaded to the media library at once
+const maxUpload = 64 << 20
+
+// The media library, listing every image with what's needed to use it in
+// an article
+func AdminMedia(db database.Store, names *hodis.Resolver) func(c *gin.Context) {
+	type adminImage struct {
+		ID        int
+		AltText   string
+		URL       string
+		Thumbnail string
+		Filename  string
+		Size      string
+		Uploaded  string
+		Markdown  string
+		Articles  []int
+	}
+
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		images, err := db.GetImages()
+		if err != nil {
+			pageError(c, err)
+			return
+		}
+
+		adminImages := make([]adminImage, len(images))
+		for i, image := range images {
+			filename := image.Filename.String
+			if !image.Filename.Valid {
+				filename = path.Base(image.HostedURL)
+			}
+
+			size := ""
+			if image.Width.Valid && image.Height.Valid {
+				size = fmt.Sprintf("%vx%v", image.Width.Int32, image.Height.Int32)
+			}
+
+			uploaded := "from before the media library"
+			if image.UploadedAt.Valid {
+				uploaded = image.UploadedAt.Time.In(time.Local).Format(time.DateTime)
+				if image.UploadedBy.Valid {
+					uploaded += " by " + names.Name(ctx, image.UploadedBy.String)
+				}
+			}
+
+			adminImages[i] = adminImage{
+				ID:        image.ID,
+				AltText:   image.AltText.String,
+				URL:       image.HostedURL,
+				Thumbnail: image.Thumbnail(),
+				Filename:  filename,
+				Size:      size,
+				Uploaded:  uploaded,
+				Markdown:  fmt.Sprintf("![](external:%v)", image.ID),
+				Articles:  image.Articles,
+			}
+		}
+
+		c.HTML(http.StatusOK, "admin-media.html", gin.H{
+			"pagetitle": "media",
+			"images":    adminImages,
+		})
+	}
+}
+
+// Uploads one or more images to the media library
+func AdminUploadMedia(library *media.Library, rendered *RenderCache) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxUpload)
+		form, err := c.MultipartForm()
+		if err != nil {
+			pageErrorStatus(c, http.StatusBadRequest, err)
+			return
+		}
+
+		files := form.File["images"]
+		if len(files) == 0 {
+			pageErrorStatus(c, http.StatusBadRequest, errors.New("no images given"))
+			return
+		}
+
+		for _, header := range files {
+			file, err := header.Open()
+			if err != nil {
+				pageErrorStatus(c, http.StatusBadRequest, err)
+				return
+			}
+			data, err := io.ReadAll(file)
+			file.Close()
+			if err != nil {
+				pageErrorStatus(c, http.StatusBadRequest, err)
+				return
+			}
+
+			image, err := library.Upload(c.Request.Context(), header.Filename, data, auth.KthID(c))
+			if errors.Is(err, media.ErrUnsupported) {
+				pageErrorStatus(c, http.StatusBadRequest, fmt.Errorf("%v: %w", header.Filename, err))
+				return
+			} else if err != nil {
+				pageError(c, err)
+				return
+			}
+			log.Printf("%v uploaded %v as %v", auth.KthID(c), header.Filename, image.HostedURL)
+		}
+		// articles may already refer to images which didn't exist until now
+		rendered.Clear()
+
+		c.Redirect(http.StatusSeeOther, "/admin/media")
+	}
+}
+
+// Sets the text describing an image, which is shown wherever it's used
+func AdminSetImageAltText(db database.Store, rendered *RenderCache) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		imageID, err := pathIntSeparator(c.Param("image"))
+		if err != nil {
+			pageErrorStatus(c, http.StatusBadRequest, err)
+			return
+		}
+
+		err = db.SetImageAltText(imageID, strings.TrimSpace(c.PostForm("alt_text")))
+		if err != nil {
+			pageError(c, err)
+			return
+		}
+		// the alt text is used by the images in articles
+		rendered.Clear()
+
+		c.Redirect(http.StatusSeeOther, "/admin/media")
+	}
+}
+
+// Page where redaqtionen can see what darkmode says, override it and
+// preview the site with darkmode on or off
+func AdminDarkmode(db database.Store, ds *DarkmodeStatus) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		override, err := db.GetDarkmodeOverride()
+		if err != nil {
+			pageError(c, err)
+			return
+		}
+
+		polled, lastPoll := ds.Status()
+		lastPolled := "never"
+		if !lastPoll.IsZero() {
+			lastPolled = lastPoll.Format(time.DateTime)
+		}
+
+		changed := ""
+		if override.ChangedBy.Valid {
+			changed = fmt.Sprintf("Last changed by %v on %v.", override.ChangedBy.String, override.ChangedAt.Format(time.DateTime))
+		}
+
+		preview, _ := c.Cookie(previewCookie)
+
+		c.HTML(http.StatusOK, "admin-darkmode.html", gin.H{
+			"pagetitle": "darkmode",
+			"darkmode":  Darkmode(ds),
+			"polled":    polled,
+			"lastPoll":  lastPolled,
+			"override":  string(override.Mode),
+			"changed":   changed,
+			"preview":   preview,
+		})
+	}
+}
+
+// Forces darkmode on or off, or goes back to following darkmode. Takes
+// effect right away and survives restarts.
+func AdminSetDarkmode(db database.Store, ds *DarkmodeStatus) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		mode := database.DarkmodeMode(c.PostForm("mode"))
+		if mode != database.DarkmodeFollow && mode != database.DarkmodeForceOn && mode != database.DarkmodeForceOff {
+			pageErrorStatus(c, http.StatusBadRequest, fmt.Errorf("unknown darkmode override %q", mode))
+			return
+		}
+
+		override := database.DarkmodeOverride{
+			Mode:      mode,
+			ChangedBy: sql.NullString{String: auth.KthID(c), Valid: auth.KthID(c) != ""},
+			ChangedAt: time.Now(),
+		}
+		if err := db.SetDarkmodeOverride(override); err != nil {
+			pageError(c, err)
+			return
+		}
+
+		ds.SetOverride(mode)
+		log.Printf("%v set the darkmode override to %v", auth.KthID(c), mode)
+		c.Redirect(http.StatusSeeOther, "/admin/darkmode")
+	}
+}
+
+// Starts or stops previewing the site with darkmode on or off, for the rest
+// of the browser session. Nobody else is affected.
+func AdminPreviewDarkmode() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		c.SetSameSite(http.SameSiteLaxMode)
+
+		preview := c.PostForm("preview")
+		if preview == "" {
+			c.SetCookie(previewCookie, "", -1, "/", "", auth.Secure(c), true)
+			c.Redirect(http.StatusSeeOther, "/admin/darkmode")
+			return
+		}
+
+		darkmode, err := strconv.ParseBool(preview)
+		if err != nil {
+			pageErrorStatus(c, http.StatusBadRequest, err)
+			return
+		}
+
+		c.SetCookie(previewCookie, strconv.FormatBool(darkmode), 0, "/", "", auth.Secure(c), true)
+		c.Redirect(http.StatusSeeOther, "/")
+	}
+}
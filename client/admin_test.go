@@ -0,0 +1,310 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	imagepng "image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"dbuggen/server/auth"
+	"dbuggen/server/database"
+	"dbuggen/server/media"
+)
+
+// Posts the form to path, served by the handler at route, and returns the
+// status
+func postForm(handler func(c *gin.Context), route string, path string, form url.Values) int {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST(route, handler)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestAdminSetIssueStatus(t *testing.T) {
+	db := database.Testdata()
+	handler := AdminSetIssueStatus(db)
+
+	status := func(issueID int) database.HomeIssue {
+		t.Helper()
+		issue, err := db.GetIssue(issueID, false, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return issue
+	}
+
+	if code := postForm(handler, "/admin/issue/:issue/status", "/admin/issue/0/status", url.Values{"status": {"kanske"}}); code != http.StatusBadRequest {
+		t.Errorf("got status %v for an unknown status, wanted %v", code, http.StatusBadRequest)
+	}
+	if code := postForm(handler, "/admin/issue/:issue/status", "/admin/issue/0/status", url.Values{"status": {"scheduled"}}); code != http.StatusBadRequest {
+		t.Errorf("got status %v for a schedule without a time, wanted %v", code, http.StatusBadRequest)
+	}
+
+	code := postForm(handler, "/admin/issue/:issue/status", "/admin/issue/0/status", url.Values{"status": {"scheduled"}, "publish_at": {"2030-01-02T15:04"}})
+	if code != http.StatusSeeOther {
+		t.Fatalf("got status %v, wanted %v", code, http.StatusSeeOther)
+	}
+	issue := status(0)
+	expected := time.Date(2030, time.January, 2, 15, 4, 0, 0, time.Local)
+	if issue.Status != database.IssueScheduled || !issue.PublishAt.Time.Equal(expected) {
+		t.Errorf("got %v at %v, wanted it scheduled at %v", issue.Status, issue.PublishAt.Time, expected)
+	}
+
+	postForm(handler, "/admin/issue/:issue/status", "/admin/issue/3/status", url.Values{"status": {"published"}, "publish_at": {"2030-01-02T15:04"}})
+	if issue := status(3); issue.Status != database.IssuePublished || issue.PublishAt.Valid {
+		t.Errorf("got %v at %v, wanted it published without a time", issue.Status, issue.PublishAt)
+	}
+}
+
+func TestAdminRevisions(t *testing.T) {
+	names := fakeHodis(t)
+	db := database.Testdata()
+
+	article, err := db.GetArticleByID(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	article.Content = "# Hur man är cool\nnu är det **ännu roligare**."
+	if err := db.UpdateArticle(article, "frblo"); err != nil {
+		t.Fatal(err)
+	}
+
+	r := testRouter(t, "/admin/article/:article/revisions", AdminRevisions(db, names))
+	code, body := get(t, r, "/admin/article/0/revisions")
+	if code != http.StatusOK {
+		t.Fatalf("got status %v, wanted %v", code, http.StatusOK)
+	}
+	assertContains(t, body, "by Fredrik Blomqvist", "from before revisions were kept", "/admin/article/0/diff?from=0&amp;to=1", "/admin/article/0/revisions/0/restore")
+
+	r = testRouter(t, "/admin/article/:article/diff", AdminDiff(db))
+	code, body = get(t, r, "/admin/article/0/diff?from=0&to=1")
+	if code != http.StatusOK {
+		t.Fatalf("got status %v, wanted %v", code, http.StatusOK)
+	}
+	assertContains(t, body, `<tr class="changed">`, "ännu roligare")
+
+	// revisions of other articles can't be mixed in
+	if code, _ := get(t, r, "/admin/article/1/diff?from=0&to=1"); code != http.StatusNotFound {
+		t.Errorf("got status %v comparing revisions of another article, wanted %v", code, http.StatusNotFound)
+	}
+	if code, _ := get(t, r, "/admin/article/0/diff?from=0"); code != http.StatusBadRequest {
+		t.Errorf("got status %v without a revision to compare with, wanted %v", code, http.StatusBadRequest)
+	}
+}
+
+func TestAdminRestoreRevision(t *testing.T) {
+	db := database.Testdata()
+
+	article, err := db.GetArticleByID(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	original := article
+	article.Title = "inte ledare"
+	article.Content = "borta"
+	if err := db.UpdateArticle(article, "frblo"); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := func(c *gin.Context) {
+		c.Set(auth.KthIDKey, "testsupp")
+		AdminRestoreRevision(db, renderCache(db))(c)
+	}
+	route := "/admin/article/:article/revisions/:revision/restore"
+
+	if code := postForm(handler, route, "/admin/article/1/revisions/0/restore", nil); code != http.StatusNotFound {
+		t.Errorf("got status %v restoring a revision of another article, wanted %v", code, http.StatusNotFound)
+	}
+
+	if code := postForm(handler, route, "/admin/article/0/revisions/0/restore", nil); code != http.StatusSeeOther {
+		t.Fatalf("got status %v, wanted %v", code, http.StatusSeeOther)
+	}
+
+	restored, err := db.GetArticleByID(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.Title != original.Title || restored.Content != original.Content {
+		t.Errorf("got %q %q, wanted the original article back", restored.Title, restored.Content)
+	}
+
+	revisions, err := db.GetRevisions(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 3 || revisions[0].EditedBy.String != "testsupp" {
+		t.Errorf("got %+v, wanted the restore to be saved as a new revision", revisions)
+	}
+}
+
+func TestAdminMedia(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := database.Testdata()
+	library := &media.Library{Storage: media.Local{Dir: t.TempDir(), BaseURL: "/media"}, DB: db}
+
+	upload := func(filename string, data []byte) int {
+		t.Helper()
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		part, err := form.CreateFormFile("images", filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write(data)
+		form.Close()
+
+		r := gin.New()
+		r.POST("/admin/media", AdminUploadMedia(library, renderCache(db)))
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/admin/media", &body)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	var png bytes.Buffer
+	if err := imagepng.Encode(&png, image.NewRGBA(image.Rect(0, 0, 640, 480))); err != nil {
+		t.Fatal(err)
+	}
+	if code := upload("omslag.png", png.Bytes()); code != http.StatusSeeOther {
+		t.Fatalf("got status %v uploading an image, wanted %v", code, http.StatusSeeOther)
+	}
+	if code := upload("inte-en-bild.txt", []byte("hej")); code != http.StatusBadRequest {
+		t.Errorf("got status %v uploading text, wanted %v", code, http.StatusBadRequest)
+	}
+
+	images, err := db.GetImages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	uploaded := images[0]
+	if uploaded.Filename.String != "omslag.png" || len(uploaded.Sizes) != 2 {
+		t.Fatalf("unexpected upload %+v", uploaded)
+	}
+
+	// using the image in an article is noticed when it's saved
+	form := url.Values{"title": {"ledare"}, "content": {fmt.Sprintf("![](%v)", uploaded.Sizes[1].HostedURL)}}
+	if code := postForm(AdminUpdateArticle(db, renderCache(db)), "/admin/article/:article", "/admin/article/0", form); code != http.StatusSeeOther {
+		t.Fatalf("got status %v saving the article, wanted %v", code, http.StatusSeeOther)
+	}
+
+	r := testRouter(t, "/admin/media", AdminMedia(db, fakeHodis(t)))
+	code, body := get(t, r, "/admin/media")
+	if code != http.StatusOK {
+		t.Fatalf("got status %v, wanted %v", code, http.StatusOK)
+	}
+	assertContains(t, body, "omslag.png", "640x480", uploaded.Thumbnail(), `<a href="/admin/article/0">#0</a>`, "from before the media library")
+
+	route := "/admin/media/:image/alt"
+	path := fmt.Sprintf("/admin/media/%v/alt", uploaded.ID)
+	if code := postForm(AdminSetImageAltText(db, renderCache(db)), route, path, url.Values{"alt_text": {" ett omslag "}}); code != http.StatusSeeOther {
+		t.Fatalf("got status %v setting the alt text, wanted %v", code, http.StatusSeeOther)
+	}
+	if image, _ := db.GetImage(uploaded.ID); image.AltText.String != "ett omslag" {
+		t.Errorf("got alt text %q, wanted %q", image.AltText.String, "ett omslag")
+	}
+	if code := postForm(AdminSetImageAltText(db, renderCache(db)), route, "/admin/media/2/alt", url.Values{"alt_text": {"en pdf"}}); code != http.StatusNotFound {
+		t.Errorf("got status %v setting the alt text of a pdf, wanted %v", code, http.StatusNotFound)
+	}
+}
+
+func TestAdminRenderCache(t *testing.T) {
+	db := database.Testdata()
+	rendered := renderCache(db)
+
+	r := testRouter(t, "/issue/:issue", Issue(db, fixedDarkmode(false), fakeHodis(t), noViews(), rendered))
+	get(t, r, "/issue/0")
+	get(t, r, "/issue/0")
+	if stats := rendered.Stats(); stats.Entries != 2 || stats.Hits != 2 {
+		t.Fatalf("got %+v, wanted both articles of the issue cached", stats)
+	}
+
+	// editing an article drops it, even if it's saved as it was
+	form := url.Values{"title": {"ledare"}, "content": {db.Articles[0].Content}}
+	if code := postForm(AdminUpdateArticle(db, rendered), "/admin/article/:article", "/admin/article/0", form); code != http.StatusSeeOther {
+		t.Fatalf("got status %v saving the article, wanted %v", code, http.StatusSeeOther)
+	}
+	if entries := rendered.Stats().Entries; entries != 1 {
+		t.Errorf("got %v entries after editing, wanted 1", entries)
+	}
+
+	r = testRouter(t, "/admin", AdminHome(db, rendered))
+	_, body := get(t, r, "/admin")
+	assertContains(t, body, "1 of at most 100 articles are kept rendered", "50% of 4 articles shown")
+}
+
+func TestAdminErrors(t *testing.T) {
+	db := database.Testdata()
+
+	issue := testRouter(t, "/admin/issue/:issue", AdminIssue(db))
+	if code, body := get(t, issue, "/admin/issue/100"); code != http.StatusNotFound {
+		t.Errorf("got status %v for a missing issue, wanted %v", code, http.StatusNotFound)
+	} else {
+		assertContains(t, body, "Page not found")
+	}
+
+	article := testRouter(t, "/admin/article/:article", AdminArticle(db, fakeHodis(t)))
+	if code, _ := get(t, article, "/admin/article/100"); code != http.StatusNotFound {
+		t.Errorf("got status %v for a missing article, wanted %v", code, http.StatusNotFound)
+	}
+
+	update := postForm(AdminUpdateIssue(db), "/admin/issue/:issue", "/admin/issue/100",
+		url.Values{"title": {"Spökdbuggen"}, "publishing_date": {"2024-10-31"}})
+	if update != http.StatusNotFound {
+		t.Errorf("got status %v for updating a missing issue, wanted %v", update, http.StatusNotFound)
+	}
+	status := postForm(AdminSetIssueStatus(db), "/admin/issue/:issue/status", "/admin/issue/100/status",
+		url.Values{"status": {"published"}})
+	if status != http.StatusNotFound {
+		t.Errorf("got status %v for publishing a missing issue, wanted %v", status, http.StatusNotFound)
+	}
+
+	author := postForm(AdminAddAuthor(db), "/admin/article/:article/author", "/admin/article/0/author",
+		url.Values{"kth_id": {"nollan"}})
+	if author != http.StatusBadRequest {
+		t.Errorf("got status %v for an author who isn't a member, wanted %v", author, http.StatusBadRequest)
+	}
+
+	// editors get to see what was wrong with what they sent
+	if code, body := get(t, article, "/admin/article/lol"); code != http.StatusBadRequest {
+		t.Errorf("got status %v for a bad id, wanted %v", code, http.StatusBadRequest)
+	} else {
+		assertContains(t, body, "Bad request", "lol")
+	}
+}
+
+func TestAdminNotAllowed(t *testing.T) {
+	a := auth.New(auth.Fake{}, []byte("hemligt"), func(kthID string) (bool, error) {
+		return kthID == "frblo", nil
+	})
+	r := testRouter(t, "/admin", func(c *gin.Context) {})
+	r.GET("/admin/issue/:issue", a.Require(), AdminIssue(database.Testdata()))
+
+	// logged in, but not part of redaqtionen
+	login := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(login)
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	a.Sessions.Set(c, "nollan")
+
+	w := getWithHeaders(t, r, "/admin/issue/0", map[string]string{"Cookie": login.Result().Cookies()[0].String()})
+	code, body := w.Code, w.Body.String()
+	if code != http.StatusForbidden {
+		t.Errorf("got status %v, wanted %v", code, http.StatusForbidden)
+	}
+	assertContains(t, body, "not allowed here", `class="navbar"`)
+	assertMissing(t, body, "mörkläggningen", "Testdbuggen")
+}
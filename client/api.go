@@ -0,0 +1,306 @@
+package client
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"dbuggen/server/database"
+	"dbuggen/server/hodis"
+)
+
+// The json api mirrors the public pages for other tools to build on. The
+// types here are what the api promises to return, so fields must not be
+// renamed or removed even if the database changes. Add new ones instead.
+
+const (
+	apiDefaultPerPage = 20
+	apiMaxPerPage     = 100
+)
+
+type apiIssue struct {
+	ID             int     `json:"id"`
+	Title          string  `json:"title"`
+	Publication    string  `json:"publication"`
+	PublishingDate string  `json:"publishing_date"`
+	Views          int     `json:"views"`
+	CoverpageURL   *string `json:"coverpage_url"`
+	PdfURL         *string `json:"pdf_url"`
+	HtmlURL        *string `json:"html_url"`
+	URL            string  `json:"url"`
+	// Articles left out during mörkläggningen
+	HiddenArticles int `json:"hidden_articles"`
+}
+
+type apiIssueWithArticles struct {
+	apiIssue
+	Articles []apiArticleSummary `json:"articles"`
+}
+
+type apiArticleSummary struct {
+	Index      int    `json:"index"`
+	Title      string `json:"title"`
+	Authors    string `json:"authors"`
+	LastEdited string `json:"last_edited"`
+	URL        string `json:"url"`
+}
+
+type apiArticle struct {
+	ID         int         `json:"id"`
+	IssueID    int         `json:"issue_id"`
+	Index      int         `json:"index"`
+	Title      string      `json:"title"`
+	Authors    string      `json:"authors"`
+	AuthorList []apiAuthor `json:"author_list"`
+	Markdown   string      `json:"markdown"`
+	HTML       string      `json:"html"`
+	LastEdited string      `json:"last_edited"`
+	URL        string      `json:"url"`
+}
+
+type apiAuthor struct {
+	KthID string `json:"kth_id"`
+	Name  string `json:"name"`
+}
+
+type apiMember struct {
+	KthID      string  `json:"kth_id"`
+	Name       string  `json:"name"`
+	Title      string  `json:"title"`
+	PictureURL *string `json:"picture_url"`
+	URL        string  `json:"url"`
+}
+
+// A page of a list, along with what's needed to ask for the next one
+type apiPage[T any] struct {
+	Items   []T `json:"items"`
+	Page    int `json:"page"`
+	PerPage int `json:"per_page"`
+	Total   int `json:"total"`
+}
+
+// Issues of a publication, dbuggen unless the "publication" query parameter
+// says otherwise
+func APIIssues(db database.Store, ds *DarkmodeStatus) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		publication := database.Publication(c.DefaultQuery("publication", string(database.Dbuggen)))
+		if publication != database.Dbuggen && publication != database.Dtugget {
+			apiError(c, http.StatusBadRequest, "UNKNOWN_PUBLICATION", fmt.Sprintf("There is no publication %q", publication))
+			return
+		}
+
+		issuesRaw, err := db.GetPublicationIssues(publication, requestDarkmode(c, ds), false)
+		if err != nil {
+			apiError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Could not get the issues")
+			return
+		}
+
+		issues := make([]apiIssue, len(issuesRaw))
+		for i, issue := range issuesRaw {
+			issues[i] = toAPIIssue(issue)
+		}
+
+		c.JSON(http.StatusOK, paginate(c, issues))
+	}
+}
+
+// A single issue along with its articles, without their contents
+func APIIssue(db database.Store, ds *DarkmodeStatus, names *hodis.Resolver) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		issueID, err := strconv.Atoi(c.Param("issue"))
+		if err != nil {
+			apiError(c, http.StatusBadRequest, "BAD_ISSUE_ID", "The issue id must be a number")
+			return
+		}
+
+		darkmode := requestDarkmode(c, ds)
+
+		issue, err := db.GetIssue(issueID, darkmode, false)
+		if err != nil {
+			switch database.KindOf(err) {
+			case database.NotFound:
+				apiError(c, http.StatusNotFound, "ISSUE_NOT_FOUND", "Issue not found")
+			case database.Hidden:
+				apiError(c, http.StatusForbidden, "ISSUE_HIDDEN", "Issue hidden during mörkläggningen")
+			default:
+				apiError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Could not get the issue")
+			}
+			return
+		}
+
+		articles, err := db.GetArticles(issueID, darkmode)
+		if err != nil {
+			apiError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Could not get the articles")
+			return
+		}
+
+		authors, err := db.GetAuthorsForIssue(issueID)
+		if err != nil {
+			apiError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Could not get the authors")
+			return
+		}
+
+		resolveAuthors(ctx, names, authors...)
+
+		summaries := []apiArticleSummary{}
+		for _, article := range articles {
+			if darkmode && !article.N0lleSafe {
+				continue
+			}
+
+			var articleAuthors []database.Author
+			if article.IssueIndex < len(authors) {
+				articleAuthors = authors[article.IssueIndex]
+			}
+
+			summaries = append(summaries, apiArticleSummary{
+				Index:      article.IssueIndex,
+				Title:      article.Title,
+				Authors:    authortext(ctx, names, article.AuthorText, articleAuthors),
+				LastEdited: article.LastEdited.Format(time.DateOnly),
+				URL:        fmt.Sprintf("/issue/%v/%v", issue.ID, article.IssueIndex),
+			})
+		}
+
+		c.JSON(http.StatusOK, apiIssueWithArticles{toAPIIssue(issue), summaries})
+	}
+}
+
+// A single article with its contents, both as markdown and rendered
+func APIArticle(db database.Store, ds *DarkmodeStatus, names *hodis.Resolver, rendered *RenderCache) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		issueID, errI := strconv.Atoi(c.Param("issue"))
+		articleIndex, errA := strconv.Atoi(c.Param("article"))
+		if errI != nil || errA != nil {
+			apiError(c, http.StatusBadRequest, "BAD_ARTICLE_ID", "The issue id and article index must be numbers")
+			return
+		}
+
+		article, err := db.GetArticle(issueID, articleIndex, requestDarkmode(c, ds), false)
+		if err != nil {
+			switch database.KindOf(err) {
+			case database.NotFound:
+				apiError(c, http.StatusNotFound, "ARTICLE_NOT_FOUND", "Article not found")
+			case database.Hidden:
+				apiError(c, http.StatusForbidden, "ARTICLE_HIDDEN", "Article hidden during mörkläggningen")
+			default:
+				apiError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Could not get the article")
+			}
+			return
+		}
+
+		authors, err := db.GetAuthorsForArticle(article.ID)
+		if err != nil {
+			apiError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Could not get the authors")
+			return
+		}
+
+		authorList := make([]apiAuthor, len(authors))
+		for i, author := range authors {
+			authorList[i] = apiAuthor{author.KthID, authorsName(ctx, names, author)}
+		}
+
+		c.JSON(http.StatusOK, apiArticle{
+			ID:         article.ID,
+			IssueID:    article.Issue,
+			Index:      article.IssueIndex,
+			Title:      article.Title,
+			Authors:    authortext(ctx, names, article.AuthorText, authors),
+			AuthorList: authorList,
+			Markdown:   article.Content,
+			HTML:       string(rendered.Article(article)),
+			LastEdited: article.LastEdited.Format(time.DateOnly),
+			URL:        fmt.Sprintf("/issue/%v/%v", article.Issue, article.IssueIndex),
+		})
+	}
+}
+
+// All of active redaqtionen
+func APIMembers(db database.Store, names *hodis.Resolver) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		membersRaw, err := db.GetActiveMembers()
+		if err != nil {
+			apiError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Could not get the members")
+			return
+		}
+
+		// only look up the names of the members on the page asked for
+		page := paginate(c, membersRaw)
+		resolveMembers(ctx, names, page.Items)
+
+		members := make([]apiMember, len(page.Items))
+		for i, member := range page.Items {
+			members[i] = apiMember{
+				KthID:      member.KthID,
+				Name:       authorsName(ctx, names, database.Author{KthID: member.KthID, PreferedName: member.PreferedName}),
+				Title:      member.Title,
+				PictureURL: nullString(member.PictureURL),
+				URL:        fmt.Sprintf("/redaqtionen/%v", member.KthID),
+			}
+		}
+
+		c.JSON(http.StatusOK, apiPage[apiMember]{members, page.Page, page.PerPage, page.Total})
+	}
+}
+
+func toAPIIssue(issue database.HomeIssue) apiIssue {
+	return apiIssue{
+		ID:             issue.ID,
+		Title:          issue.Title,
+		Publication:    string(issue.Publication),
+		PublishingDate: issue.PublishingDate.Format(time.DateOnly),
+		Views:          issue.Views,
+		CoverpageURL:   nullString(issue.Coverpage),
+		PdfURL:         nullString(issue.Pdf),
+		HtmlURL:        nullString(issue.Html),
+		URL:            fmt.Sprintf("/issue/%v", issue.ID),
+		HiddenArticles: issue.Hidden,
+	}
+}
+
+// Turns a NullString into something that becomes null in json
+func nullString(s sql.NullString) *string {
+	if !s.Valid {
+		return nil
+	}
+	return &s.String
+}
+
+// Cuts out the page asked for by the "page" and "per_page" query parameters.
+// Asking for a page after the last one gives an empty page.
+func paginate[T any](c *gin.Context, items []T) apiPage[T] {
+	page := pageParam(c)
+	perPage, err := strconv.Atoi(c.Query("per_page"))
+	if err != nil || perPage < 1 {
+		perPage = apiDefaultPerPage
+	}
+	perPage = min(perPage, apiMaxPerPage)
+
+	start := len(items)
+	if page <= len(items)/perPage+1 { // no overflow for silly pages
+		start = min((page-1)*perPage, len(items))
+	}
+	end := min(start+perPage, len(items))
+
+	return apiPage[T]{
+		Items:   append([]T{}, items[start:end]...),
+		Page:    page,
+		PerPage: perPage,
+		Total:   len(items),
+	}
+}
+
+// Errors look the same as the ones for pages which don't exist
+func apiError(c *gin.Context, status int, code string, message string) {
+	c.AbortWithStatusJSON(status, gin.H{"code": code, "message": message})
+}
@@ -0,0 +1,189 @@
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"dbuggen/server/database"
+)
+
+// Makes a GET request and decodes the json response into v
+func getJSON(t *testing.T, path string, handler func(string) (int, string), v any) int {
+	t.Helper()
+	code, body := handler(path)
+	if err := json.Unmarshal([]byte(body), v); err != nil {
+		t.Fatalf("%v is not json: %v", body, err)
+	}
+	return code
+}
+
+func TestAPIIssues(t *testing.T) {
+	serve := func(darkmode bool) func(string) (int, string) {
+		r := testRouter(t, "/api/v1/issues", APIIssues(database.Testdata(), fixedDarkmode(darkmode)))
+		return func(path string) (int, string) { return get(t, r, path) }
+	}
+
+	t.Run("all", func(t *testing.T) {
+		var page apiPage[apiIssue]
+		code := getJSON(t, "/api/v1/issues", serve(false), &page)
+		if code != http.StatusOK {
+			t.Fatalf("got status %v, wanted %v", code, http.StatusOK)
+		}
+		if page.Total != 2 || len(page.Items) != 2 {
+			t.Fatalf("got %v of %v issues, wanted 2 of 2", len(page.Items), page.Total)
+		}
+
+		newest := page.Items[0]
+		if newest.ID != 1 || newest.Title != "Skojdbuggen" || newest.PublishingDate != "2024-04-17" || newest.URL != "/issue/1" {
+			t.Errorf("unexpected first issue %+v", newest)
+		}
+		if newest.PdfURL != nil {
+			t.Errorf("Skojdbuggen has no pdf, but got %v", *newest.PdfURL)
+		}
+		if pdf := page.Items[1].PdfURL; pdf == nil || *pdf != "https://dbuggen.s3.eu-west-1.amazonaws.com/dbuggen2/dbuggen-var-2024.pdf" {
+			t.Errorf("wrong pdf for Testdbuggen: %v", pdf)
+		}
+	})
+
+	t.Run("paginated", func(t *testing.T) {
+		var page apiPage[apiIssue]
+		getJSON(t, "/api/v1/issues?per_page=1&page=2", serve(false), &page)
+		if page.Total != 2 || page.Page != 2 || page.PerPage != 1 {
+			t.Errorf("got page %v of size %v with total %v", page.Page, page.PerPage, page.Total)
+		}
+		if len(page.Items) != 1 || page.Items[0].Title != "Testdbuggen" {
+			t.Errorf("got %+v, wanted only Testdbuggen", page.Items)
+		}
+
+		getJSON(t, "/api/v1/issues?page=9223372036854775807", serve(false), &page)
+		if len(page.Items) != 0 {
+			t.Errorf("got %+v past the last page", page.Items)
+		}
+	})
+
+	t.Run("darkmode", func(t *testing.T) {
+		var page apiPage[apiIssue]
+		getJSON(t, "/api/v1/issues", serve(true), &page)
+		if page.Total != 1 || page.Items[0].Title != "Testdbuggen" {
+			t.Errorf("got %+v, wanted only Testdbuggen", page.Items)
+		}
+	})
+
+	t.Run("dtugget", func(t *testing.T) {
+		var page apiPage[apiIssue]
+		getJSON(t, "/api/v1/issues?publication=dtugget", serve(false), &page)
+		if page.Total != 1 || page.Items[0].Publication != "dtugget" {
+			t.Errorf("got %+v, wanted only Sommardtugget", page.Items)
+		}
+	})
+
+	t.Run("unknown publication", func(t *testing.T) {
+		var e map[string]string
+		code := getJSON(t, "/api/v1/issues?publication=dsvuggen", serve(false), &e)
+		if code != http.StatusBadRequest || e["code"] != "UNKNOWN_PUBLICATION" {
+			t.Errorf("got %v %v", code, e)
+		}
+	})
+}
+
+func TestAPIIssue(t *testing.T) {
+	names := fakeHodis(t)
+
+	serve := func(darkmode bool) func(string) (int, string) {
+		r := testRouter(t, "/api/v1/issues/:issue", APIIssue(database.Testdata(), fixedDarkmode(darkmode), names))
+		return func(path string) (int, string) { return get(t, r, path) }
+	}
+
+	var issue apiIssueWithArticles
+	code := getJSON(t, "/api/v1/issues/0", serve(false), &issue)
+	if code != http.StatusOK {
+		t.Fatalf("got status %v, wanted %v", code, http.StatusOK)
+	}
+	if issue.Title != "Testdbuggen" || len(issue.Articles) != 2 {
+		t.Fatalf("unexpected issue %+v", issue)
+	}
+	if a := issue.Articles[0]; a.Title != "ledare" || a.Authors != "Skriven av Fredrik Blomqvist och BULL" || a.URL != "/issue/0/0" {
+		t.Errorf("unexpected article %+v", a)
+	}
+
+	db := database.Testdata()
+	db.Articles[1].N0lleSafe = false
+	r := testRouter(t, "/api/v1/issues/:issue", APIIssue(db, fixedDarkmode(true), names))
+	getJSON(t, "/api/v1/issues/0", func(path string) (int, string) { return get(t, r, path) }, &issue)
+	if len(issue.Articles) != 1 || issue.Articles[0].Title != "ledare" || issue.HiddenArticles != 1 {
+		t.Errorf("got %+v, wanted only ledare and one hidden article", issue)
+	}
+
+	var e map[string]string
+	if code := getJSON(t, "/api/v1/issues/1", serve(true), &e); code != http.StatusForbidden || e["code"] != "ISSUE_HIDDEN" {
+		t.Errorf("got %v %v for an issue hidden by darkmode", code, e)
+	}
+	if code := getJSON(t, "/api/v1/issues/100", serve(false), &e); code != http.StatusNotFound || e["code"] != "ISSUE_NOT_FOUND" {
+		t.Errorf("got %v %v for a missing issue", code, e)
+	}
+	if code := getJSON(t, "/api/v1/issues/lol", serve(false), &e); code != http.StatusBadRequest {
+		t.Errorf("got status %v for a bad id, wanted %v", code, http.StatusBadRequest)
+	}
+}
+
+func TestAPIArticle(t *testing.T) {
+	names := fakeHodis(t)
+
+	serve := func(darkmode bool) func(string) (int, string) {
+		r := testRouter(t, "/api/v1/issues/:issue/articles/:article", APIArticle(database.Testdata(), fixedDarkmode(darkmode), names, renderCache(database.Testdata())))
+		return func(path string) (int, string) { return get(t, r, path) }
+	}
+
+	var article apiArticle
+	code := getJSON(t, "/api/v1/issues/0/articles/0", serve(false), &article)
+	if code != http.StatusOK {
+		t.Fatalf("got status %v, wanted %v", code, http.StatusOK)
+	}
+	if article.Title != "ledare" || article.IssueID != 0 || article.Index != 0 {
+		t.Errorf("unexpected article %+v", article)
+	}
+	if len(article.AuthorList) != 2 || article.AuthorList[0] != (apiAuthor{"frblo", "Fredrik Blomqvist"}) {
+		t.Errorf("unexpected authors %+v", article.AuthorList)
+	}
+	if article.Markdown == "" || article.HTML == "" {
+		t.Error("the article has no contents")
+	}
+
+	var e map[string]string
+	if code := getJSON(t, "/api/v1/issues/1/articles/0", serve(true), &e); code != http.StatusForbidden || e["code"] != "ARTICLE_HIDDEN" {
+		t.Errorf("got %v %v for an article hidden by darkmode", code, e)
+	}
+	if code := getJSON(t, "/api/v1/issues/0/articles/5", serve(false), &e); code != http.StatusNotFound {
+		t.Errorf("got status %v for a missing article, wanted %v", code, http.StatusNotFound)
+	}
+}
+
+func TestAPIMembers(t *testing.T) {
+	names := fakeHodis(t)
+
+	r := testRouter(t, "/api/v1/members", APIMembers(database.Testdata(), names))
+	serve := func(path string) (int, string) { return get(t, r, path) }
+
+	var page apiPage[apiMember]
+	code := getJSON(t, "/api/v1/members", serve, &page)
+	if code != http.StatusOK {
+		t.Fatalf("got status %v, wanted %v", code, http.StatusOK)
+	}
+	if page.Total != 2 || len(page.Items) != 2 {
+		t.Fatalf("got %v of %v members, wanted 2 of 2", len(page.Items), page.Total)
+	}
+
+	got := map[string]string{}
+	for _, m := range page.Items {
+		got[m.KthID] = m.Name
+	}
+	if got["frblo"] != "Fredrik Blomqvist" || got["testsupp"] != "BULL" {
+		t.Errorf("unexpected names %v", got)
+	}
+
+	getJSON(t, "/api/v1/members?per_page=1", serve, &page)
+	if page.Total != 2 || len(page.Items) != 1 {
+		t.Errorf("got %v of %v members, wanted 1 of 2", len(page.Items), page.Total)
+	}
+}
@@ -1,16 +1,20 @@
 package client
 
 import (
+	"cmp"
+	"database/sql"
 	"embed"
 	"fmt"
 	"html/template"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/jmoiron/sqlx"
 
 	"dbuggen/server/database"
+	"dbuggen/server/hodis"
+	"dbuggen/server/upstream"
 )
 
 //go:embed html/*.html
@@ -20,11 +24,22 @@ var HTMLTemplates embed.FS
 var PublicFiles embed.FS
 
 // Home page
-func Home(db *sqlx.DB, ds *DarkmodeStatus) func(c *gin.Context) {
+func Home(db database.Store, ds *DarkmodeStatus) func(c *gin.Context) {
+	return Publication(db, ds, database.Dbuggen)
+}
+
+// Page listing dtugget, the smaller sibling of dbuggen
+func Dtugget(db database.Store, ds *DarkmodeStatus) func(c *gin.Context) {
+	return Publication(db, ds, database.Dtugget)
+}
+
+// Listing of all issues of a publication. The issues themselves are shown
+// the same way regardless of which publication they belong to.
+func Publication(db database.Store, ds *DarkmodeStatus, publication database.Publication) func(c *gin.Context) {
 	return func(c *gin.Context) {
-		issuesRaw, err := database.GetHomeIssues(db, Darkmode(ds))
+		issuesRaw, err := db.GetPublicationIssues(publication, requestDarkmode(c, ds), requestDrafts(c))
 		if err != nil {
-			c.AbortWithError(http.StatusInternalServerError, err)
+			pageError(c, err)
 			return
 		}
 
@@ -32,8 +47,23 @@ func Home(db *sqlx.DB, ds *DarkmodeStatus) func(c *gin.Context) {
 			IssueID        string
 			Title          string
 			PublishingDate string
-			Coverpage      template.HTML
+			Coverpage      *picture
 			Views          int
+			Hidden         int
+		}
+
+		covers := make([]sql.NullString, len(issuesRaw))
+		for i, iss := range issuesRaw {
+			covers[i] = iss.Coverpage
+		}
+		images := lookupImages(db, covers...)
+
+		published := make([]time.Time, 0, 2*len(issuesRaw))
+		for _, iss := range issuesRaw {
+			published = append(published, iss.PublishingDate, iss.PublishAt.Time)
+		}
+		if notModified(c, ds, latest(published...), issuesRaw, images) {
+			return
 		}
 
 		var issues []DisplayIssue
@@ -43,64 +73,81 @@ func Home(db *sqlx.DB, ds *DarkmodeStatus) func(c *gin.Context) {
 					fmt.Sprintf("issue/%v", iss.ID),
 					iss.Title,
 					iss.PublishingDate.Format(time.DateOnly),
-					coverpage(iss.Coverpage),
-					iss.Views})
+					coverpage(images, iss.Coverpage, iss.Title),
+					iss.Views,
+					iss.Hidden})
+		}
+		// the newest cover is at the top of the page
+		if len(issues) > 0 && issues[0].Coverpage != nil {
+			issues[0].Coverpage.Eager = true
 		}
 		c.HTML(http.StatusOK, "home.html", gin.H{
-			"pagetitle": "dbuggen",
+			"pagetitle": string(publication),
+			"heading":   string(publication),
 			"issues":    issues,
 		})
 	}
 }
 
 // Abritrary issue featuring all the articles
-func Issue(db *sqlx.DB, ds *DarkmodeStatus) func(c *gin.Context) {
+func Issue(db database.Store, ds *DarkmodeStatus, names *hodis.Resolver, views *ViewCounter, rendered *RenderCache) func(c *gin.Context) {
 	type issueArticle struct {
 		Title       string
 		ArticleLink string
 		Authors     string
 		Content     template.HTML
 		LastEdited  string
+		// Not nØllesafe during mörkläggningen, shown as a placeholder
+		Hidden bool
 	}
 
 	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
 		issueID, err := pathIntSeparator(c.Param("issue"))
 		if err != nil {
-			c.Redirect(http.StatusBadRequest, "/")
+			pageErrorStatus(c, http.StatusBadRequest, err)
 			return
 		}
 
-		darkmode := Darkmode(ds)
+		darkmode := requestDarkmode(c, ds)
 
-		issue, err := database.GetIssue(db, issueID, darkmode)
+		issue, err := db.GetIssue(issueID, darkmode, requestDrafts(c))
 		if err != nil {
-			c.Redirect(http.StatusInternalServerError, "/")
+			pageError(c, err)
 			return
 		}
 
-		articles, err := database.GetArticles(db, issueID, darkmode)
+		articles, err := db.GetArticles(issueID, darkmode)
 		if err != nil {
-			c.Redirect(http.StatusInternalServerError, "/")
+			pageError(c, err)
 			return
 		}
 
-		databaseAuthors, err := database.GetAuthorsForIssue(db, issueID)
+		databaseAuthors, err := db.GetAuthorsForIssue(issueID)
 		if err != nil {
-			c.Redirect(http.StatusInternalServerError, "/")
+			pageError(c, err)
 			return
 		}
 
+		resolveAuthors(ctx, names, databaseAuthors...)
+
 		var issueArticles []issueArticle
 		for _, article := range articles {
+			if darkmode && !article.N0lleSafe {
+				issueArticles = append(issueArticles, issueArticle{Hidden: true})
+				continue
+			}
+
 			var authors string
 			if len(databaseAuthors) <= article.IssueIndex {
 				var a []database.Author
-				authors = authortext(article.AuthorText, a)
+				authors = authortext(ctx, names, article.AuthorText, a)
 			} else {
-				authors = authortext(article.AuthorText, databaseAuthors[article.IssueIndex])
+				authors = authortext(ctx, names, article.AuthorText, databaseAuthors[article.IssueIndex])
 			}
 
-			content := mdToHTML(article.Content)
+			content := rendered.Article(article)
 			lastEdited := article.LastEdited.Format(time.DateOnly)
 			issueArticle := issueArticle{
 				Title:       article.Title,
@@ -112,57 +159,137 @@ func Issue(db *sqlx.DB, ds *DarkmodeStatus) func(c *gin.Context) {
 			issueArticles = append(issueArticles, issueArticle)
 		}
 
+		views.Record(issue.ID, visitorID(c, ds))
+
+		cover := coverpage(lookupImages(db, issue.Coverpage), issue.Coverpage, issue.Title)
+		if cover != nil {
+			cover.Eager = true
+		}
+
+		edited := []time.Time{issue.PublishingDate, issue.PublishAt.Time}
+		for _, article := range articles {
+			edited = append(edited, article.LastEdited)
+		}
+		if notModified(c, ds, latest(edited...), issue.Title, issue.Pdf, htmlLink(issue), issueArticles, cover) {
+			return
+		}
+
 		c.HTML(http.StatusOK, "issue.html", gin.H{
-			"coverpage":  coverpage(issue.Coverpage),
+			"coverpage":  cover,
 			"issueTitle": issue.Title,
+			"pdf":        issue.Pdf.String,
+			"pdfLink":    fmt.Sprintf("/issue/%v/pdf", issue.ID),
+			"htmlLink":   htmlLink(issue),
 			"articles":   issueArticles,
+			// only redaqtionen gets this far before it's out
+			"unpublished": !issue.Published(time.Now()),
+		})
+	}
+}
+
+// The PDF of an issue, shown inline
+func IssuePDF(db database.Store, ds *DarkmodeStatus) func(c *gin.Context) {
+	return issueExternal(db, ds, "pdf.html", func(issue database.HomeIssue) sql.NullString { return issue.Pdf })
+}
+
+// The HTML edition of an issue, from before articles were written in
+// markdown
+func IssueHTML(db database.Store, ds *DarkmodeStatus) func(c *gin.Context) {
+	return issueExternal(db, ds, "legacy.html", func(issue database.HomeIssue) sql.NullString { return issue.Html })
+}
+
+// Shows an external file belonging to an issue in the template, if the
+// issue has one.
+func issueExternal(db database.Store, ds *DarkmodeStatus, templateName string, external func(database.HomeIssue) sql.NullString) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		issueID, err := pathIntSeparator(c.Param("issue"))
+		if err != nil {
+			pageErrorStatus(c, http.StatusBadRequest, err)
+			return
+		}
+
+		issue, err := db.GetIssue(issueID, requestDarkmode(c, ds), requestDrafts(c))
+		if err != nil {
+			pageError(c, err)
+			return
+		}
+
+		url := external(issue)
+		if !url.Valid {
+			pageErrorStatus(c, http.StatusNotFound, fmt.Errorf("issue %v has nothing for %v", issue.ID, templateName))
+			return
+		}
+
+		c.HTML(http.StatusOK, templateName, gin.H{
+			"pagetitle":  issue.Title,
+			"issueTitle": issue.Title,
+			"issueLink":  fmt.Sprintf("/issue/%v", issue.ID),
+			"url":        url.String,
 		})
 	}
 }
 
 // Arbitrary article
-func Article(db *sqlx.DB, ds *DarkmodeStatus) func(c *gin.Context) {
+func Article(db database.Store, ds *DarkmodeStatus, names *hodis.Resolver, views *ViewCounter, rendered *RenderCache) func(c *gin.Context) {
 	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
 		issueID, errI := pathIntSeparator(c.Param("issue"))
 		articleIndex, errA := pathIntSeparator(c.Param("article"))
-		if errI != nil || errA != nil {
-			c.Redirect(http.StatusBadRequest, "")
+		if err := cmp.Or(errI, errA); err != nil {
+			pageErrorStatus(c, http.StatusBadRequest, err)
 			return
 		}
 
-		article, err := database.GetArticle(db, issueID, articleIndex, Darkmode(ds))
+		article, err := db.GetArticle(issueID, articleIndex, requestDarkmode(c, ds), requestDrafts(c))
 		if err != nil {
-			c.Redirect(http.StatusInternalServerError, "")
+			pageError(c, err)
 			return
 		}
-		authors, err := database.GetAuthorsForArticle(db, article.ID)
+		authors, err := db.GetAuthorsForArticle(article.ID)
 		if err != nil {
-			c.Redirect(http.StatusInternalServerError, "")
+			pageError(c, err)
+			return
+		}
+
+		views.Record(article.Issue, visitorID(c, ds))
+
+		authorText := authortext(ctx, names, article.AuthorText, authors)
+		content := rendered.Article(article)
+		if notModified(c, ds, article.LastEdited, article.Title, authorText, content) {
 			return
 		}
 
 		c.HTML(http.StatusOK, "article.html", gin.H{
 			"pagetitle":      article.Title,
 			"title":          article.Title,
-			"authors":        authortext(article.AuthorText, authors),
-			"articleContent": mdToHTML(article.Content),
+			"authors":        authorText,
+			"articleContent": content,
 		})
 	}
 }
 
 // Page for all of (active) redaqtionen to be shown to the world
-func Redaqtionen(db *sqlx.DB, DFUNKT_URL string) func(c *gin.Context) {
+func Redaqtionen(db database.Store, names *hodis.Resolver, dfunkt *upstream.Client) func(c *gin.Context) {
 	return func(c *gin.Context) {
-		members, err := database.GetActiveMembers(db)
+		ctx := c.Request.Context()
+
+		members, err := db.GetActiveMembers()
 		if err != nil {
-			c.Redirect(http.StatusInternalServerError, "")
+			pageError(c, err)
 			return
 		}
 
-		chefredIDs := getChefreds(DFUNKT_URL)
+		pictures := make([]sql.NullString, len(members))
+		for i, member := range members {
+			pictures[i] = member.PictureURL
+		}
+		images := lookupImages(db, pictures...)
+
+		chefredIDs := getChefreds(ctx, dfunkt)
 		chefreds, members := removeDuplicateChefreds(chefredIDs, members)
-		displaymembers := displaymemberize(members)
-		displayChefreds := displaymemberize(chefreds)
+		displaymembers := displaymemberize(ctx, names, images, members)
+		displayChefreds := displaymemberize(ctx, names, images, chefreds)
 
 		c.HTML(http.StatusOK, "redaqtionen.html", gin.H{
 			"chefreds": displayChefreds,
@@ -170,3 +297,109 @@ func Redaqtionen(db *sqlx.DB, DFUNKT_URL string) func(c *gin.Context) {
 		})
 	}
 }
+
+// Page for a single member of redaqtionen and everything they've written
+func Member(db database.Store, ds *DarkmodeStatus, names *hodis.Resolver) func(c *gin.Context) {
+	type memberArticle struct {
+		Title          string
+		ArticleLink    string
+		IssueTitle     string
+		PublishingDate string
+	}
+
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		kthID := c.Param("kthid")
+
+		member, err := db.GetMember(kthID)
+		if err != nil {
+			pageError(c, err)
+			return
+		}
+
+		articlesRaw, err := db.GetArticlesByAuthor(kthID, requestDarkmode(c, ds), requestDrafts(c))
+		if err != nil {
+			pageError(c, err)
+			return
+		}
+
+		articles := make([]memberArticle, len(articlesRaw))
+		for i, article := range articlesRaw {
+			articles[i] = memberArticle{
+				Title:          article.Title,
+				ArticleLink:    fmt.Sprintf("/issue/%v/%v", article.IssueID, article.IssueIndex),
+				IssueTitle:     article.IssueTitle,
+				PublishingDate: article.PublishingDate.Format(time.DateOnly),
+			}
+		}
+
+		name := authorsName(ctx, names, database.Author{KthID: member.KthID, PreferedName: member.PreferedName})
+		picture := memberpicture(lookupImages(db, member.PictureURL), member.PictureURL, name)
+		picture.Eager = true
+
+		c.HTML(http.StatusOK, "member.html", gin.H{
+			"pagetitle": name,
+			"name":      name,
+			"picture":   picture,
+			"title":     member.Title,
+			"articles":  articles,
+		})
+	}
+}
+
+// Search through all articles
+func Search(db database.Store, ds *DarkmodeStatus) func(c *gin.Context) {
+	const perPage = 10
+
+	type searchResult struct {
+		Title          string
+		ArticleLink    string
+		IssueTitle     string
+		PublishingDate string
+		Snippet        template.HTML
+	}
+
+	return func(c *gin.Context) {
+		query := strings.TrimSpace(c.Query("q"))
+		page := pageParam(c)
+
+		var results []searchResult
+		total := 0
+		if query != "" {
+			resultsRaw, t, err := db.SearchArticles(query, requestDarkmode(c, ds), requestDrafts(c), perPage, (page-1)*perPage)
+			if err != nil {
+				pageError(c, err)
+				return
+			}
+
+			total = t
+			for _, result := range resultsRaw {
+				results = append(results, searchResult{
+					Title:          result.Title,
+					ArticleLink:    fmt.Sprintf("/issue/%v/%v", result.IssueID, result.IssueIndex),
+					IssueTitle:     result.IssueTitle,
+					PublishingDate: result.PublishingDate.Format(time.DateOnly),
+					Snippet:        highlightSnippet(result.Snippet),
+				})
+			}
+		}
+
+		var previous, next string
+		if page > 1 {
+			previous = searchLink(query, page-1)
+		}
+		if page*perPage < total {
+			next = searchLink(query, page+1)
+		}
+
+		c.HTML(http.StatusOK, "search.html", gin.H{
+			"pagetitle": "sök",
+			"query":     query,
+			"total":     total,
+			"results":   results,
+			"previous":  previous,
+			"next":      next,
+		})
+	}
+}
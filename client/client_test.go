@@ -0,0 +1,301 @@
+package client
+
+import (
+	"encoding/json"
+	"html/template"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"dbuggen/server/database"
+	"dbuggen/server/hodis"
+	"dbuggen/server/upstream"
+)
+
+// A router with the real templates, serving a single handler at path
+func testRouter(t *testing.T, path string, handler func(c *gin.Context)) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	templates, err := template.ParseFS(HTMLTemplates, "**/*.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := gin.New()
+	r.SetHTMLTemplate(templates)
+	r.Use(ErrorPages())
+	r.GET(path, handler)
+	return r
+}
+
+// Makes a GET request to the router and returns the status and body
+func get(t *testing.T, r *gin.Engine, path string) (int, string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+
+	body, err := io.ReadAll(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w.Code, string(body)
+}
+
+// Serves the handler as if redaqtionen were asking
+func asEditor(handler func(c *gin.Context)) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		c.Set(editorKey, true)
+		handler(c)
+	}
+}
+
+// A darkmode status which won't ask darkmode for a day
+func fixedDarkmode(darkmode bool) *DarkmodeStatus {
+	return &DarkmodeStatus{Darkmode: darkmode, LastPoll: time.Now()}
+}
+
+// A service which answers everything at path with status and body
+func fakeService(t *testing.T, path string, status int, body string) *upstream.Client {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != path {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(server.Close)
+
+	client := upstream.New("fake", server.URL, time.Second)
+	client.HTTP = server.Client()
+	client.Retries = 0
+	return client
+}
+
+// A hodis which only knows frblo and testsupp
+func fakeHodis(t *testing.T) *hodis.Resolver {
+	t.Helper()
+	known := map[string]string{"frblo": "Fredrik Blomqvist", "testsupp": "test support"}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, ok := known[strings.TrimPrefix(r.URL.Path, "/uid/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"displayName": name})
+	}))
+	t.Cleanup(server.Close)
+
+	client := upstream.New("hodis", server.URL, time.Second)
+	client.HTTP = server.Client()
+	return hodis.New(client, nil)
+}
+
+func noViews() *ViewCounter {
+	return NewViewCounter(time.Hour, func(map[int]int) error { return nil })
+}
+
+func renderCache(db database.Store) *RenderCache {
+	return NewRenderCache(db, 100, false)
+}
+
+func assertContains(t *testing.T, body string, wanted ...string) {
+	t.Helper()
+	for _, w := range wanted {
+		if !strings.Contains(body, w) {
+			t.Errorf("%q is missing from the page", w)
+		}
+	}
+}
+
+func assertMissing(t *testing.T, body string, unwanted ...string) {
+	t.Helper()
+	for _, u := range unwanted {
+		if strings.Contains(body, u) {
+			t.Errorf("%q shouldn't be on the page", u)
+		}
+	}
+}
+
+func TestHomeHandler(t *testing.T) {
+	t.Run("normal", func(t *testing.T) {
+		r := testRouter(t, "/", Home(database.Testdata(), fixedDarkmode(false)))
+		code, body := get(t, r, "/")
+		if code != http.StatusOK {
+			t.Fatalf("got status %v, wanted %v", code, http.StatusOK)
+		}
+		assertContains(t, body, "Testdbuggen", "Skojdbuggen", "issue/0", "issue/1", "marke.png")
+		// dtugget has its own listing
+		assertMissing(t, body, "Sommardtugget")
+	})
+
+	t.Run("darkmode", func(t *testing.T) {
+		r := testRouter(t, "/", Home(database.Testdata(), fixedDarkmode(true)))
+		code, body := get(t, r, "/")
+		if code != http.StatusOK {
+			t.Fatalf("got status %v, wanted %v", code, http.StatusOK)
+		}
+		assertContains(t, body, "Testdbuggen")
+		assertMissing(t, body, "Skojdbuggen", "hidden during mörkläggningen")
+	})
+
+	t.Run("scheduled", func(t *testing.T) {
+		db := database.Testdata()
+		r := testRouter(t, "/", Home(db, fixedDarkmode(false)))
+		_, body := get(t, r, "/")
+		assertMissing(t, body, "Framtidsdbuggen")
+
+		r = testRouter(t, "/", asEditor(Home(db, fixedDarkmode(false))))
+		_, body = get(t, r, "/")
+		assertContains(t, body, "Framtidsdbuggen")
+	})
+
+	t.Run("partly hidden", func(t *testing.T) {
+		db := database.Testdata()
+		db.Articles[1].N0lleSafe = false
+
+		r := testRouter(t, "/", Home(db, fixedDarkmode(true)))
+		_, body := get(t, r, "/")
+		assertContains(t, body, "Testdbuggen", "1 article is hidden during mörkläggningen")
+	})
+}
+
+func TestIssueHandler(t *testing.T) {
+	names := fakeHodis(t)
+
+	db := database.Testdata()
+	var flushed map[int]int
+	views := NewViewCounter(time.Hour, func(v map[int]int) error {
+		flushed = v
+		return nil
+	})
+
+	r := testRouter(t, "/issue/:issue", Issue(db, fixedDarkmode(false), names, views, renderCache(db)))
+	code, body := get(t, r, "/issue/0")
+	if code != http.StatusOK {
+		t.Fatalf("got status %v, wanted %v", code, http.StatusOK)
+	}
+	assertContains(t, body,
+		"Testdbuggen",
+		"ledare",
+		"bästa toan att ta koks i på KTH",
+		"Skriven av Fredrik Blomqvist och BULL",
+		"skriven av anonym redaqtör",
+		"/issue/0/pdf",
+		"dbuggen-var-2024.pdf")
+
+	if err := views.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if flushed[0] != 1 {
+		t.Errorf("the issue got %v views, wanted 1", flushed[0])
+	}
+}
+
+func TestIssueHandlerScheduled(t *testing.T) {
+	names := fakeHodis(t)
+	db := database.Testdata()
+
+	r := testRouter(t, "/issue/:issue", Issue(db, fixedDarkmode(false), names, noViews(), renderCache(db)))
+	if code, _ := get(t, r, "/issue/3"); code != http.StatusNotFound {
+		t.Errorf("got status %v for an issue which isn't published yet, wanted %v", code, http.StatusNotFound)
+	}
+
+	r = testRouter(t, "/issue/:issue", asEditor(Issue(db, fixedDarkmode(false), names, noViews(), renderCache(db))))
+	code, body := get(t, r, "/issue/3")
+	if code != http.StatusOK {
+		t.Fatalf("got status %v for an editor, wanted %v", code, http.StatusOK)
+	}
+	assertContains(t, body, "Framtidsdbuggen", "hemlig ledare", "isn't published yet")
+}
+
+func TestIssueHandlerDarkmode(t *testing.T) {
+	names := fakeHodis(t)
+
+	db := database.Testdata()
+	db.Articles[1].N0lleSafe = false
+
+	r := testRouter(t, "/issue/:issue", Issue(db, fixedDarkmode(true), names, noViews(), renderCache(db)))
+	code, body := get(t, r, "/issue/0")
+	if code != http.StatusOK {
+		t.Fatalf("got status %v, wanted %v", code, http.StatusOK)
+	}
+	assertContains(t, body, "ledare", "Skriven av Fredrik Blomqvist och BULL", "This article is hidden during mörkläggningen")
+	assertMissing(t, body, "koks", "skriven av anonym redaqtör", "/issue/0/1")
+}
+
+func TestArticleHandler(t *testing.T) {
+	names := fakeHodis(t)
+	db := database.Testdata()
+
+	r := testRouter(t, "/issue/:issue/:article", Article(db, fixedDarkmode(false), names, noViews(), renderCache(db)))
+
+	t.Run("with authors", func(t *testing.T) {
+		code, body := get(t, r, "/issue/0/0")
+		if code != http.StatusOK {
+			t.Fatalf("got status %v, wanted %v", code, http.StatusOK)
+		}
+		assertContains(t, body, "<h1>ledare</h1>", "Skriven av Fredrik Blomqvist och BULL", "<strong>kul</strong>")
+	})
+
+	t.Run("with author text", func(t *testing.T) {
+		code, body := get(t, r, "/issue/0/1")
+		if code != http.StatusOK {
+			t.Fatalf("got status %v, wanted %v", code, http.StatusOK)
+		}
+		assertContains(t, body, "bästa toan att ta koks i på KTH", "skriven av anonym redaqtör")
+		assertMissing(t, body, "Fredrik Blomqvist")
+	})
+
+	t.Run("with math", func(t *testing.T) {
+		_, body := get(t, r, "/issue/0/1")
+		assertContains(t, body, `<math display="block">`, "<mfrac>")
+		// rendered here, not by scripts from somewhere else
+		assertMissing(t, body, "MathJax", "$$")
+	})
+
+	t.Run("hidden by darkmode", func(t *testing.T) {
+		db := database.Testdata()
+		db.Articles[1].N0lleSafe = false
+
+		r := testRouter(t, "/issue/:issue/:article", Article(db, fixedDarkmode(true), names, noViews(), renderCache(db)))
+		if code, _ := get(t, r, "/issue/0/0"); code != http.StatusOK {
+			t.Errorf("got status %v for a nØllesafe article, wanted %v", code, http.StatusOK)
+		}
+		code, body := get(t, r, "/issue/0/1")
+		if code != http.StatusForbidden {
+			t.Errorf("got status %v for a hidden article, wanted %v", code, http.StatusForbidden)
+		}
+		assertContains(t, body, "hidden during mörkläggningen")
+		assertMissing(t, body, "koks")
+	})
+}
+
+func TestRedaqtionenHandler(t *testing.T) {
+	names := fakeHodis(t)
+
+	dfunkt := fakeService(t, "/api/role/chefred/current", http.StatusOK, `{"mandates": [{"user": {"kthid": "frblo"}}]}`)
+
+	r := testRouter(t, "/redaqtionen", Redaqtionen(database.Testdata(), names, dfunkt))
+	code, body := get(t, r, "/redaqtionen")
+	if code != http.StatusOK {
+		t.Fatalf("got status %v, wanted %v", code, http.StatusOK)
+	}
+	assertContains(t, body, "Fredrik Blomqvist", "chefred", "BULL", "slave", "redaqtionen/testsupp")
+
+	// chefreds come first, and only once
+	if strings.Index(body, "Fredrik Blomqvist") > strings.Index(body, "BULL") {
+		t.Error("the chefred isn't shown before the other members")
+	}
+	if strings.Count(body, "<h2>Fredrik Blomqvist</h2>") != 1 {
+		t.Error("the chefred is shown more than once")
+	}
+}
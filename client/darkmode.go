@@ -0,0 +1,204 @@
+package client
+
+import (
+	"context"
+	"crypto/subtle"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"dbuggen/server/database"
+	"dbuggen/server/upstream"
+)
+
+// How long the latest status from darkmode is trusted if darkmode can't be
+// reached. After that everything is hidden, just in case.
+const darkmodeMaxAge = 24 * time.Hour
+
+// How soon a failed poll is retried at first
+const darkmodeRetry = 10 * time.Second
+
+// Where an editor's preview is kept, in a cookie for the rest of the
+// browser session and in the gin context during a request
+const (
+	previewCookie = "dbuggen_darkmode_preview"
+	previewKey    = "darkmodePreview"
+)
+
+// Whether mörkläggningen is active, as last told by darkmode. It's kept up
+// to date by Run and DarkmodeWebhook, so that no page has to wait for
+// darkmode.
+type DarkmodeStatus struct {
+	Darkmode bool
+	// When darkmode last told us anything
+	LastPoll time.Time
+	// What redaqtionen has decided, following darkmode if empty
+	Override database.DarkmodeMode
+	Upstream *upstream.Client
+	Mutex    sync.RWMutex
+
+	// When the status or override last changed, zero if they haven't since
+	// starting
+	changed time.Time
+}
+
+// Darkmode tells whether mörkläggningen is active, and with it whether
+// everything not nØllesafe should be hidden. Redaqtionen can force it
+// either way, otherwise it's whatever darkmode says. If darkmode hasn't been
+// heard from in a day it's assumed to be active.
+func Darkmode(ds *DarkmodeStatus) bool {
+	ds.Mutex.RLock()
+	defer ds.Mutex.RUnlock()
+
+	switch ds.Override {
+	case database.DarkmodeForceOn:
+		return true
+	case database.DarkmodeForceOff:
+		return false
+	}
+
+	if time.Since(ds.LastPoll) > darkmodeMaxAge {
+		return true
+	}
+	return ds.Darkmode
+}
+
+// Like Darkmode, unless the request is from an editor previewing the site
+// with darkmode on or off, see Editors.
+func requestDarkmode(c *gin.Context, ds *DarkmodeStatus) bool {
+	if preview, ok := c.Get(previewKey); ok {
+		return preview.(bool)
+	}
+	return Darkmode(ds)
+}
+
+// The latest status from darkmode and when it came, regardless of how old
+// it is.
+func (ds *DarkmodeStatus) Status() (bool, time.Time) {
+	ds.Mutex.RLock()
+	defer ds.Mutex.RUnlock()
+
+	return ds.Darkmode, ds.LastPoll
+}
+
+// Sets the status, as if darkmode had just said so.
+func (ds *DarkmodeStatus) Set(darkmode bool) {
+	ds.Mutex.Lock()
+	defer ds.Mutex.Unlock()
+
+	if darkmode != ds.Darkmode {
+		ds.changed = time.Now()
+	}
+	ds.Darkmode = darkmode
+	ds.LastPoll = time.Now()
+}
+
+func (ds *DarkmodeStatus) SetOverride(mode database.DarkmodeMode) {
+	ds.Mutex.Lock()
+	defer ds.Mutex.Unlock()
+
+	if mode != ds.Override {
+		ds.changed = time.Now()
+	}
+	ds.Override = mode
+}
+
+// Changed tells when what Darkmode says last changed, or a time after that.
+// It's zero if it hasn't changed since starting.
+func (ds *DarkmodeStatus) Changed() time.Time {
+	ds.Mutex.RLock()
+	defer ds.Mutex.RUnlock()
+
+	changed := ds.changed
+	if ds.Override != database.DarkmodeForceOn && ds.Override != database.DarkmodeForceOff {
+		// when darkmode was last heard from a day ago, it went on
+		if stale := ds.LastPoll.Add(darkmodeMaxAge); stale.Before(time.Now()) && stale.After(changed) {
+			changed = stale
+		}
+	}
+	return changed
+}
+
+// Asks darkmode for the status. Nothing changes if it can't be reached or
+// gives a weird answer.
+func (ds *DarkmodeStatus) Poll(ctx context.Context) error {
+	contents, err := ds.Upstream.Get(ctx, "")
+	if err != nil {
+		return err
+	}
+
+	darkmode, err := strconv.ParseBool(strings.TrimSpace(string(contents)))
+	if err != nil {
+		return err
+	}
+
+	ds.Set(darkmode)
+	return nil
+}
+
+// Run polls darkmode right away and then every interval until ctx is done.
+// A failed poll is retried sooner, waiting twice as long after every failure
+// in a row, up to the interval.
+func (ds *DarkmodeStatus) Run(ctx context.Context, interval time.Duration) {
+	retry := min(darkmodeRetry, interval)
+	wait := time.Duration(0)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		if err := ds.Poll(ctx); err != nil {
+			log.Printf("polling darkmode failed, trying again in %v: %v", retry, err)
+			wait = retry
+			retry = min(2*retry, interval)
+			continue
+		}
+
+		wait = interval
+		retry = min(darkmodeRetry, interval)
+	}
+}
+
+// Lets darkmode tell us right away when mörkläggningen starts or ends,
+// instead of waiting for the next poll. The body is "true" or "false", the
+// same as darkmode answers with, and the secret has to be given as a bearer
+// token. Without a secret there's no webhook.
+func DarkmodeWebhook(ds *DarkmodeStatus, secret string) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		if secret == "" {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+
+		token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, 64))
+		if err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		darkmode, err := strconv.ParseBool(strings.TrimSpace(string(body)))
+		if err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		ds.Set(darkmode)
+		log.Printf("darkmode set to %v through the webhook", darkmode)
+		c.Status(http.StatusNoContent)
+	}
+}
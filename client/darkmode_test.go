@@ -0,0 +1,307 @@
+package client
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"dbuggen/server/auth"
+	"dbuggen/server/database"
+	"dbuggen/server/upstream"
+)
+
+func TestDarkmodeFalse(t *testing.T) {
+	expected := false
+	darkmode := fakeService(t, "/", http.StatusOK, strconv.FormatBool(expected))
+
+	oldpoll := time.Date(1983, time.October, 7, 17, 0, 0, 0, time.Local)
+	ds := DarkmodeStatus{
+		Darkmode: true,
+		LastPoll: oldpoll,
+		Upstream: darkmode,
+		Mutex:    sync.RWMutex{},
+	}
+
+	if err := ds.Poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	got := Darkmode(&ds)
+	if got != expected {
+		t.Errorf("got %v, wanted %v", got, expected)
+	}
+	if ds.LastPoll == oldpoll {
+		t.Errorf("The polling date of the struct has not been updated")
+	}
+}
+
+func TestDarkmodeTrue(t *testing.T) {
+	expected := true
+	darkmode := fakeService(t, "/", http.StatusOK, strconv.FormatBool(expected))
+
+	oldpoll := time.Date(1983, time.October, 7, 17, 0, 0, 0, time.Local)
+	ds := DarkmodeStatus{
+		Darkmode: false,
+		LastPoll: oldpoll,
+		Upstream: darkmode,
+		Mutex:    sync.RWMutex{},
+	}
+
+	if err := ds.Poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	got := Darkmode(&ds)
+	if got != expected {
+		t.Errorf("got %v, wanted %v", got, expected)
+	}
+	if ds.LastPoll == oldpoll {
+		t.Errorf("The polling date of the struct has not been updated")
+	}
+}
+
+func TestDarkmodeInvalid(t *testing.T) {
+	darkmode := fakeService(t, "/", http.StatusOK, "hehe, not a bool n00b")
+
+	oldpoll := time.Date(1983, time.October, 7, 17, 0, 0, 0, time.Local)
+	ds := DarkmodeStatus{
+		Darkmode: false,
+		LastPoll: oldpoll,
+		Upstream: darkmode,
+		Mutex:    sync.RWMutex{},
+	}
+
+	if err := ds.Poll(context.Background()); err == nil {
+		t.Error("expected an error polling an invalid status")
+	}
+
+	// the status is too old to be trusted
+	expected := true
+	got := Darkmode(&ds)
+	if got != expected {
+		t.Errorf("got %v, wanted %v", got, expected)
+	}
+	if ds.LastPoll != oldpoll {
+		t.Errorf("The darkmode status has been updated with an invalid url")
+	}
+}
+
+func TestDarkmodeKeepsLastStatus(t *testing.T) {
+	darkmode := fakeService(t, "/", http.StatusServiceUnavailable, "")
+	darkmode.Backoff = time.Millisecond
+
+	lastPoll := time.Now().Add(-time.Hour)
+	ds := DarkmodeStatus{Darkmode: false, LastPoll: lastPoll, Upstream: darkmode}
+
+	if err := ds.Poll(context.Background()); err == nil {
+		t.Error("expected an error with darkmode down")
+	}
+	if got := Darkmode(&ds); got != false {
+		t.Error("a failed poll should keep the last status while it's fresh")
+	}
+	if darkmode, polled := ds.Status(); darkmode || polled != lastPoll {
+		t.Errorf("got status %v from %v, wanted false from %v", darkmode, polled, lastPoll)
+	}
+}
+
+func TestDarkmodeRun(t *testing.T) {
+	// fails twice before answering
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= 2 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("false"))
+	}))
+	defer server.Close()
+
+	darkmode := upstream.New("darkmode", server.URL, time.Second)
+	darkmode.HTTP = server.Client()
+	darkmode.Retries = 0
+	ds := DarkmodeStatus{Darkmode: true, Upstream: darkmode}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		ds.Run(ctx, 20*time.Millisecond)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for Darkmode(&ds) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if Darkmode(&ds) {
+		t.Error("the poller never got the status from darkmode")
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("the poller didn't stop")
+	}
+}
+
+func TestDarkmodeWebhook(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	post := func(handler func(c *gin.Context), auth string, body string) int {
+		r := gin.New()
+		r.POST("/webhook/darkmode", handler)
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/webhook/darkmode", strings.NewReader(body))
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	ds := fixedDarkmode(false)
+	webhook := DarkmodeWebhook(ds, "hemligt")
+
+	if code := post(webhook, "", "true"); code != http.StatusUnauthorized {
+		t.Errorf("got status %v without a secret, wanted %v", code, http.StatusUnauthorized)
+	}
+	if code := post(webhook, "Bearer fel", "true"); code != http.StatusUnauthorized {
+		t.Errorf("got status %v with the wrong secret, wanted %v", code, http.StatusUnauthorized)
+	}
+	if Darkmode(ds) {
+		t.Fatal("darkmode was changed without the secret")
+	}
+
+	if code := post(webhook, "Bearer hemligt", "kanske"); code != http.StatusBadRequest {
+		t.Errorf("got status %v for a weird status, wanted %v", code, http.StatusBadRequest)
+	}
+
+	if code := post(webhook, "Bearer hemligt", "true\n"); code != http.StatusNoContent {
+		t.Errorf("got status %v, wanted %v", code, http.StatusNoContent)
+	}
+	if !Darkmode(ds) {
+		t.Error("darkmode wasn't turned on")
+	}
+
+	if code := post(DarkmodeWebhook(ds, ""), "Bearer ", "false"); code != http.StatusNotFound {
+		t.Errorf("got status %v without a configured secret, wanted %v", code, http.StatusNotFound)
+	}
+}
+
+func TestDarkmodeOverride(t *testing.T) {
+	ds := fixedDarkmode(false)
+
+	ds.SetOverride(database.DarkmodeForceOn)
+	if !Darkmode(ds) {
+		t.Error("darkmode is off even though it's forced on")
+	}
+
+	ds.SetOverride(database.DarkmodeForceOff)
+	ds.LastPoll = time.Time{}
+	if Darkmode(ds) {
+		t.Error("darkmode is on even though it's forced off")
+	}
+
+	ds.SetOverride(database.DarkmodeFollow)
+	if !Darkmode(ds) {
+		t.Error("darkmode should be on when following a darkmode which hasn't been heard from")
+	}
+}
+
+func TestEditors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	serve := func(editor bool, cookie string) (bool, string) {
+		r := gin.New()
+		r.Use(Editors(func(c *gin.Context) bool { return editor }))
+
+		var darkmode bool
+		r.GET("/", func(c *gin.Context) { darkmode = requestDarkmode(c, fixedDarkmode(false)) })
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if cookie != "" {
+			req.AddCookie(&http.Cookie{Name: previewCookie, Value: cookie})
+		}
+		r.ServeHTTP(w, req)
+		return darkmode, w.Header().Get("Cache-Control")
+	}
+
+	if darkmode, cache := serve(true, "true"); !darkmode || cache != "private, no-store" {
+		t.Errorf("got darkmode %v and Cache-Control %q for an editor previewing", darkmode, cache)
+	}
+	if darkmode, _ := serve(false, "true"); darkmode {
+		t.Error("someone who isn't an editor got to preview")
+	}
+	if darkmode, _ := serve(true, ""); darkmode {
+		t.Error("got darkmode for an editor who isn't previewing")
+	}
+	if _, cache := serve(false, ""); cache != "" {
+		t.Errorf("got Cache-Control %q for someone who isn't an editor", cache)
+	}
+	if darkmode, _ := serve(true, "kanske"); darkmode {
+		t.Error("a weird preview cookie changed darkmode")
+	}
+}
+
+func TestAdminSetDarkmode(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db := database.Testdata()
+	ds := fixedDarkmode(false)
+
+	post := func(mode string) int {
+		r := gin.New()
+		r.POST("/admin/darkmode", func(c *gin.Context) { c.Set(auth.KthIDKey, "frblo") }, AdminSetDarkmode(db, ds))
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/admin/darkmode", strings.NewReader(url.Values{"mode": {mode}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := post("kanske"); code != http.StatusBadRequest {
+		t.Errorf("got status %v for an unknown mode, wanted %v", code, http.StatusBadRequest)
+	}
+
+	if code := post("on"); code != http.StatusSeeOther {
+		t.Fatalf("got status %v, wanted %v", code, http.StatusSeeOther)
+	}
+	if !Darkmode(ds) {
+		t.Error("darkmode wasn't forced on")
+	}
+
+	override, err := db.GetDarkmodeOverride()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if override.Mode != database.DarkmodeForceOn || override.ChangedBy.String != "frblo" {
+		t.Errorf("got %+v saved, wanted it forced on by frblo", override)
+	}
+}
+
+func TestAdminDarkmode(t *testing.T) {
+	db := database.Testdata()
+	db.DarkmodeOverride = database.DarkmodeOverride{
+		Mode:      database.DarkmodeForceOn,
+		ChangedBy: sql.NullString{String: "frblo", Valid: true},
+		ChangedAt: time.Date(2024, time.August, 19, 12, 0, 0, 0, time.UTC),
+	}
+
+	r := testRouter(t, "/admin/darkmode", AdminDarkmode(db, fixedDarkmode(false)))
+	code, body := get(t, r, "/admin/darkmode")
+	if code != http.StatusOK {
+		t.Fatalf("got status %v, wanted %v", code, http.StatusOK)
+	}
+	assertContains(t, body, `<option value="on" selected>`, "Last changed by frblo on 2024-08-19 12:00:00")
+}
@@ -0,0 +1,88 @@
+package client
+
+import "strings"
+
+// A row of a side by side diff. A line which only exists on one side has an
+// empty line number on the other.
+type diffRow struct {
+	LeftLine  int
+	Left      string
+	RightLine int
+	Right     string
+	// "same", "removed", "added" or "changed"
+	Kind string
+}
+
+// Compares two versions of a text line by line, for showing them next to
+// each other. Lines which were removed right where others were added are
+// put on the same row as changed.
+func sideBySide(from, to string) []diffRow {
+	a := splitLines(from)
+	b := splitLines(to)
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:]
+	// and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var rows []diffRow
+	var removed, added []int
+
+	// pairs up what was removed and added since the last common line
+	flush := func() {
+		for k := range max(len(removed), len(added)) {
+			row := diffRow{Kind: "changed"}
+			if k < len(removed) {
+				row.LeftLine, row.Left = removed[k]+1, a[removed[k]]
+			} else {
+				row.Kind = "added"
+			}
+			if k < len(added) {
+				row.RightLine, row.Right = added[k]+1, b[added[k]]
+			} else {
+				row.Kind = "removed"
+			}
+			rows = append(rows, row)
+		}
+		removed, added = nil, nil
+	}
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			flush()
+			rows = append(rows, diffRow{i + 1, a[i], j + 1, b[j], "same"})
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			removed = append(removed, i)
+			i++
+		default:
+			added = append(added, j)
+			j++
+		}
+	}
+	flush()
+
+	return rows
+}
+
+func splitLines(s string) []string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
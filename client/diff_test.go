@@ -0,0 +1,69 @@
+package client
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSideBySide(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+		expected []diffRow
+	}{
+		{
+			name:     "same",
+			from:     "a\nb\n",
+			to:       "a\nb",
+			expected: []diffRow{{1, "a", 1, "a", "same"}, {2, "b", 2, "b", "same"}},
+		},
+		{
+			name: "changed",
+			from: "a\nb\nc",
+			to:   "a\nB\nc",
+			expected: []diffRow{
+				{1, "a", 1, "a", "same"},
+				{2, "b", 2, "B", "changed"},
+				{3, "c", 3, "c", "same"},
+			},
+		},
+		{
+			name: "added and removed",
+			from: "a\nb\nc",
+			to:   "b\nc\nd\ne",
+			expected: []diffRow{
+				{1, "a", 0, "", "removed"},
+				{2, "b", 1, "b", "same"},
+				{3, "c", 2, "c", "same"},
+				{0, "", 3, "d", "added"},
+				{0, "", 4, "e", "added"},
+			},
+		},
+		{
+			name: "more removed than added",
+			from: "a\nb\nc\nd",
+			to:   "a\nx\nd",
+			expected: []diffRow{
+				{1, "a", 1, "a", "same"},
+				{2, "b", 2, "x", "changed"},
+				{3, "c", 0, "", "removed"},
+				{4, "d", 3, "d", "same"},
+			},
+		},
+		{
+			name:     "from nothing",
+			from:     "",
+			to:       "a\r\nb",
+			expected: []diffRow{{0, "", 1, "a", "added"}, {0, "", 2, "b", "added"}},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := sideBySide(tc.from, tc.to)
+			if !slices.Equal(got, tc.expected) {
+				t.Errorf("got %+v, wanted %+v", got, tc.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package client
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"dbuggen/server/database"
+)
+
+// What's shown for an error, both on the page and in the json for the api
+type errorPage struct {
+	code    string
+	title   string
+	message string
+}
+
+var errorPages = map[int]errorPage{
+	http.StatusBadRequest: {"BAD_REQUEST", "Bad request", "Something in the request didn't make sense."},
+	http.StatusForbidden:  {"FORBIDDEN", "Forbidden", "You're not allowed here."},
+	http.StatusNotFound:   {"PAGE_NOT_FOUND", "Page not found", "There's nothing here, or at least not yet."},
+	http.StatusInternalServerError: {"INTERNAL_ERROR", "Something went wrong",
+		"Something broke on our end. Try again in a bit, and tell redaqtionen if it keeps happening."},
+}
+
+// Shown instead of the usual 403 for what mörkläggningen hides, rather than
+// what someone isn't allowed to see
+var hiddenPage = errorPage{"HIDDEN", "Hidden", "This isn't nØllesafe, so it's hidden during mörkläggningen. Come back when it's over!"}
+
+// ErrorPages turns requests which were aborted with an error status, but
+// without anything written, into a page with the dbuggen layout saying what
+// went wrong. The api, and anyone else who would rather have json, gets the
+// same errors as the api handlers give.
+//
+// Handlers get here through pageError and pageErrorStatus, since
+// c.AbortWithError and c.AbortWithStatus send the status right away. For
+// bad requests the error is shown too, since it's about what was sent,
+// like a form missing something, and never about the database.
+func ErrorPages() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		status := c.Writer.Status()
+		if status < http.StatusBadRequest || c.Writer.Written() {
+			return
+		}
+
+		page, ok := errorPages[status]
+		if !ok {
+			text := http.StatusText(status)
+			page = errorPage{strings.ToUpper(strings.ReplaceAll(text, " ", "_")), text, text + "."}
+		}
+
+		err := c.Errors.Last()
+		if status == http.StatusForbidden && err != nil && database.KindOf(err.Err) == database.Hidden {
+			page = hiddenPage
+		}
+
+		if wantsJSON(c) {
+			apiError(c, status, page.code, page.title)
+			return
+		}
+
+		var detail string
+		if status == http.StatusBadRequest && err != nil {
+			detail = err.Error()
+		}
+
+		c.HTML(status, "error.html", gin.H{
+			"pagetitle": page.title,
+			"title":     page.title,
+			"message":   page.message,
+			"detail":    detail,
+		})
+	}
+}
+
+// Whether the request is for the api, or from something which asks for
+// json rather than html
+func wantsJSON(c *gin.Context) bool {
+	if strings.HasPrefix(c.Request.URL.Path, "/api/") {
+		return true
+	}
+	return c.NegotiateFormat(gin.MIMEHTML, gin.MIMEJSON) == gin.MIMEJSON
+}
+
+// The status fitting an error from the database
+func errorStatus(err error) int {
+	switch database.KindOf(err) {
+	case database.NotFound:
+		return http.StatusNotFound
+	case database.Hidden:
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// Aborts with the error page fitting an error from the database, see
+// ErrorPages
+func pageError(c *gin.Context, err error) {
+	pageErrorStatus(c, errorStatus(err), err)
+}
+
+// Aborts with the error page for status, keeping err for the logs
+func pageErrorStatus(c *gin.Context, status int, err error) {
+	c.Error(err)
+	c.Abort()
+	c.Status(status)
+}
@@ -0,0 +1,90 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"dbuggen/server/database"
+)
+
+// A store where getting issues fails as if the database were down
+type brokenStore struct {
+	database.Store
+}
+
+func (brokenStore) GetIssue(issueID int, darkmode bool, drafts bool) (database.HomeIssue, error) {
+	return database.HomeIssue{}, errors.New("connection refused")
+}
+
+func TestErrorPages(t *testing.T) {
+	names := fakeHodis(t)
+	db := database.Testdata()
+
+	issue := testRouter(t, "/issue/:issue", Issue(db, fixedDarkmode(true), names, noViews(), renderCache(db)))
+	broken := testRouter(t, "/issue/:issue", Issue(brokenStore{db}, fixedDarkmode(false), names, noViews(), renderCache(db)))
+
+	pages := []struct {
+		name   string
+		r      *gin.Engine
+		path   string
+		status int
+		text   string
+	}{
+		{"missing issue", issue, "/issue/100", http.StatusNotFound, "Page not found"},
+		// Skojdbuggen has nothing nØllesafe in it
+		{"hidden issue", issue, "/issue/1", http.StatusForbidden, "hidden during mörkläggningen"},
+		{"bad id", issue, "/issue/lol", http.StatusBadRequest, "Bad request"},
+		{"broken database", broken, "/issue/0", http.StatusInternalServerError, "Something went wrong"},
+		{"no such page", issue, "/nowhere", http.StatusNotFound, "Page not found"},
+	}
+
+	for _, page := range pages {
+		t.Run(page.name, func(t *testing.T) {
+			w := getWithHeaders(t, page.r, page.path, nil)
+			if w.Code != page.status {
+				t.Errorf("got status %v, wanted %v", w.Code, page.status)
+			}
+			if location := w.Header().Get("Location"); location != "" {
+				t.Errorf("got redirected to %q", location)
+			}
+			if contentType := w.Header().Get("Content-Type"); contentType != "text/html; charset=utf-8" {
+				t.Errorf("got %q, wanted a page", contentType)
+			}
+			// with the layout around it, and nothing about what went wrong
+			assertContains(t, w.Body.String(), page.text, `class="navbar"`)
+			assertMissing(t, w.Body.String(), "connection refused")
+		})
+	}
+}
+
+func TestErrorPagesJSON(t *testing.T) {
+	r := testRouter(t, "/issue/:issue", Issue(database.Testdata(), fixedDarkmode(false), fakeHodis(t), noViews(), renderCache(database.Testdata())))
+
+	requests := []struct {
+		path    string
+		headers map[string]string
+		status  int
+		code    string
+	}{
+		{"/api/v1/nowhere", nil, http.StatusNotFound, "PAGE_NOT_FOUND"},
+		{"/issue/100", map[string]string{"Accept": "application/json"}, http.StatusNotFound, "PAGE_NOT_FOUND"},
+		{"/issue/lol", map[string]string{"Accept": "application/json"}, http.StatusBadRequest, "BAD_REQUEST"},
+	}
+
+	for _, request := range requests {
+		w := getWithHeaders(t, r, request.path, request.headers)
+
+		var e map[string]string
+		if err := json.Unmarshal(w.Body.Bytes(), &e); err != nil {
+			t.Errorf("got %q for %v, wanted json: %v", w.Body, request.path, err)
+			continue
+		}
+		if w.Code != request.status || e["code"] != request.code || e["message"] == "" {
+			t.Errorf("got %v %v for %v, wanted %v %v", w.Code, e, request.path, request.status, request.code)
+		}
+	}
+}
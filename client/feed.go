@@ -0,0 +1,284 @@
+package client
+
+import (
+	"context"
+	"database/sql"
+	"encoding/xml"
+	"fmt"
+	"html/template"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"dbuggen/server/auth"
+	"dbuggen/server/database"
+	"dbuggen/server/hodis"
+)
+
+// How many of the latest issues the feeds contain
+const feedIssues = 10
+
+// Something to put in a feed, either an article or an issue without any
+// articles (which probably only has a pdf)
+type feedEntry struct {
+	Title     string
+	Link      string
+	Author    string
+	Content   string
+	Published time.Time
+}
+
+// RSS 2.0 feed of the latest issues and their articles
+func RSS(db database.Store, ds *DarkmodeStatus, names *hodis.Resolver, rendered *RenderCache) func(c *gin.Context) {
+	type rssItem struct {
+		Title       string `xml:"title"`
+		Link        string `xml:"link"`
+		GUID        string `xml:"guid"`
+		Creator     string `xml:"dc:creator"`
+		Description string `xml:"description"`
+		PubDate     string `xml:"pubDate"`
+	}
+	type rssSelfLink struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr"`
+		Type string `xml:"type,attr"`
+	}
+	type rssChannel struct {
+		Title         string      `xml:"title"`
+		Link          string      `xml:"link"`
+		Self          rssSelfLink `xml:"atom:link"`
+		Description   string      `xml:"description"`
+		Language      string      `xml:"language"`
+		LastBuildDate string      `xml:"lastBuildDate,omitempty"`
+		Items         []rssItem   `xml:"item"`
+	}
+	type rss struct {
+		XMLName xml.Name   `xml:"rss"`
+		Version string     `xml:"version,attr"`
+		Atom    string     `xml:"xmlns:atom,attr"`
+		DC      string     `xml:"xmlns:dc,attr"`
+		Channel rssChannel `xml:"channel"`
+	}
+
+	return func(c *gin.Context) {
+		base := siteURL(c)
+		ctx := c.Request.Context()
+		entries, err := feedEntries(ctx, db, rendered, names, requestDarkmode(c, ds), base)
+		if err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		channel := rssChannel{
+			Title:       "dbuggen",
+			Link:        base + "/",
+			Self:        rssSelfLink{base + "/feed.xml", "self", "application/rss+xml"},
+			Description: "Datasektionens tidning",
+			Language:    "sv",
+		}
+		if len(entries) > 0 {
+			channel.LastBuildDate = entries[0].Published.Format(time.RFC1123Z)
+		}
+		for _, entry := range entries {
+			channel.Items = append(channel.Items, rssItem{
+				Title:       entry.Title,
+				Link:        entry.Link,
+				GUID:        entry.Link,
+				Creator:     entry.Author,
+				Description: entry.Content,
+				PubDate:     entry.Published.Format(time.RFC1123Z),
+			})
+		}
+
+		writeXML(c, "application/rss+xml", rss{
+			Version: "2.0",
+			Atom:    "http://www.w3.org/2005/Atom",
+			DC:      "http://purl.org/dc/elements/1.1/",
+			Channel: channel,
+		})
+	}
+}
+
+// Atom feed of the latest issues and their articles
+func Atom(db database.Store, ds *DarkmodeStatus, names *hodis.Resolver, rendered *RenderCache) func(c *gin.Context) {
+	type atomLink struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr,omitempty"`
+	}
+	type atomAuthor struct {
+		Name string `xml:"name"`
+	}
+	type atomContent struct {
+		Type string `xml:"type,attr"`
+		Body string `xml:",chardata"`
+	}
+	type atomEntry struct {
+		Title     string      `xml:"title"`
+		ID        string      `xml:"id"`
+		Link      atomLink    `xml:"link"`
+		Author    atomAuthor  `xml:"author"`
+		Published string      `xml:"published"`
+		Updated   string      `xml:"updated"`
+		Content   atomContent `xml:"content"`
+	}
+	type atomFeed struct {
+		XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+		Title   string      `xml:"title"`
+		ID      string      `xml:"id"`
+		Links   []atomLink  `xml:"link"`
+		Updated string      `xml:"updated"`
+		Entries []atomEntry `xml:"entry"`
+	}
+
+	return func(c *gin.Context) {
+		base := siteURL(c)
+		ctx := c.Request.Context()
+		entries, err := feedEntries(ctx, db, rendered, names, requestDarkmode(c, ds), base)
+		if err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		feed := atomFeed{
+			Title:   "dbuggen",
+			ID:      base + "/",
+			Links:   []atomLink{{base + "/", "alternate"}, {base + "/atom.xml", "self"}},
+			Updated: time.Unix(0, 0).UTC().Format(time.RFC3339),
+		}
+		if len(entries) > 0 {
+			feed.Updated = entries[0].Published.Format(time.RFC3339)
+		}
+		for _, entry := range entries {
+			published := entry.Published.Format(time.RFC3339)
+			feed.Entries = append(feed.Entries, atomEntry{
+				Title:     entry.Title,
+				ID:        entry.Link,
+				Link:      atomLink{Href: entry.Link},
+				Author:    atomAuthor{entry.Author},
+				Published: published,
+				Updated:   published,
+				Content:   atomContent{"html", entry.Content},
+			})
+		}
+
+		writeXML(c, "application/atom+xml", feed)
+	}
+}
+
+// Everything in the latest issues, newest first. Articles hidden by
+// darkmode are left out, so that nothing unsafe can end up in a feed
+// reader.
+func feedEntries(ctx context.Context, db database.Store, rendered *RenderCache, names *hodis.Resolver, darkmode bool, base string) ([]feedEntry, error) {
+	issues, err := db.GetHomeIssues(darkmode, false)
+	if err != nil {
+		return nil, err
+	}
+	issues = issues[:min(len(issues), feedIssues)]
+
+	var entries []feedEntry
+	for _, issue := range issues {
+		issueLink := fmt.Sprintf("%v/issue/%v", base, issue.ID)
+
+		articles, err := db.GetArticles(issue.ID, darkmode)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(articles) == 0 {
+			entries = append(entries, feedEntry{
+				Title:     issue.Title,
+				Link:      issueLink,
+				Author:    authortext(ctx, names, sql.NullString{}, nil),
+				Content:   fmt.Sprintf(`<p><a href="%v">%v</a></p>`, issueLink, template.HTMLEscapeString(issue.Title)),
+				Published: issue.PublishingDate,
+			})
+			continue
+		}
+
+		authors, err := db.GetAuthorsForIssue(issue.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		resolveAuthors(ctx, names, authors...)
+
+		for _, article := range articles {
+			if darkmode && !article.N0lleSafe {
+				continue
+			}
+
+			var articleAuthors []database.Author
+			if article.IssueIndex < len(authors) {
+				articleAuthors = authors[article.IssueIndex]
+			}
+
+			link := fmt.Sprintf("%v/%v", issueLink, article.IssueIndex)
+			entries = append(entries, feedEntry{
+				Title:     fmt.Sprintf("%v: %v", issue.Title, article.Title),
+				Link:      link,
+				Author:    authortext(ctx, names, article.AuthorText, articleAuthors),
+				Content:   absoluteURLs(string(rendered.Article(article)), base, link),
+				Published: issue.PublishingDate,
+			})
+		}
+	}
+
+	return entries, nil
+}
+
+func writeXML(c *gin.Context, contentType string, v any) {
+	body, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	c.Data(http.StatusOK, contentType+"; charset=utf-8", append([]byte(xml.Header), body...))
+}
+
+// The links and images in rendered html, which are quoted with "
+var urlAttributes = regexp.MustCompile(`\s(href|src|srcset)="([^"]*)"`)
+
+// Makes the links and images in rendered html absolute, since feed readers
+// show it somewhere else than the page it was rendered for. Links within
+// the page, like footnotes, go to the page at link.
+func absoluteURLs(content string, base string, link string) string {
+	absolute := func(url string) string {
+		switch {
+		case strings.HasPrefix(url, "#"):
+			return link + url
+		case strings.HasPrefix(url, "/") && !strings.HasPrefix(url, "//"):
+			return base + url
+		default:
+			return url
+		}
+	}
+
+	return urlAttributes.ReplaceAllStringFunc(content, func(attr string) string {
+		match := urlAttributes.FindStringSubmatch(attr)
+		name, value := match[1], match[2]
+
+		if name != "srcset" {
+			return fmt.Sprintf(` %v="%v"`, name, absolute(value))
+		}
+		// a list of urls with their widths
+		candidates := strings.Split(value, ",")
+		for i, candidate := range candidates {
+			candidate = strings.TrimSpace(candidate)
+			url, width, _ := strings.Cut(candidate, " ")
+			candidates[i] = strings.TrimSpace(absolute(url) + " " + width)
+		}
+		return fmt.Sprintf(` srcset="%v"`, strings.Join(candidates, ", "))
+	})
+}
+
+// Where the site is reached from, since feeds need absolute links
+func siteURL(c *gin.Context) string {
+	scheme := "http"
+	if auth.Secure(c) {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host
+}
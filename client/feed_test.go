@@ -0,0 +1,131 @@
+package client
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strings"
+	"testing"
+
+	"dbuggen/server/database"
+)
+
+func TestRSS(t *testing.T) {
+	names := fakeHodis(t)
+
+	type feed struct {
+		Channel struct {
+			Items []struct {
+				Title       string `xml:"title"`
+				Link        string `xml:"link"`
+				Creator     string `xml:"http://purl.org/dc/elements/1.1/ creator"`
+				Description string `xml:"description"`
+				PubDate     string `xml:"pubDate"`
+			} `xml:"item"`
+		} `xml:"channel"`
+	}
+
+	r := testRouter(t, "/feed.xml", RSS(database.Testdata(), fixedDarkmode(false), names, renderCache(database.Testdata())))
+	code, body := get(t, r, "/feed.xml")
+	if code != http.StatusOK {
+		t.Fatalf("got status %v, wanted %v", code, http.StatusOK)
+	}
+
+	var f feed
+	if err := xml.Unmarshal([]byte(body), &f); err != nil {
+		t.Fatal(err)
+	}
+
+	items := f.Channel.Items
+	if len(items) != 3 {
+		t.Fatalf("got %v items, wanted one for each dbuggen article", len(items))
+	}
+
+	// newest issue first
+	if items[0].Title != "Skojdbuggen: (ledare) lol" || items[0].Link != "http://example.com/issue/1/0" {
+		t.Errorf("unexpected first item %+v", items[0])
+	}
+	if items[0].PubDate != "Wed, 17 Apr 2024 00:00:00 +0000" {
+		t.Errorf("got date %v, wanted the publishing date", items[0].PubDate)
+	}
+
+	if items[1].Creator != "Skriven av Fredrik Blomqvist och BULL" {
+		t.Errorf("got author %v", items[1].Creator)
+	}
+	if !strings.Contains(items[1].Description, "<strong>kul</strong>") {
+		t.Errorf("the content isn't rendered: %v", items[1].Description)
+	}
+	if items[2].Creator != "skriven av anonym redaqtör" {
+		t.Errorf("got author %v", items[2].Creator)
+	}
+}
+
+func TestAtom(t *testing.T) {
+	names := fakeHodis(t)
+
+	type feed struct {
+		Entries []struct {
+			Title     string `xml:"title"`
+			Published string `xml:"published"`
+			Author    string `xml:"author>name"`
+			Content   string `xml:"content"`
+		} `xml:"entry"`
+	}
+
+	r := testRouter(t, "/atom.xml", Atom(database.Testdata(), fixedDarkmode(false), names, renderCache(database.Testdata())))
+	code, body := get(t, r, "/atom.xml")
+	if code != http.StatusOK {
+		t.Fatalf("got status %v, wanted %v", code, http.StatusOK)
+	}
+
+	var f feed
+	if err := xml.Unmarshal([]byte(body), &f); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(f.Entries) != 3 {
+		t.Fatalf("got %v entries, wanted one for each dbuggen article", len(f.Entries))
+	}
+	if e := f.Entries[1]; e.Title != "Testdbuggen: ledare" || e.Published != "2024-02-23T00:00:00Z" || e.Author != "Skriven av Fredrik Blomqvist och BULL" {
+		t.Errorf("unexpected entry %+v", e)
+	}
+}
+
+func TestFeedAbsoluteURLs(t *testing.T) {
+	db := testImages()
+	db.Articles[0].Content = "![bävern](/media/images/abc/original.jpg) från [förra numret](/issue/1)[^1]\n\n[^1]: en fotnot"
+
+	r := testRouter(t, "/atom.xml", Atom(db, fixedDarkmode(false), fakeHodis(t), renderCache(db)))
+	code, body := get(t, r, "/atom.xml")
+	if code != http.StatusOK {
+		t.Fatalf("got status %v, wanted %v", code, http.StatusOK)
+	}
+	// the content is escaped in the feed
+	assertContains(t, body, `src=&#34;http://example.com/media/images/abc/original.jpg&#34;`,
+		`srcset=&#34;http://example.com/media/images/abc/200.jpg 200w, http://example.com/media/images/abc/480.jpg 480w,`,
+		`href=&#34;http://example.com/issue/1&#34;`, `href=&#34;http://example.com/issue/0/0#`)
+	assertMissing(t, body, `src=&#34;/media`, `href=&#34;/issue`, `href=&#34;#`)
+}
+
+func TestFeedDarkmode(t *testing.T) {
+	names := fakeHodis(t)
+
+	t.Run("unsafe issue", func(t *testing.T) {
+		r := testRouter(t, "/feed.xml", RSS(database.Testdata(), fixedDarkmode(true), names, renderCache(database.Testdata())))
+		_, body := get(t, r, "/feed.xml")
+		assertContains(t, body, "Testdbuggen: ledare")
+		assertMissing(t, body, "Skojdbuggen", "lugnt")
+	})
+
+	t.Run("partly unsafe issue", func(t *testing.T) {
+		db := database.Testdata()
+		db.Articles[1].N0lleSafe = false
+
+		r := testRouter(t, "/atom.xml", Atom(db, fixedDarkmode(true), names, renderCache(db)))
+		code, body := get(t, r, "/atom.xml")
+		if code != http.StatusOK {
+			t.Fatalf("got status %v, wanted %v", code, http.StatusOK)
+		}
+		assertContains(t, body, "Testdbuggen: ledare")
+		assertMissing(t, body, "koks", "Skojdbuggen")
+	})
+}
@@ -0,0 +1,100 @@
+package client
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// When the server started, which is part of every ETag and Last-Modified so
+// that pages are fetched again after a deploy
+var started = time.Now()
+
+// During mörkläggningen only nØllesafe things are shown, so pages can be
+// cached by anyone for a while. Otherwise they can only be kept by the
+// browser, which has to ask if they're still fresh, so that nothing unsafe
+// is served from a cache once mörkläggningen starts.
+const (
+	darkmodeCacheControl = "public, max-age=300"
+	normalCacheControl   = "private, no-cache"
+)
+
+// Sets the caching headers of a page and answers 304 Not Modified if the
+// client already has it, in which case true is returned and nothing more
+// should be sent.
+//
+// The ETag is made from version, which should be everything the page is
+// made from, along with the darkmode status. The dates in the database are
+// only days, so the page is taken as modified at the end of the day of
+// lastEdited, or when darkmode changed if that's later. Since that misses
+// things like titles being changed, If-Modified-Since is only used by
+// clients which don't send If-None-Match.
+//
+// Pages for redaqtionen can have drafts and previews on them, and aren't
+// cached at all, see Editors.
+func notModified(c *gin.Context, ds *DarkmodeStatus, lastEdited time.Time, version ...any) bool {
+	if requestDrafts(c) {
+		return false
+	}
+
+	darkmode := Darkmode(ds)
+	hash := sha256.New()
+	fmt.Fprint(hash, started.UnixNano(), darkmode)
+	for _, v := range version {
+		fmt.Fprintf(hash, "\n%+v", v)
+	}
+	etag := fmt.Sprintf(`W/"%x"`, hash.Sum(nil)[:16])
+
+	modified := latest(lastEdited.Add(24*time.Hour), ds.Changed(), started)
+	if now := time.Now(); modified.After(now) {
+		modified = now
+	}
+	modified = modified.Truncate(time.Second)
+
+	c.Header("ETag", etag)
+	c.Header("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	if darkmode {
+		c.Header("Cache-Control", darkmodeCacheControl)
+	} else {
+		c.Header("Cache-Control", normalCacheControl)
+	}
+
+	if match := c.GetHeader("If-None-Match"); match != "" {
+		if !etagMatches(match, etag) {
+			return false
+		}
+	} else if since, err := http.ParseTime(c.GetHeader("If-Modified-Since")); err != nil || modified.After(since) {
+		return false
+	}
+
+	c.AbortWithStatus(http.StatusNotModified)
+	return true
+}
+
+// Whether an If-None-Match header has the ETag in it, where weak and strong
+// ETags with the same value are the same
+func etagMatches(header string, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, match := range strings.Split(header, ",") {
+		match = strings.TrimSpace(match)
+		if match == "*" || strings.TrimPrefix(match, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// The newest of the times, or the zero time if there are none
+func latest(times ...time.Time) time.Time {
+	var newest time.Time
+	for _, t := range times {
+		if t.After(newest) {
+			newest = t
+		}
+	}
+	return newest
+}
@@ -0,0 +1,128 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"dbuggen/server/database"
+)
+
+// Makes a GET request with the headers and returns the response
+func getWithHeaders(t *testing.T, r *gin.Engine, path string, headers map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestConditionalGet(t *testing.T) {
+	db := database.Testdata()
+	ds := fixedDarkmode(false)
+	pages := []struct {
+		route   string
+		path    string
+		handler func(c *gin.Context)
+	}{
+		{"/", "/", Home(db, ds)},
+		{"/issue/:issue", "/issue/0", Issue(db, ds, fakeHodis(t), noViews(), renderCache(db))},
+		{"/issue/:issue/:article", "/issue/0/1", Article(db, ds, fakeHodis(t), noViews(), renderCache(db))},
+	}
+
+	for _, page := range pages {
+		path := page.path
+		t.Run(path, func(t *testing.T) {
+			r := testRouter(t, page.route, page.handler)
+
+			first := getWithHeaders(t, r, path, nil)
+			etag := first.Header().Get("ETag")
+			if first.Code != http.StatusOK || etag == "" || first.Header().Get("Last-Modified") == "" {
+				t.Fatalf("got status %v with headers %v", first.Code, first.Header())
+			}
+			if cacheControl := first.Header().Get("Cache-Control"); cacheControl != normalCacheControl {
+				t.Errorf("got Cache-Control %q, wanted %q", cacheControl, normalCacheControl)
+			}
+
+			again := getWithHeaders(t, r, path, map[string]string{"If-None-Match": etag})
+			if again.Code != http.StatusNotModified || again.Body.Len() != 0 {
+				t.Errorf("got status %v with %v bytes for the same ETag, wanted an empty 304", again.Code, again.Body.Len())
+			}
+			other := getWithHeaders(t, r, path, map[string]string{"If-None-Match": `W/"something else"`})
+			if other.Code != http.StatusOK {
+				t.Errorf("got status %v for another ETag, wanted %v", other.Code, http.StatusOK)
+			}
+
+			since := getWithHeaders(t, r, path, map[string]string{"If-Modified-Since": time.Now().UTC().Format(http.TimeFormat)})
+			if since.Code != http.StatusNotModified {
+				t.Errorf("got status %v for If-Modified-Since now, wanted %v", since.Code, http.StatusNotModified)
+			}
+			before := getWithHeaders(t, r, path, map[string]string{"If-Modified-Since": "Mon, 01 Jan 2024 00:00:00 GMT"})
+			if before.Code != http.StatusOK {
+				t.Errorf("got status %v for If-Modified-Since before it was edited, wanted %v", before.Code, http.StatusOK)
+			}
+			// the ETag wins over the date
+			both := getWithHeaders(t, r, path, map[string]string{
+				"If-None-Match":     `W/"something else"`,
+				"If-Modified-Since": time.Now().UTC().Format(http.TimeFormat),
+			})
+			if both.Code != http.StatusOK {
+				t.Errorf("got status %v for another ETag but a fresh date, wanted %v", both.Code, http.StatusOK)
+			}
+		})
+	}
+}
+
+func TestConditionalGetDarkmode(t *testing.T) {
+	db := database.Testdata()
+	ds := fixedDarkmode(false)
+	r := testRouter(t, "/issue/:issue/:article", Article(db, ds, fakeHodis(t), noViews(), renderCache(db)))
+
+	normal := getWithHeaders(t, r, "/issue/0/0", nil)
+	etag := normal.Header().Get("ETag")
+
+	// when mörkläggningen starts, what was shown before isn't good anymore
+	ds.Set(true)
+	dark := getWithHeaders(t, r, "/issue/0/0", map[string]string{"If-None-Match": etag})
+	if dark.Code != http.StatusOK || dark.Header().Get("ETag") == etag {
+		t.Errorf("got status %v and the same ETag after darkmode changed", dark.Code)
+	}
+	if cacheControl := dark.Header().Get("Cache-Control"); cacheControl != darkmodeCacheControl {
+		t.Errorf("got Cache-Control %q during mörkläggningen, wanted %q", cacheControl, darkmodeCacheControl)
+	}
+	if changed := ds.Changed(); time.Since(changed) > time.Minute {
+		t.Errorf("darkmode changed at %v, wanted just now", changed)
+	}
+}
+
+func TestConditionalGetEditors(t *testing.T) {
+	db := database.Testdata()
+	r := testRouter(t, "/issue/:issue/:article", asEditor(Article(db, fixedDarkmode(false), fakeHodis(t), noViews(), renderCache(db))))
+
+	w := getWithHeaders(t, r, "/issue/0/0", map[string]string{"If-Modified-Since": time.Now().UTC().Format(http.TimeFormat)})
+	if w.Code != http.StatusOK || w.Header().Get("ETag") != "" {
+		t.Errorf("got status %v and ETag %q, pages for editors shouldn't be cached", w.Code, w.Header().Get("ETag"))
+	}
+}
+
+func TestETagMatches(t *testing.T) {
+	etag := `W/"abc"`
+	for header, expected := range map[string]bool{
+		`W/"abc"`:        true,
+		`"abc"`:          true,
+		`"def", W/"abc"`: true,
+		`*`:              true,
+		`"def"`:          false,
+		`W/"abcd"`:       false,
+	} {
+		if got := etagMatches(header, etag); got != expected {
+			t.Errorf("%q matching %v gave %v, wanted %v", header, etag, got, expected)
+		}
+	}
+}
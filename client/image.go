@@ -0,0 +1,89 @@
+package client
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+
+	"dbuggen/server/database"
+)
+
+// An image as shown by the "image" template. Images from the media library
+// come with their smaller versions, so that browsers can pick whichever
+// fits, and with their size, so that the page doesn't jump around while
+// they load.
+type picture struct {
+	Src    string
+	Srcset string
+	// How wide the image is shown, for picking from Srcset
+	Sizes  string
+	Width  int
+	Height int
+	Alt    string
+	Class  string
+	// Loaded right away rather than once it's scrolled to, for images at
+	// the top of the page
+	Eager bool
+}
+
+// Images from the media library, by their urls
+type imageLookup map[string]database.Image
+
+// Looks up which of the urls are images in the media library. Images which
+// aren't in it are still shown, just without their sizes, so failing to
+// look them up is only logged.
+func lookupImages(db database.Store, urls ...sql.NullString) imageLookup {
+	var valid []string
+	for _, url := range urls {
+		if url.Valid {
+			valid = append(valid, url.String)
+		}
+	}
+	if len(valid) == 0 {
+		return nil
+	}
+
+	images, err := db.GetImagesByURL(valid)
+	if err != nil {
+		log.Printf("showing images without their sizes: %v", err)
+		return nil
+	}
+
+	lookup := make(imageLookup, len(images))
+	for _, image := range images {
+		lookup[image.HostedURL] = image
+	}
+	return lookup
+}
+
+// The image at url, described by alt unless it has a description of its
+// own. sizes is how wide it's shown, as in the sizes attribute.
+func (images imageLookup) picture(url string, alt string, class string, sizes string) picture {
+	p := picture{Src: url, Alt: alt, Class: class}
+
+	image, ok := images[url]
+	if !ok {
+		return p
+	}
+
+	if image.AltText.Valid {
+		p.Alt = image.AltText.String
+	}
+	if image.Width.Valid && image.Height.Valid {
+		p.Width, p.Height = int(image.Width.Int32), int(image.Height.Int32)
+	}
+
+	// the original is only a candidate if its width is known
+	if len(image.Sizes) > 0 && p.Width > 0 {
+		candidates := make([]string, 0, len(image.Sizes)+1)
+		for _, size := range image.Sizes {
+			candidates = append(candidates, fmt.Sprintf("%v %vw", size.HostedURL, size.Width))
+		}
+		candidates = append(candidates, fmt.Sprintf("%v %vw", image.HostedURL, p.Width))
+		p.Srcset = strings.Join(candidates, ", ")
+		p.Sizes = sizes
+	}
+
+	return p
+}
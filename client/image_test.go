@@ -0,0 +1,148 @@
+package client
+
+import (
+	"context"
+	"database/sql"
+	"html/template"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"dbuggen/server/database"
+	"dbuggen/server/media"
+)
+
+// An uploaded image with two smaller versions, and one from before the
+// media library
+func testImages() *database.Memory {
+	db := database.Testdata()
+	db.Externals = append(db.Externals, database.External{
+		ID:             3,
+		HostedURL:      "/media/images/abc/original.jpg",
+		TypeOfExternal: "image",
+		Width:          sql.NullInt32{Int32: 1000, Valid: true},
+		Height:         sql.NullInt32{Int32: 1414, Valid: true},
+		AltText:        sql.NullString{String: "en bäver på omslaget", Valid: true},
+	})
+	db.ExternalSizes = append(db.ExternalSizes,
+		database.ExternalSize{External: 3, Width: 200, Height: 282, HostedURL: "/media/images/abc/200.jpg"},
+		database.ExternalSize{External: 3, Width: 480, Height: 678, HostedURL: "/media/images/abc/480.jpg"},
+	)
+	return db
+}
+
+func TestPicture(t *testing.T) {
+	db := testImages()
+	images := lookupImages(db,
+		sql.NullString{String: "/media/images/abc/original.jpg", Valid: true},
+		sql.NullString{String: "https://dbuggen.s3.eu-west-1.amazonaws.com/dbuggen2/marke.png", Valid: true},
+		sql.NullString{})
+
+	got := images.picture("/media/images/abc/original.jpg", "Cover of Testdbuggen", "coverpage", "40vw")
+	expected := picture{
+		Src:    "/media/images/abc/original.jpg",
+		Srcset: "/media/images/abc/200.jpg 200w, /media/images/abc/480.jpg 480w, /media/images/abc/original.jpg 1000w",
+		Sizes:  "40vw",
+		Width:  1000,
+		Height: 1414,
+		Alt:    "en bäver på omslaget",
+		Class:  "coverpage",
+	}
+	if got != expected {
+		t.Errorf("got %+v, wanted %+v", got, expected)
+	}
+
+	// nothing is known about images from before the media library
+	got = images.picture("https://dbuggen.s3.eu-west-1.amazonaws.com/dbuggen2/marke.png", "Cover of Skojdbuggen", "coverpage", "40vw")
+	expected = picture{Src: "https://dbuggen.s3.eu-west-1.amazonaws.com/dbuggen2/marke.png", Alt: "Cover of Skojdbuggen", Class: "coverpage"}
+	if got != expected {
+		t.Errorf("got %+v, wanted %+v", got, expected)
+	}
+}
+
+func TestImageTemplate(t *testing.T) {
+	templates := template.Must(template.ParseFS(HTMLTemplates, "**/*.html"))
+
+	tests := []struct {
+		name     string
+		picture  picture
+		expected string
+	}{
+		{
+			name: "responsive",
+			picture: picture{
+				Src:    "/media/a/original.jpg",
+				Srcset: "/media/a/200.jpg 200w, /media/a/original.jpg 1000w",
+				Sizes:  "40vw",
+				Width:  1000,
+				Height: 500,
+				Alt:    `en "bild"`,
+				Class:  "coverpage",
+			},
+			expected: `<img src="/media/a/original.jpg" srcset="/media/a/200.jpg 200w, /media/a/original.jpg 1000w" sizes="40vw" width="1000" height="500" alt="en &#34;bild&#34;" class="coverpage" loading="lazy" decoding="async">`,
+		},
+		{
+			name:     "plain",
+			picture:  picture{Src: "https://example.com/a.png", Eager: true},
+			expected: `<img src="https://example.com/a.png" alt="" decoding="async">`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var b strings.Builder
+			if err := templates.ExecuteTemplate(&b, "image", tc.picture); err != nil {
+				t.Fatal(err)
+			}
+			if b.String() != tc.expected {
+				t.Errorf("got %v, wanted %v", b.String(), tc.expected)
+			}
+		})
+	}
+}
+
+// A phone photo stored sideways should get the width and height it's shown
+// with, or the browser saves the wrong space for it
+func TestImageTemplateRotated(t *testing.T) {
+	templates := template.Must(template.ParseFS(HTMLTemplates, "**/*.html"))
+
+	data, err := os.ReadFile("../server/media/testdata/orientation6.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := database.Testdata()
+	library := media.Library{Storage: media.Local{Dir: t.TempDir(), BaseURL: "/media/"}, DB: db}
+	image, err := library.Upload(context.Background(), "telefon.jpg", data, "frblo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	url := sql.NullString{String: image.HostedURL, Valid: true}
+	var b strings.Builder
+	if err := templates.ExecuteTemplate(&b, "image", lookupImages(db, url).picture(image.HostedURL, "", "", "40vw")); err != nil {
+		t.Fatal(err)
+	}
+	assertContains(t, b.String(), `width="300" height="600"`, " 200w, ", " 300w")
+}
+
+func TestResponsiveCoverpage(t *testing.T) {
+	db := testImages()
+	db.Issues[0].Coverpage = sql.NullInt32{Int32: 3, Valid: true}
+
+	r := testRouter(t, "/issue/:issue", Issue(db, fixedDarkmode(false), fakeHodis(t), noViews(), renderCache(db)))
+	code, body := get(t, r, "/issue/0")
+	if code != http.StatusOK {
+		t.Fatalf("got status %v, wanted %v", code, http.StatusOK)
+	}
+	assertContains(t, body, `srcset="/media/images/abc/200.jpg 200w, /media/images/abc/480.jpg 480w, /media/images/abc/original.jpg 1000w"`,
+		`width="1000" height="1414"`, `alt="en bäver på omslaget"`)
+	assertMissing(t, body, `loading="lazy"`)
+
+	r = testRouter(t, "/", Home(db, fixedDarkmode(false)))
+	code, body = get(t, r, "/")
+	if code != http.StatusOK {
+		t.Fatalf("got status %v, wanted %v", code, http.StatusOK)
+	}
+	assertContains(t, body, `sizes="40vw"`, `alt="Cover of Skojdbuggen"`)
+}
@@ -1,24 +1,322 @@
 package client
 
 import (
+	"bytes"
+	"fmt"
 	"html/template"
+	"io"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/gomarkdown/markdown"
+	"github.com/gomarkdown/markdown/ast"
 	"github.com/gomarkdown/markdown/html"
 	"github.com/gomarkdown/markdown/parser"
+	"github.com/microcosm-cc/bluemonday"
+
+	"dbuggen/server/database"
 )
 
-// Converts a string of markdown text into a html template
-func mdToHTML(md string) template.HTML {
-	extentions := parser.CommonExtensions | parser.AutoHeadingIDs | parser.NoEmptyLineBeforeBlock
-	p := parser.NewWithExtensions(extentions)
+// Articles are written in markdown, with a few additions of our own:
+//
+//   - Footnotes, written as "text[^1]" with "[^1]: the note" further down
+//   - Spoilers, pull quotes and callouts, which are blocks starting with a
+//     line like ":::spoiler", ":::pullquote" or ":::note" and ending with a
+//     line of only ":::". Anything after the kind is the title, or who is
+//     quoted for pull quotes. The callouts are note, tip and warning.
+//   - Images from the media library, referred to by their id as in
+//     "![alt](external:12)". These, and images from the media library
+//     linked to by their url, are shown with their smaller versions.
+//   - Math, written in TeX as "$x^2$" or "$$x^2$$", which is turned into
+//     MathML here rather than by scripts in the browser, see math.go
+//
+// Whatever html comes out is sanitized, so nothing written in an article
+// can run scripts or break the page around it. The ids of headings and
+// footnotes start with idPrefix, so that they don't clash with those of
+// other articles shown on the same page.
+func mdToHTML(db database.Store, md string, idPrefix string) template.HTML {
+	md = strings.ReplaceAll(md, "\r\n", "\n")
+
+	// definition lists are left out since they would take the ":::" lines
+	// after a paragraph as definitions
+	extensions := parser.CommonExtensions&^parser.DefinitionLists | parser.AutoHeadingIDs | parser.NoEmptyLineBeforeBlock | parser.Footnotes
+	p := parser.NewWithExtensions(extensions)
+	p.Opts.ParserHook = parseContainer
+	var inlineMath parser.InlineParser
+	inlineMath = p.RegisterInline('$', func(p *parser.Parser, data []byte, offset int) (int, ast.Node) {
+		if n, node := parseDisplayMath(data[offset:]); node != nil {
+			return n, node
+		}
+		return inlineMath(p, data, offset)
+	})
 	doc := p.Parse([]byte(md))
 
-	htmlFlags := html.CommonFlags | html.HrefTargetBlank
-	opts := html.RendererOptions{Flags: htmlFlags}
-	renderer := html.NewRenderer(opts)
+	opts := html.RendererOptions{
+		Flags:                html.CommonFlags | html.FootnoteReturnLinks,
+		FootnoteAnchorPrefix: idPrefix,
+		HeadingIDPrefix:      idPrefix,
+		RenderNodeHook:       renderHook(articleImages(db, doc)),
+	}
+	rendered := markdown.Render(doc, html.NewRenderer(opts))
+
+	return template.HTML(articlePolicy.SanitizeBytes(rendered))
+}
+
+// The kinds of blocks started by ":::", with their default titles
+var containerTitles = map[string]string{
+	"spoiler":   "Spoiler",
+	"pullquote": "",
+	"note":      "Note",
+	"tip":       "Tip",
+	"warning":   "Warning",
+}
+
+// A spoiler, pull quote or callout
+type container struct {
+	ast.Container
+
+	Kind  string
+	Title string
+}
+
+// Parses a block starting with ":::kind title" and ending with ":::", which
+// may have other such blocks inside of it. Anything else, including blocks
+// which are never ended, is left to the markdown parser.
+func parseContainer(data []byte) (ast.Node, []byte, int) {
+	first, _, _ := bytes.Cut(data, []byte("\n"))
+	if !bytes.HasPrefix(first, []byte(":::")) {
+		return nil, nil, 0
+	}
+
+	kind, title, _ := strings.Cut(strings.TrimSpace(string(first[3:])), " ")
+	defaultTitle, ok := containerTitles[kind]
+	if !ok {
+		return nil, nil, 0
+	}
+	if title = strings.TrimSpace(title); title == "" {
+		title = defaultTitle
+	}
+
+	start := min(len(first)+1, len(data))
+	depth := 1
+	for offset := start; offset < len(data); {
+		line, _, _ := bytes.Cut(data[offset:], []byte("\n"))
+		end := min(offset+len(line)+1, len(data))
+
+		trimmed := bytes.TrimSpace(line)
+		if bytes.Equal(trimmed, []byte(":::")) {
+			depth--
+			if depth == 0 {
+				return &container{Kind: kind, Title: title}, data[start:offset], end
+			}
+		} else if bytes.HasPrefix(trimmed, []byte(":::")) {
+			depth++
+		}
+		offset = end
+	}
+
+	return nil, nil, 0
+}
+
+// Math written as "$$x$$" within a paragraph, rather than on lines of its
+// own, which is still meant to be a formula of its own
+func parseDisplayMath(data []byte) (int, ast.Node) {
+	if !bytes.HasPrefix(data, []byte("$$")) {
+		return 0, nil
+	}
+	end := bytes.Index(data[2:], []byte("$$"))
+	if end <= 0 {
+		return 0, nil
+	}
+
+	math := &ast.MathBlock{}
+	math.Literal = data[2 : 2+end]
+	return end + 4, math
+}
+
+// Looks up the images from the media library used in an article, by the
+// destinations they are given as. Images which can't be looked up are
+// shown as they are written, so failing is only logged.
+func articleImages(db database.Store, doc ast.Node) map[string]picture {
+	var urls []string
+	ids := map[string]int{}
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		if image, ok := node.(*ast.Image); ok && entering {
+			destination := string(image.Destination)
+			if id, ok := externalID(destination); ok {
+				ids[destination] = id
+			} else {
+				urls = append(urls, destination)
+			}
+		}
+		return ast.GoToNext
+	})
+
+	pictures := map[string]picture{}
+	if len(urls) > 0 {
+		images, err := db.GetImagesByURL(urls)
+		if err != nil {
+			log.Printf("showing the images of an article without their sizes: %v", err)
+		}
+		for _, image := range images {
+			pictures[image.HostedURL] = articlePicture(image)
+		}
+	}
+
+	for destination, id := range ids {
+		image, err := db.GetImage(id)
+		if err != nil {
+			log.Printf("could not find image %v used in an article: %v", id, err)
+			continue
+		}
+		pictures[destination] = articlePicture(image)
+	}
 
-	html := markdown.Render(doc, renderer)
+	return pictures
+}
+
+// Images in articles are as wide as the article, which is most of the
+// screen
+func articlePicture(image database.Image) picture {
+	return imageLookup{image.HostedURL: image}.picture(image.HostedURL, "", "articleImage", "100vw")
+}
 
-	return template.HTML(html)
+// The id in an image reference like "external:12"
+func externalID(destination string) (int, bool) {
+	id, found := strings.CutPrefix(destination, "external:")
+	if !found {
+		return 0, false
+	}
+	n, err := strconv.Atoi(id)
+	return n, err == nil && n >= 0
 }
+
+var imageTemplate = template.Must(template.ParseFS(HTMLTemplates, "html/image.html"))
+
+// Renders what the markdown renderer doesn't know about, which are the
+// spoilers, pull quotes and callouts, the images from the media library
+// and the math.
+func renderHook(pictures map[string]picture) html.RenderNodeFunc {
+	return func(w io.Writer, node ast.Node, entering bool) (ast.WalkStatus, bool) {
+		switch node := node.(type) {
+		case *container:
+			renderContainer(w, node, entering)
+			return ast.GoToNext, true
+
+		case *ast.Math:
+			io.WriteString(w, texToMathML(string(node.Literal), false))
+			return ast.GoToNext, true
+
+		case *ast.MathBlock:
+			if entering {
+				io.WriteString(w, texToMathML(string(node.Literal), true))
+				io.WriteString(w, "\n")
+			}
+			return ast.GoToNext, true
+
+		case *ast.Image:
+			destination := string(node.Destination)
+			p, ok := pictures[destination]
+			_, isExternal := externalID(destination)
+			if !ok && !isExternal {
+				return ast.GoToNext, false
+			}
+			if !entering {
+				return ast.GoToNext, true
+			}
+
+			alt := altText(node)
+			if !ok {
+				// an image which doesn't exist, all that can be shown is
+				// what it was supposed to be
+				template.HTMLEscape(w, []byte(alt))
+				return ast.SkipChildren, true
+			}
+
+			if alt != "" {
+				p.Alt = alt
+			}
+			if err := imageTemplate.ExecuteTemplate(w, "image", p); err != nil {
+				log.Println(err)
+			}
+			return ast.SkipChildren, true
+		}
+
+		return ast.GoToNext, false
+	}
+}
+
+func renderContainer(w io.Writer, c *container, entering bool) {
+	title := template.HTMLEscapeString(c.Title)
+
+	switch c.Kind {
+	case "spoiler":
+		if entering {
+			fmt.Fprintf(w, "<details class=\"spoiler\"><summary>%v</summary>\n", title)
+		} else {
+			io.WriteString(w, "</details>\n")
+		}
+	case "pullquote":
+		if entering {
+			io.WriteString(w, "<figure class=\"pullquote\"><blockquote>\n")
+		} else if title != "" {
+			fmt.Fprintf(w, "</blockquote><figcaption>%v</figcaption></figure>\n", title)
+		} else {
+			io.WriteString(w, "</blockquote></figure>\n")
+		}
+	default:
+		if entering {
+			fmt.Fprintf(w, "<div class=\"callout callout-%v\"><p class=\"callout-title\">%v</p>\n", c.Kind, title)
+		} else {
+			io.WriteString(w, "</div>\n")
+		}
+	}
+}
+
+// The text of an image's alt, which markdown allows some formatting in
+func altText(image *ast.Image) string {
+	var alt strings.Builder
+	ast.WalkFunc(image, func(node ast.Node, entering bool) ast.WalkStatus {
+		if leaf := node.AsLeaf(); leaf != nil && entering {
+			alt.Write(leaf.Literal)
+		}
+		return ast.GoToNext
+	})
+	return alt.String()
+}
+
+// What's allowed in the html of an article. On top of what's safe in any
+// user generated content, this is the markup of the additions above, the
+// footnotes and the math.
+var articlePolicy = func() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AddTargetBlankToFullyQualifiedLinks(true)
+
+	p.AllowElements("details", "summary", "figure", "figcaption")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^(spoiler|pullquote|callout callout-(note|tip|warning)|callout-title|footnotes)$`)).
+		OnElements("details", "figure", "div", "p", "span")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^footnote-(ref|return)$`)).OnElements("sup", "a")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w+#-]+$`)).OnElements("code")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^articleImage$`)).OnElements("img")
+	p.AllowAttrs("srcset", "sizes").OnElements("img")
+	p.AllowAttrs("loading").Matching(regexp.MustCompile(`^(lazy|eager)$`)).OnElements("img")
+	p.AllowAttrs("decoding").Matching(regexp.MustCompile(`^(async|sync|auto)$`)).OnElements("img")
+
+	p.AllowNoAttrs().OnElements("math", "semantics", "annotation", "mrow", "mi", "mn", "mo", "mtext", "mspace",
+		"msub", "msup", "msubsup", "munder", "mover", "munderover", "mfrac", "msqrt", "mroot",
+		"mstyle", "mtable", "mtr", "mtd", "merror")
+	p.AllowAttrs("display").Matching(regexp.MustCompile(`^block$`)).OnElements("math")
+	p.AllowAttrs("encoding").Matching(regexp.MustCompile(`^application/x-tex$`)).OnElements("annotation")
+	p.AllowAttrs("mathvariant").Matching(regexp.MustCompile(`^normal$`)).OnElements("mi")
+	p.AllowAttrs("stretchy", "fence").Matching(regexp.MustCompile(`^(true|false)$`)).OnElements("mo")
+	p.AllowAttrs("width").Matching(regexp.MustCompile(`^-?[0-9.]+em$`)).OnElements("mspace")
+	p.AllowAttrs("linethickness").Matching(regexp.MustCompile(`^0$`)).OnElements("mfrac")
+	p.AllowAttrs("displaystyle").Matching(regexp.MustCompile(`^(true|false)$`)).OnElements("mstyle")
+	p.AllowAttrs("accent").Matching(regexp.MustCompile(`^true$`)).OnElements("mover")
+	p.AllowAttrs("accentunder").Matching(regexp.MustCompile(`^true$`)).OnElements("munder")
+	p.AllowAttrs("columnalign").Matching(regexp.MustCompile(`^(left|right)$`)).OnElements("mtd")
+
+	return p
+}()
@@ -0,0 +1,73 @@
+package client
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"dbuggen/server/database"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// Renders every markdown file in testdata/markdown and compares it with the
+// html file of the same name. Run with -update to write the html files
+// after changing how markdown is rendered, and check what changed.
+func TestMarkdownGolden(t *testing.T) {
+	files, err := filepath.Glob("testdata/markdown/*.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no golden files")
+	}
+
+	db := testImages()
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".md")
+		t.Run(name, func(t *testing.T) {
+			md, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := string(mdToHTML(db, string(md), ""))
+			golden := strings.TrimSuffix(file, ".md") + ".html"
+			if *update {
+				if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			expected, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(expected) {
+				t.Errorf("rendering %v gave\n%v\nwanted\n%v", file, got, expected)
+			}
+		})
+	}
+}
+
+func TestMarkdownWindowsNewlines(t *testing.T) {
+	got := mdToHTML(testImages(), ":::note\r\nhej\r\n:::\r\n", "")
+	expected := mdToHTML(testImages(), ":::note\nhej\n:::\n", "")
+	if got != expected {
+		t.Errorf("got %v, wanted %v", got, expected)
+	}
+}
+
+func TestMarkdownIDPrefix(t *testing.T) {
+	md := "# Rubrik\n\nText[^1]\n\n[^1]: En fotnot\n"
+	rendered := renderCache(testImages())
+
+	// both on the same issue page
+	first := string(rendered.Article(database.Article{ID: 1, Content: md}))
+	second := string(rendered.Article(database.Article{ID: 2, Content: md}))
+
+	assertContains(t, first, `id="article-1-rubrik"`, `id="fnref:article-1-1"`, `href="#fn:article-1-1"`, `id="fn:article-1-1"`, `href="#fnref:article-1-1"`)
+	assertContains(t, second, `id="article-2-rubrik"`, `id="fnref:article-2-1"`, `href="#fn:article-2-1"`)
+}
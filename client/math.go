@@ -0,0 +1,651 @@
+package client
+
+import (
+	"html/template"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Math in articles is written in TeX, between single dollar signs inline or
+// double ones for a formula of its own. It's turned into MathML when the
+// article is rendered, which browsers show by themselves.
+//
+// Only the part of TeX used for writing formulas is known, which is
+// letters, numbers and operators, sub- and superscripts, fractions, roots,
+// greek letters and the usual symbols, \left and \right, accents, text,
+// fonts like \mathbb and matrices. Anything else is shown as an error in
+// the formula, so the rest of it can still be read.
+func texToMathML(tex string, display bool) string {
+	p := texParser{src: tex, display: display}
+	body := mrow(p.expression())
+
+	var b strings.Builder
+	if display {
+		b.WriteString(`<math display="block">`)
+	} else {
+		b.WriteString(`<math>`)
+	}
+	// the source is kept, so it can be copied and read by screen readers
+	// which don't know MathML
+	b.WriteString("<semantics>")
+	b.WriteString(body)
+	b.WriteString(`<annotation encoding="application/x-tex">`)
+	b.WriteString(template.HTMLEscapeString(tex))
+	b.WriteString("</annotation></semantics></math>")
+	return b.String()
+}
+
+type texParser struct {
+	src     string
+	pos     int
+	display bool
+}
+
+// The next token without moving past it, which is a command like "\frac"
+// or "\{", a single character, or "" at the end
+func (p *texParser) peek() string {
+	for p.pos < len(p.src) && isSpace(p.src[p.pos]) {
+		p.pos++
+	}
+	if p.pos >= len(p.src) {
+		return ""
+	}
+
+	rest := p.src[p.pos:]
+	if rest[0] != '\\' {
+		_, size := utf8.DecodeRuneInString(rest)
+		return rest[:size]
+	}
+
+	end := 1
+	for end < len(rest) && isLetter(rest[end]) {
+		end++
+	}
+	if end == 1 && len(rest) > 1 {
+		_, size := utf8.DecodeRuneInString(rest[1:])
+		end += size
+	}
+	return rest[:end]
+}
+
+func (p *texParser) next() string {
+	token := p.peek()
+	p.pos += len(token)
+	return token
+}
+
+// Everything up to one of the tokens in stop, which is left for the
+// caller, or to the end
+func (p *texParser) expression(stop ...string) []string {
+	var nodes []string
+	for {
+		token := p.peek()
+		if token == "" {
+			return nodes
+		}
+		for _, s := range stop {
+			if token == s {
+				return nodes
+			}
+		}
+
+		if node := p.scripted(); node != "" {
+			nodes = append(nodes, node)
+		}
+	}
+}
+
+// An atom with the sub- and superscripts after it
+func (p *texParser) scripted() string {
+	a := p.atom()
+
+	var sub, sup string
+	hasSub, hasSup := false, false
+	for {
+		switch p.peek() {
+		case "\\limits":
+			p.next()
+			a.limits = true
+			continue
+		case "\\nolimits":
+			p.next()
+			a.limits = false
+			continue
+		case "_":
+			if hasSub {
+				break
+			}
+			p.next()
+			sub, hasSub = p.argument(), true
+			continue
+		case "^":
+			if hasSup {
+				break
+			}
+			p.next()
+			sup, hasSup = p.argument(), true
+			continue
+		}
+		break
+	}
+
+	node := a.node
+	if hasSub || hasSup {
+		// a base which is nothing, as in "{}^{14}C", still needs to be there
+		if node == "" {
+			node = "<mrow></mrow>"
+		}
+
+		under, over, both := "msub", "msup", "msubsup"
+		if a.limits && p.display {
+			under, over, both = "munder", "mover", "munderover"
+		}
+		switch {
+		case hasSub && hasSup:
+			node = "<" + both + ">" + node + sub + sup + "</" + both + ">"
+		case hasSub:
+			node = "<" + under + ">" + node + sub + "</" + under + ">"
+		default:
+			node = "<" + over + ">" + node + sup + "</" + over + ">"
+		}
+	}
+
+	if a.function {
+		// the invisible function application, which tells a reader that
+		// "sin x" is sin applied to x
+		node += "<mo>\u2061</mo>"
+	}
+	return node
+}
+
+// The argument of a command or script, which is either a group in braces
+// or a single atom
+func (p *texParser) argument() string {
+	if p.peek() == "{" {
+		p.next()
+		return p.group()
+	}
+	if token := p.peek(); token == "" || token == "}" {
+		return "<mrow></mrow>"
+	}
+	return p.atom().node
+}
+
+// The rest of a group in braces, after the "{"
+func (p *texParser) group() string {
+	nodes := p.expression("}")
+	p.next()
+	return "<mrow>" + strings.Join(nodes, "") + "</mrow>"
+}
+
+// The text of an argument in braces, as it's written, for commands like
+// \text where spaces count
+func (p *texParser) rawArgument() string {
+	if p.peek() != "{" {
+		return p.next()
+	}
+	p.next()
+
+	start, depth := p.pos, 1
+	for ; p.pos < len(p.src); p.pos++ {
+		switch p.src[p.pos] {
+		case '\\':
+			p.pos = min(p.pos+1, len(p.src))
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				text := p.src[start:p.pos]
+				p.pos++
+				return text
+			}
+		}
+	}
+	// never closed, where a backslash at the end has skipped past it
+	p.pos = len(p.src)
+	return p.src[start:]
+}
+
+// An optional argument in brackets, as in \sqrt[3]{x}
+func (p *texParser) optionalArgument() (string, bool) {
+	if p.peek() != "[" {
+		return "", false
+	}
+	p.next()
+	nodes := p.expression("]")
+	p.next()
+	return mrow(nodes), true
+}
+
+type texAtom struct {
+	node string
+	// whether sub- and superscripts go below and above it in display math,
+	// like for \sum, rather than after it
+	limits bool
+	// whether it's a function name like \sin
+	function bool
+}
+
+func (p *texParser) atom() texAtom {
+	token := p.next()
+
+	switch {
+	case token == "":
+		// the end, where something like \not wanted more
+		return texAtom{}
+	case token == "{":
+		return texAtom{node: p.group()}
+	case token == "}":
+		return texAtom{node: texError("}")}
+	case token == "&" || token == "\\\\":
+		// only mean something in matrices, and line breaks are up to the
+		// browser
+		return texAtom{}
+	case token == "~" || token == "\\ ":
+		return texAtom{node: `<mspace width="0.3333em"></mspace>`}
+	case token == "'":
+		return texAtom{node: "<mo>′</mo>"}
+	case strings.HasPrefix(token, "\\"):
+		return p.command(token)
+	case isDigit(token[0]):
+		return texAtom{node: "<mn>" + p.number(token) + "</mn>"}
+	}
+
+	r, _ := utf8.DecodeRuneInString(token)
+	if unicode.IsLetter(r) {
+		return texAtom{node: "<mi>" + template.HTMLEscapeString(token) + "</mi>"}
+	}
+	if token == "-" {
+		token = "−"
+	} else if token == "*" {
+		token = "∗"
+	}
+	return texAtom{node: mo(token)}
+}
+
+// The rest of a number which started with first, like 3.14
+func (p *texParser) number(first string) string {
+	start, point := p.pos-len(first), false
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if c == '.' && !point && p.pos+1 < len(p.src) && isDigit(p.src[p.pos+1]) {
+			point = true
+		} else if !isDigit(c) {
+			break
+		}
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+func (p *texParser) command(name string) texAtom {
+	if symbol, ok := texSymbols[name[1:]]; ok {
+		return symbol.atom()
+	}
+	if limits, ok := texFunctions[name[1:]]; ok {
+		return texAtom{node: "<mi>" + name[1:] + "</mi>", limits: limits, function: true}
+	}
+	if width, ok := texSpaces[name[1:]]; ok {
+		return texAtom{node: `<mspace width="` + width + `"></mspace>`}
+	}
+	if accent, ok := texAccents[name[1:]]; ok {
+		return texAtom{node: accent.node(p.argument())}
+	}
+	if alphabet, ok := texAlphabets[name[1:]]; ok {
+		return texAtom{node: "<mi>" + template.HTMLEscapeString(alphabet.transform(p.rawArgument())) + "</mi>"}
+	}
+
+	switch name {
+	case "\\frac", "\\cfrac":
+		return texAtom{node: "<mfrac>" + p.argument() + p.argument() + "</mfrac>"}
+	case "\\dfrac":
+		return texAtom{node: `<mstyle displaystyle="true"><mfrac>` + p.argument() + p.argument() + "</mfrac></mstyle>"}
+	case "\\tfrac":
+		return texAtom{node: `<mstyle displaystyle="false"><mfrac>` + p.argument() + p.argument() + "</mfrac></mstyle>"}
+	case "\\binom":
+		return texAtom{node: `<mrow><mo>(</mo><mfrac linethickness="0">` + p.argument() + p.argument() + "</mfrac><mo>)</mo></mrow>"}
+
+	case "\\sqrt":
+		if index, ok := p.optionalArgument(); ok {
+			return texAtom{node: "<mroot>" + p.argument() + index + "</mroot>"}
+		}
+		return texAtom{node: "<msqrt>" + p.argument() + "</msqrt>"}
+
+	case "\\left":
+		open := p.delimiter()
+		nodes := p.expression("\\right")
+		p.next()
+		close := p.delimiter()
+		return texAtom{node: "<mrow>" + open + strings.Join(nodes, "") + close + "</mrow>"}
+
+	case "\\text", "\\textrm", "\\textit", "\\textbf", "\\mbox":
+		return texAtom{node: "<mtext>" + template.HTMLEscapeString(p.rawArgument()) + "</mtext>"}
+
+	case "\\operatorname":
+		return texAtom{node: upright(p.rawArgument()), function: true}
+	case "\\mathrm":
+		return texAtom{node: upright(p.rawArgument())}
+
+	case "\\not":
+		// a line through the next symbol, as in \not\equiv
+		a := p.atom()
+		if inner, ok := strings.CutPrefix(a.node, "<mo>"); ok {
+			a.node = "<mo>" + strings.TrimSuffix(inner, "</mo>") + "\u0338</mo>"
+		}
+		return a
+
+	case "\\begin":
+		return texAtom{node: p.environment(p.rawArgument())}
+
+	case "\\displaystyle", "\\textstyle":
+		return texAtom{}
+	}
+
+	return texAtom{node: texError(name)}
+}
+
+// The delimiter after \left or \right, where "." means none
+func (p *texParser) delimiter() string {
+	token := p.next()
+	if token == "." || token == "" {
+		return ""
+	}
+	if symbol, ok := texSymbols[strings.TrimPrefix(token, "\\")]; ok && strings.HasPrefix(token, "\\") {
+		token = symbol.text
+	}
+	return `<mo fence="true" stretchy="true">` + template.HTMLEscapeString(token) + "</mo>"
+}
+
+// The matrices and cases between \begin{name} and \end{name}, which are
+// cells split by "&" in rows split by "\\"
+func (p *texParser) environment(name string) string {
+	if name == "array" {
+		// which way the columns are aligned is up to the browser
+		p.rawArgument()
+	}
+
+	var rows [][]string
+	row := []string{}
+	for {
+		row = append(row, mrow(p.expression("&", "\\\\", "\\end")))
+		token := p.next()
+		if token == "&" {
+			continue
+		}
+		rows = append(rows, row)
+		row = []string{}
+		if token == "\\end" {
+			p.rawArgument()
+			break
+		}
+		if token == "" {
+			break
+		}
+	}
+	// a "\\" at the end of the last row doesn't start another one
+	if last := rows[len(rows)-1]; len(rows) > 1 && len(last) == 1 && last[0] == "<mrow></mrow>" {
+		rows = rows[:len(rows)-1]
+	}
+
+	var align func(column int) string
+	switch name {
+	case "cases":
+		align = func(int) string { return "left" }
+	case "aligned", "align", "align*", "split":
+		align = func(column int) string { return []string{"right", "left"}[column%2] }
+	}
+
+	var b strings.Builder
+	b.WriteString("<mtable>")
+	for _, row := range rows {
+		b.WriteString("<mtr>")
+		for i, cell := range row {
+			if align != nil {
+				b.WriteString(`<mtd columnalign="` + align(i) + `">`)
+			} else {
+				b.WriteString("<mtd>")
+			}
+			b.WriteString(cell)
+			b.WriteString("</mtd>")
+		}
+		b.WriteString("</mtr>")
+	}
+	b.WriteString("</mtable>")
+
+	open, close := texMatrixDelimiters[name][0], texMatrixDelimiters[name][1]
+	if open == "" && close == "" {
+		return b.String()
+	}
+	fence := func(delimiter string) string {
+		if delimiter == "" {
+			return ""
+		}
+		return `<mo fence="true" stretchy="true">` + delimiter + "</mo>"
+	}
+	return "<mrow>" + fence(open) + b.String() + fence(close) + "</mrow>"
+}
+
+var texMatrixDelimiters = map[string][2]string{
+	"pmatrix": {"(", ")"},
+	"bmatrix": {"[", "]"},
+	"Bmatrix": {"{", "}"},
+	"vmatrix": {"|", "|"},
+	"Vmatrix": {"‖", "‖"},
+	"cases":   {"{", ""},
+}
+
+// Several nodes as one, for where MathML wants a single one
+func mrow(nodes []string) string {
+	if len(nodes) == 1 {
+		return nodes[0]
+	}
+	return "<mrow>" + strings.Join(nodes, "") + "</mrow>"
+}
+
+// An operator, where the brackets which TeX leaves as they are have to be
+// told not to grow with what's between them
+func mo(text string) string {
+	switch text {
+	case "(", ")", "[", "]", "{", "}", "|", "‖", "⟨", "⟩", "⌊", "⌋", "⌈", "⌉":
+		return `<mo stretchy="false">` + text + "</mo>"
+	}
+	return "<mo>" + template.HTMLEscapeString(text) + "</mo>"
+}
+
+// Single letters are shown in italics unless told not to be
+func upright(text string) string {
+	if utf8.RuneCountInString(text) == 1 {
+		return `<mi mathvariant="normal">` + template.HTMLEscapeString(text) + "</mi>"
+	}
+	return "<mi>" + template.HTMLEscapeString(text) + "</mi>"
+}
+
+func texError(source string) string {
+	return "<merror><mtext>" + template.HTMLEscapeString(source) + "</mtext></merror>"
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+func isLetter(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+type texSymbolKind int
+
+const (
+	identifier texSymbolKind = iota
+	// identifiers which aren't in italics even though they're a single
+	// letter, like the capital greek ones
+	uprightIdentifier
+	operator
+	// operators like \sum, which have their sub- and superscripts below
+	// and above them in display math
+	limitsOperator
+)
+
+type texSymbol struct {
+	kind texSymbolKind
+	text string
+}
+
+func (s texSymbol) atom() texAtom {
+	switch s.kind {
+	case uprightIdentifier:
+		return texAtom{node: upright(s.text)}
+	case operator:
+		return texAtom{node: mo(s.text)}
+	case limitsOperator:
+		return texAtom{node: mo(s.text), limits: true}
+	}
+	return texAtom{node: "<mi>" + template.HTMLEscapeString(s.text) + "</mi>"}
+}
+
+var texSymbols = map[string]texSymbol{
+	"alpha": {identifier, "α"}, "beta": {identifier, "β"}, "gamma": {identifier, "γ"},
+	"delta": {identifier, "δ"}, "epsilon": {identifier, "ϵ"}, "varepsilon": {identifier, "ε"},
+	"zeta": {identifier, "ζ"}, "eta": {identifier, "η"}, "theta": {identifier, "θ"},
+	"vartheta": {identifier, "ϑ"}, "iota": {identifier, "ι"}, "kappa": {identifier, "κ"},
+	"lambda": {identifier, "λ"}, "mu": {identifier, "μ"}, "nu": {identifier, "ν"},
+	"xi": {identifier, "ξ"}, "omicron": {identifier, "ο"}, "pi": {identifier, "π"},
+	"varpi": {identifier, "ϖ"}, "rho": {identifier, "ρ"}, "varrho": {identifier, "ϱ"},
+	"sigma": {identifier, "σ"}, "varsigma": {identifier, "ς"}, "tau": {identifier, "τ"},
+	"upsilon": {identifier, "υ"}, "phi": {identifier, "ϕ"}, "varphi": {identifier, "φ"},
+	"chi": {identifier, "χ"}, "psi": {identifier, "ψ"}, "omega": {identifier, "ω"},
+
+	"Gamma": {uprightIdentifier, "Γ"}, "Delta": {uprightIdentifier, "Δ"}, "Theta": {uprightIdentifier, "Θ"},
+	"Lambda": {uprightIdentifier, "Λ"}, "Xi": {uprightIdentifier, "Ξ"}, "Pi": {uprightIdentifier, "Π"},
+	"Sigma": {uprightIdentifier, "Σ"}, "Upsilon": {uprightIdentifier, "Υ"}, "Phi": {uprightIdentifier, "Φ"},
+	"Psi": {uprightIdentifier, "Ψ"}, "Omega": {uprightIdentifier, "Ω"},
+
+	"infty": {identifier, "∞"}, "partial": {identifier, "∂"}, "nabla": {uprightIdentifier, "∇"},
+	"hbar": {identifier, "ℏ"}, "ell": {identifier, "ℓ"}, "Re": {identifier, "ℜ"},
+	"Im": {identifier, "ℑ"}, "aleph": {identifier, "ℵ"}, "imath": {identifier, "ı"},
+	"jmath": {identifier, "ȷ"}, "wp": {identifier, "℘"}, "emptyset": {uprightIdentifier, "∅"},
+	"varnothing": {uprightIdentifier, "∅"}, "top": {uprightIdentifier, "⊤"}, "bot": {uprightIdentifier, "⊥"},
+	"angle": {uprightIdentifier, "∠"}, "triangle": {uprightIdentifier, "△"},
+	"%": {uprightIdentifier, "%"}, "$": {uprightIdentifier, "$"}, "#": {uprightIdentifier, "#"},
+	"&": {uprightIdentifier, "&"}, "_": {uprightIdentifier, "_"},
+
+	"sum": {limitsOperator, "∑"}, "prod": {limitsOperator, "∏"}, "coprod": {limitsOperator, "∐"},
+	"bigcup": {limitsOperator, "⋃"}, "bigcap": {limitsOperator, "⋂"}, "bigoplus": {limitsOperator, "⨁"},
+	"bigotimes": {limitsOperator, "⨂"}, "bigvee": {limitsOperator, "⋁"}, "bigwedge": {limitsOperator, "⋀"},
+	"int": {operator, "∫"}, "iint": {operator, "∬"}, "iiint": {operator, "∭"}, "oint": {operator, "∮"},
+
+	"pm": {operator, "±"}, "mp": {operator, "∓"}, "times": {operator, "×"}, "div": {operator, "÷"},
+	"cdot": {operator, "⋅"}, "ast": {operator, "∗"}, "star": {operator, "⋆"}, "circ": {operator, "∘"},
+	"bullet": {operator, "∙"}, "oplus": {operator, "⊕"}, "otimes": {operator, "⊗"},
+	"cup": {operator, "∪"}, "cap": {operator, "∩"}, "setminus": {operator, "∖"},
+	"land": {operator, "∧"}, "wedge": {operator, "∧"}, "lor": {operator, "∨"}, "vee": {operator, "∨"},
+	"neg": {operator, "¬"}, "lnot": {operator, "¬"}, "forall": {operator, "∀"},
+	"exists": {operator, "∃"}, "nexists": {operator, "∄"},
+
+	"leq": {operator, "≤"}, "le": {operator, "≤"}, "geq": {operator, "≥"}, "ge": {operator, "≥"},
+	"neq": {operator, "≠"}, "ne": {operator, "≠"}, "ll": {operator, "≪"}, "gg": {operator, "≫"},
+	"approx": {operator, "≈"}, "sim": {operator, "∼"}, "simeq": {operator, "≃"}, "cong": {operator, "≅"},
+	"equiv": {operator, "≡"}, "propto": {operator, "∝"}, "in": {operator, "∈"}, "notin": {operator, "∉"},
+	"ni": {operator, "∋"}, "subset": {operator, "⊂"}, "subseteq": {operator, "⊆"},
+	"supset": {operator, "⊃"}, "supseteq": {operator, "⊇"}, "perp": {operator, "⊥"},
+	"parallel": {operator, "∥"}, "mid": {operator, "∣"}, "models": {operator, "⊨"},
+	"vdash": {operator, "⊢"}, "colon": {operator, ":"},
+
+	"to": {operator, "→"}, "rightarrow": {operator, "→"}, "gets": {operator, "←"},
+	"leftarrow": {operator, "←"}, "leftrightarrow": {operator, "↔"}, "Rightarrow": {operator, "⇒"},
+	"Leftarrow": {operator, "⇐"}, "Leftrightarrow": {operator, "⇔"}, "implies": {operator, "⟹"},
+	"impliedby": {operator, "⟸"}, "iff": {operator, "⟺"}, "mapsto": {operator, "↦"},
+	"longrightarrow": {operator, "⟶"}, "longleftarrow": {operator, "⟵"},
+	"uparrow": {operator, "↑"}, "downarrow": {operator, "↓"},
+
+	"ldots": {operator, "…"}, "dots": {operator, "…"}, "cdots": {operator, "⋯"},
+	"vdots": {operator, "⋮"}, "ddots": {operator, "⋱"}, "prime": {operator, "′"},
+
+	"{": {operator, "{"}, "}": {operator, "}"}, "|": {operator, "‖"},
+	"langle": {operator, "⟨"}, "rangle": {operator, "⟩"}, "lfloor": {operator, "⌊"},
+	"rfloor": {operator, "⌋"}, "lceil": {operator, "⌈"}, "rceil": {operator, "⌉"},
+	"vert": {operator, "|"}, "lvert": {operator, "|"}, "rvert": {operator, "|"},
+	"Vert": {operator, "‖"}, "lVert": {operator, "‖"}, "rVert": {operator, "‖"},
+	"backslash": {operator, "\\"},
+}
+
+// Function names which are written upright, and whether they take their
+// sub- and superscripts below them in display math
+var texFunctions = map[string]bool{
+	"sin": false, "cos": false, "tan": false, "cot": false, "sec": false, "csc": false,
+	"arcsin": false, "arccos": false, "arctan": false, "sinh": false, "cosh": false, "tanh": false,
+	"log": false, "ln": false, "lg": false, "exp": false, "dim": false, "deg": false,
+	"ker": false, "hom": false, "arg": false,
+	"lim": true, "liminf": true, "limsup": true, "max": true, "min": true, "sup": true,
+	"inf": true, "det": true, "gcd": true, "Pr": true,
+}
+
+var texSpaces = map[string]string{
+	",": "0.1667em", ":": "0.2222em", ">": "0.2222em", ";": "0.2778em",
+	"!": "-0.1667em", "quad": "1em", "qquad": "2em",
+}
+
+type texAccent struct {
+	mark  string
+	under bool
+}
+
+func (a texAccent) node(base string) string {
+	if a.under {
+		return `<munder accentunder="true">` + base + `<mo stretchy="true">` + a.mark + "</mo></munder>"
+	}
+	return `<mover accent="true">` + base + "<mo>" + a.mark + "</mo></mover>"
+}
+
+var texAccents = map[string]texAccent{
+	"hat": {"^", false}, "widehat": {"^", false}, "bar": {"¯", false}, "overline": {"‾", false},
+	"vec": {"→", false}, "dot": {"˙", false}, "ddot": {"¨", false}, "tilde": {"˜", false},
+	"widetilde": {"˜", false}, "underline": {"‾", true},
+}
+
+// The letters of a font like \mathbb, which are their own characters in
+// unicode. Most of them come in order from first, but some were in unicode
+// before the rest and are somewhere else.
+type texAlphabet struct {
+	upper, lower, digits rune
+	exceptions           map[rune]rune
+}
+
+func (a texAlphabet) transform(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		if e, ok := a.exceptions[r]; ok {
+			r = e
+		} else if 'A' <= r && r <= 'Z' && a.upper != 0 {
+			r = a.upper + r - 'A'
+		} else if 'a' <= r && r <= 'z' && a.lower != 0 {
+			r = a.lower + r - 'a'
+		} else if '0' <= r && r <= '9' && a.digits != 0 {
+			r = a.digits + r - '0'
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+var texAlphabets = map[string]texAlphabet{
+	"mathbb": {upper: 0x1D538, lower: 0x1D552, digits: 0x1D7D8, exceptions: map[rune]rune{
+		'C': 'ℂ', 'H': 'ℍ', 'N': 'ℕ', 'P': 'ℙ', 'Q': 'ℚ', 'R': 'ℝ', 'Z': 'ℤ',
+	}},
+	"mathcal": {upper: 0x1D49C, exceptions: map[rune]rune{
+		'B': 'ℬ', 'E': 'ℰ', 'F': 'ℱ', 'H': 'ℋ', 'I': 'ℐ', 'L': 'ℒ', 'M': 'ℳ', 'R': 'ℛ',
+	}},
+	"mathfrak": {upper: 0x1D504, lower: 0x1D51E, exceptions: map[rune]rune{
+		'C': 'ℭ', 'H': 'ℌ', 'I': 'ℑ', 'R': 'ℜ', 'Z': 'ℨ',
+	}},
+	"mathbf":     {upper: 0x1D400, lower: 0x1D41A, digits: 0x1D7CE},
+	"boldsymbol": {upper: 0x1D400, lower: 0x1D41A, digits: 0x1D7CE},
+	"mathit":     {upper: 0x1D434, lower: 0x1D44E, exceptions: map[rune]rune{'h': 'ℎ'}},
+	"mathsf":     {upper: 0x1D5A0, lower: 0x1D5BA, digits: 0x1D7E2},
+	"mathtt":     {upper: 0x1D670, lower: 0x1D68A, digits: 0x1D7F6},
+}
@@ -0,0 +1,48 @@
+package client
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTexToMathML(t *testing.T) {
+	tests := []struct {
+		tex      string
+		contains string
+	}{
+		{`x^2`, "<msup><mi>x</mi><mn>2</mn></msup>"},
+		{`\frac{1}{2}`, "<mfrac><mrow><mn>1</mn></mrow>"},
+		{`\text{hej}`, "<mtext>hej</mtext>"},
+		// unfinished, which used to panic
+		{`\text{\`, "<math>"},
+		{`\mathbb{\`, "<math>"},
+		{`\begin{\`, "<math>"},
+		{`x^\text{a\`, "<math>"},
+		{`\`, "<math>"},
+		{`\not`, "<math>"},
+	}
+
+	for _, test := range tests {
+		if got := texToMathML(test.tex, false); !strings.Contains(got, test.contains) {
+			t.Errorf("got %v for %q, wanted %v in it", got, test.tex, test.contains)
+		}
+	}
+}
+
+func TestMathInMarkdown(t *testing.T) {
+	// a typo in one formula mustn't break the whole article
+	html := string(mdToHTML(nil, "Formel: $\\text{\\$ och mer", ""))
+	if !strings.Contains(html, "och mer") {
+		t.Errorf("got %v, wanted the rest of the text", html)
+	}
+}
+
+func FuzzTexToMathML(f *testing.F) {
+	for _, tex := range []string{`x^2_i`, `\frac{a}{b}`, `\sqrt[3]{x}`, `\left( x \right)`, `\begin{pmatrix} 1 & 2 \\ 3 & 4 \end{pmatrix}`, `\text{a\`} {
+		f.Add(tex)
+	}
+	f.Fuzz(func(t *testing.T, tex string) {
+		texToMathML(tex, false)
+		texToMathML(tex, true)
+	})
+}
@@ -0,0 +1,218 @@
+package client
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"sync"
+
+	"dbuggen/server/database"
+)
+
+// Changed whenever articles are rendered differently, so that html saved
+// in the database by an older version is rendered again
+const renderVersion = "2"
+
+// RenderCache keeps the html of recently shown articles, so that articles,
+// and all the math in them, are only rendered again after they have been
+// changed. Revisions are told apart by a hash of their content, and the
+// least recently used ones are dropped once there are more than Capacity.
+//
+// If it's told to persist, rendered articles are also saved in the
+// database and looked up there before being rendered, so that a restart
+// doesn't mean rendering everything again.
+type RenderCache struct {
+	Capacity int
+
+	mutex   sync.Mutex
+	entries map[renderKey]*list.Element
+	// the most recently used first
+	recent *list.List
+	// bumped by Clear, so that what's rendered from before isn't kept
+	generation int
+	stats      RenderStats
+
+	render  func(article database.Article) template.HTML
+	db      database.Store
+	persist bool
+}
+
+type renderKey struct {
+	articleID int
+	hash      [sha256.Size]byte
+}
+
+type renderEntry struct {
+	key  renderKey
+	html template.HTML
+}
+
+// How well the render cache is doing
+type RenderStats struct {
+	// Found in memory
+	Hits int
+	// Found in the database
+	Persisted int
+	// Rendered
+	Misses int
+
+	Entries  int
+	Capacity int
+}
+
+func (s RenderStats) Lookups() int {
+	return s.Hits + s.Persisted + s.Misses
+}
+
+// The percentage of lookups which didn't need rendering
+func (s RenderStats) HitRate() int {
+	if s.Lookups() == 0 {
+		return 0
+	}
+	return 100 * (s.Hits + s.Persisted) / s.Lookups()
+}
+
+// NewRenderCache creates a render cache for the articles in db, keeping at
+// most capacity of them.
+func NewRenderCache(db database.Store, capacity int, persist bool) *RenderCache {
+	return &RenderCache{
+		Capacity: capacity,
+		entries:  make(map[renderKey]*list.Element),
+		recent:   list.New(),
+		render: func(article database.Article) template.HTML {
+			return mdToHTML(db, article.Content, fmt.Sprintf("article-%v-", article.ID))
+		},
+		db:      db,
+		persist: persist,
+	}
+}
+
+// Article gives the html of an article, which is only rendered if this
+// revision of it isn't in the cache.
+func (rc *RenderCache) Article(article database.Article) template.HTML {
+	key := renderKey{article.ID, sha256.Sum256([]byte(renderVersion + "\n" + article.Content))}
+
+	rc.mutex.Lock()
+	if e, ok := rc.entries[key]; ok {
+		rc.recent.MoveToFront(e)
+		rc.stats.Hits++
+		html := e.Value.(renderEntry).html
+		rc.mutex.Unlock()
+		return html
+	}
+	generation := rc.generation
+	rc.mutex.Unlock()
+
+	// rendered without holding the lock, since it looks up images in the
+	// database. Two requests for a new revision at once both render it,
+	// which is fine.
+	html, persisted := rc.load(key)
+	if !persisted {
+		html = rc.render(article)
+		rc.save(key, html)
+	}
+
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	if persisted {
+		rc.stats.Persisted++
+	} else {
+		rc.stats.Misses++
+	}
+	if generation == rc.generation {
+		rc.add(key, html)
+	}
+	return html
+}
+
+func (rc *RenderCache) add(key renderKey, html template.HTML) {
+	if e, ok := rc.entries[key]; ok {
+		rc.recent.MoveToFront(e)
+		return
+	}
+
+	rc.entries[key] = rc.recent.PushFront(renderEntry{key, html})
+	for rc.recent.Len() > max(rc.Capacity, 0) {
+		oldest := rc.recent.Back()
+		rc.recent.Remove(oldest)
+		delete(rc.entries, oldest.Value.(renderEntry).key)
+	}
+}
+
+func (rc *RenderCache) load(key renderKey) (template.HTML, bool) {
+	if !rc.persist {
+		return "", false
+	}
+
+	rendered, err := rc.db.GetRenderedArticle(key.articleID, key.hash[:])
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("rendering article %v again: %v", key.articleID, err)
+		}
+		return "", false
+	}
+	return template.HTML(rendered.HTML), true
+}
+
+func (rc *RenderCache) save(key renderKey, html template.HTML) {
+	if !rc.persist {
+		return
+	}
+
+	err := rc.db.SaveRenderedArticle(database.RenderedArticle{
+		ArticleID:   key.articleID,
+		ContentHash: key.hash[:],
+		HTML:        string(html),
+	})
+	if err != nil {
+		log.Printf("could not save the html of article %v: %v", key.articleID, err)
+	}
+}
+
+// Invalidate drops every revision of an article, which is done when it's
+// edited or deleted.
+func (rc *RenderCache) Invalidate(articleID int) {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	for e := rc.recent.Front(); e != nil; {
+		next := e.Next()
+		if key := e.Value.(renderEntry).key; key.articleID == articleID {
+			rc.recent.Remove(e)
+			delete(rc.entries, key)
+		}
+		e = next
+	}
+}
+
+// Clear drops everything, including what's saved in the database, for when
+// something every article may use has changed, like the images in the
+// media library.
+func (rc *RenderCache) Clear() {
+	rc.mutex.Lock()
+	rc.entries = make(map[renderKey]*list.Element)
+	rc.recent.Init()
+	rc.generation++
+	rc.mutex.Unlock()
+
+	if rc.persist {
+		if err := rc.db.ClearRenderedArticles(); err != nil {
+			log.Printf("could not clear the rendered articles: %v", err)
+		}
+	}
+}
+
+// Stats tells how many lookups have been hits and misses since starting.
+func (rc *RenderCache) Stats() RenderStats {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	stats := rc.stats
+	stats.Entries = rc.recent.Len()
+	stats.Capacity = rc.Capacity
+	return stats
+}
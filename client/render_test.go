@@ -0,0 +1,121 @@
+package client
+
+import (
+	"html/template"
+	"testing"
+
+	"dbuggen/server/database"
+)
+
+// A render cache which counts how many times it has rendered anything,
+// rendering markdown as itself
+func countingCache(db database.Store, capacity int, persist bool) (*RenderCache, *int) {
+	rendered := NewRenderCache(db, capacity, persist)
+	renders := 0
+	rendered.render = func(article database.Article) template.HTML {
+		renders++
+		return template.HTML(article.Content)
+	}
+	return rendered, &renders
+}
+
+func TestRenderCache(t *testing.T) {
+	rendered, renders := countingCache(database.Testdata(), 2, false)
+
+	article := database.Article{ID: 1, Content: "första"}
+	rendered.Article(article)
+	if html := rendered.Article(article); html != "första" || *renders != 1 {
+		t.Errorf("got %q after %v renders, wanted the first one to be kept", html, *renders)
+	}
+
+	// a new revision is rendered again, but other articles are kept
+	rendered.Article(database.Article{ID: 2, Content: "annan"})
+	article.Content = "andra"
+	if html := rendered.Article(article); html != "andra" || *renders != 3 {
+		t.Errorf("got %q after %v renders, wanted the new revision", html, *renders)
+	}
+	rendered.Article(database.Article{ID: 2, Content: "annan"})
+	if *renders != 3 {
+		t.Errorf("got %v renders, the other article should have been kept", *renders)
+	}
+
+	stats := rendered.Stats()
+	if stats.Hits != 2 || stats.Misses != 3 || stats.Entries != 2 || stats.HitRate() != 40 {
+		t.Errorf("got %+v with a hit rate of %v%%", stats, stats.HitRate())
+	}
+}
+
+func TestRenderCacheEviction(t *testing.T) {
+	rendered, renders := countingCache(database.Testdata(), 2, false)
+
+	first := database.Article{ID: 0, Content: "noll"}
+	second := database.Article{ID: 1, Content: "ett"}
+	third := database.Article{ID: 2, Content: "två"}
+
+	rendered.Article(first)
+	rendered.Article(second)
+	// the first one was used last, so the second one goes to make room
+	rendered.Article(first)
+	rendered.Article(third)
+	if *renders != 3 {
+		t.Fatalf("got %v renders, wanted 3", *renders)
+	}
+
+	rendered.Article(first)
+	if *renders != 3 {
+		t.Error("the most recently used article was dropped")
+	}
+	rendered.Article(second)
+	if *renders != 4 {
+		t.Error("the least recently used article was kept")
+	}
+	if entries := rendered.Stats().Entries; entries != 2 {
+		t.Errorf("got %v entries, wanted at most 2", entries)
+	}
+}
+
+func TestRenderCacheInvalidate(t *testing.T) {
+	rendered, renders := countingCache(database.Testdata(), 10, false)
+
+	rendered.Article(database.Article{ID: 0, Content: "gammal"})
+	rendered.Article(database.Article{ID: 0, Content: "ny"})
+	rendered.Article(database.Article{ID: 1, Content: "annan"})
+
+	rendered.Invalidate(0)
+	if entries := rendered.Stats().Entries; entries != 1 {
+		t.Errorf("got %v entries, wanted both revisions of the article dropped", entries)
+	}
+	rendered.Article(database.Article{ID: 1, Content: "annan"})
+	if *renders != 3 {
+		t.Error("other articles should be kept")
+	}
+
+	rendered.Clear()
+	rendered.Article(database.Article{ID: 1, Content: "annan"})
+	if *renders != 4 {
+		t.Error("everything should be rendered again after clearing")
+	}
+}
+
+func TestRenderCachePersist(t *testing.T) {
+	db := database.Testdata()
+	article := database.Article{ID: 1, Content: "sparad"}
+
+	first, renders := countingCache(db, 10, true)
+	first.Article(article)
+
+	// as if restarted
+	second, _ := countingCache(db, 10, true)
+	second.render = first.render
+	if html := second.Article(article); html != "sparad" || *renders != 1 {
+		t.Errorf("got %q after %v renders, wanted what was saved", html, *renders)
+	}
+	if stats := second.Stats(); stats.Persisted != 1 || stats.HitRate() != 100 {
+		t.Errorf("got %+v, wanted it counted as found in the database", stats)
+	}
+
+	second.Clear()
+	if len(db.RenderedArticles) != 0 {
+		t.Error("clearing should clear the database too")
+	}
+}
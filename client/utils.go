@@ -1,42 +1,50 @@
 package client
 
 import (
+	"context"
 	"database/sql"
 	"dbuggen/server/database"
+	"dbuggen/server/hodis"
+	"dbuggen/server/upstream"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
-	"io"
 	"log"
-	"net/http"
+	"net/url"
 	"slices"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
+
+	"github.com/gin-gonic/gin"
 )
 
-// coverpage generates an HTML template for the cover image.
-// If the coverpage is valid, it returns an HTML string with an image tag.
-// If the coverpage is not valid, it returns an empty HTML string.
-func coverpage(coverpage sql.NullString) template.HTML {
-	if coverpage.Valid {
-		return template.HTML(fmt.Sprintf(`<img src="%v" style="max-width: 40vw;">`, template.HTMLEscapeString(coverpage.String)))
+// The cover of an issue, or nil if it doesn't have one.
+func coverpage(images imageLookup, coverpage sql.NullString, issueTitle string) *picture {
+	if !coverpage.Valid {
+		return nil
 	}
-	return template.HTML("")
+	p := images.picture(coverpage.String, "Cover of "+issueTitle, "coverpage", "40vw")
+	return &p
 }
 
-// Generates an html template for a member picture. If the member has
-// an image that will be displayed, and otherwise it will show a
-// default picture.
-func memberpicture(picture sql.NullString) template.HTML {
-	var pic string
+// Link to the HTML edition of an issue, or an empty string if it doesn't
+// have one.
+func htmlLink(issue database.HomeIssue) string {
+	if !issue.Html.Valid {
+		return ""
+	}
+	return fmt.Sprintf("/issue/%v/html", issue.ID)
+}
+
+// The picture of a member, or a default picture if they don't have one.
+func memberpicture(images imageLookup, picture sql.NullString, name string) picture {
+	url := "/public/default_member.svg"
 	if picture.Valid {
-		pic = picture.String
-	} else {
-		pic = "/public/default_member.svg"
+		url = picture.String
 	}
-	return template.HTML(fmt.Sprintf(`<img src="%v" style="max-width: 10vw;">`, template.HTMLEscapeString(pic)))
+	return images.picture(url, name, "memberPicture", "10vw")
 }
 
 // a struct for displaying members on the
@@ -44,20 +52,22 @@ func memberpicture(picture sql.NullString) template.HTML {
 type displayMember struct {
 	KthID   string
 	Name    string
-	Picture template.HTML
+	Picture picture
 	Title   string
 }
 
 // creates a displaymember from a member struct, using the prefered
-// name if there is any and a html template for the picture used.
-func displaymemberize(members []database.Member) []displayMember {
+// name if there is any and the picture from images.
+func displaymemberize(ctx context.Context, names *hodis.Resolver, images imageLookup, members []database.Member) []displayMember {
+	resolveMembers(ctx, names, members)
+
 	displaymembers := make([]displayMember, len(members))
 	for i, member := range members {
-		name := authorsName(database.Author{KthID: member.KthID, PreferedName: member.PreferedName})
+		name := authorsName(ctx, names, database.Author{KthID: member.KthID, PreferedName: member.PreferedName})
 		displaymembers[i] = displayMember{
 			KthID:   fmt.Sprintf("redaqtionen/%v", member.KthID),
 			Name:    name,
-			Picture: memberpicture(member.PictureURL),
+			Picture: memberpicture(images, member.PictureURL, name),
 			Title:   member.Title,
 		}
 	}
@@ -65,7 +75,7 @@ func displaymemberize(members []database.Member) []displayMember {
 }
 
 // Gets a list of current chefreds kth ids from dfunkt
-func getChefreds(DFUNKT_URL string) []string {
+func getChefreds(ctx context.Context, dfunkt *upstream.Client) []string {
 	type result struct { // "json"... more like "no, son"
 		Mandates []struct { // "go"... more like "row".
 			User struct { // the boat - pshshshchhhhh
@@ -74,32 +84,16 @@ func getChefreds(DFUNKT_URL string) []string {
 		} `json:"mandates"`
 	}
 
-	if DFUNKT_URL[len(DFUNKT_URL)-1] != '/' { // no https://dfunkt.seapi/role/...
-		DFUNKT_URL = fmt.Sprintf("%v/", DFUNKT_URL)
-	}
-
 	var chefreds []string
 
-	resp, err := http.Get(fmt.Sprintf("%vapi/role/chefred/current", DFUNKT_URL))
-	if err != nil {
-		log.Println(err)
-		return chefreds
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("unexpected http response from dfunkt: %v", resp.StatusCode)
-		return chefreds
-	}
-
-	contents, err := io.ReadAll(io.Reader(resp.Body))
+	contents, err := dfunkt.Get(ctx, "api/role/chefred/current")
 	if err != nil {
 		log.Println(err)
 		return chefreds
 	}
 
 	var res result
-	err = json.Unmarshal([]byte(contents), &res)
+	err = json.Unmarshal(contents, &res)
 	if err != nil {
 		log.Println(err)
 		return chefreds
@@ -140,7 +134,7 @@ func removeDuplicateChefreds(chefredIDs []string, members []database.Member) ([]
 // authortext returns the author text based on the given AuthorText and authors.
 // If AuthorText is valid, it returns the AuthorText string. Otherwise, it constructs
 // the author text using the names of the authors.
-func authortext(AuthorText sql.NullString, authors []database.Author) string {
+func authortext(ctx context.Context, names *hodis.Resolver, AuthorText sql.NullString, authors []database.Author) string {
 	if AuthorText.Valid {
 		return AuthorText.String
 	}
@@ -149,123 +143,145 @@ func authortext(AuthorText sql.NullString, authors []database.Author) string {
 		return "Skriven av redaqtionen"
 	}
 
+	resolveAuthors(ctx, names, authors)
+
 	var sb strings.Builder
 	sb.WriteString("Skriven av ")
 
-	sb.WriteString(authorsName(authors[0]))
+	sb.WriteString(authorsName(ctx, names, authors[0]))
 	if len(authors) == 1 {
 		return sb.String()
 	}
 
 	for i := 1; i < len(authors)-1; i++ {
-		sb.WriteString(fmt.Sprintf(", %v", authorsName(authors[i])))
+		sb.WriteString(fmt.Sprintf(", %v", authorsName(ctx, names, authors[i])))
 	}
 
-	sb.WriteString(fmt.Sprintf(" och %v", authorsName(authors[len(authors)-1])))
+	sb.WriteString(fmt.Sprintf(" och %v", authorsName(ctx, names, authors[len(authors)-1])))
 	return sb.String()
 }
 
 // authorsName returns the preferred name of an author from the database.
 // If the preferred name is not available, it retrieves the display name
-// from hodis.datasektionen.se based on the author's KTH ID.
-func authorsName(a database.Author) string {
+// from hodis based on the author's KTH ID.
+func authorsName(ctx context.Context, names *hodis.Resolver, a database.Author) string {
 	if a.PreferedName.Valid {
 		return a.PreferedName.String
 	}
+	return names.Name(ctx, a.KthID)
+}
 
-	resp, err := http.Get(fmt.Sprintf("https://hodis.datasektionen.se/uid/%v", a.KthID))
-	if err != nil {
-		log.Println(err)
-		return a.KthID
+// Looks up the names of all authors without a preferred name at once, so
+// that they're cached before being asked for one by one.
+func resolveAuthors(ctx context.Context, names *hodis.Resolver, authors ...[]database.Author) {
+	var kthIDs []string
+	for _, as := range authors {
+		for _, a := range as {
+			if !a.PreferedName.Valid {
+				kthIDs = append(kthIDs, a.KthID)
+			}
+		}
 	}
-	defer resp.Body.Close()
+	names.Names(ctx, kthIDs)
+}
 
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("unexpected http GET status from hodis: %v", resp.StatusCode)
+// Same as resolveAuthors, but for members
+func resolveMembers(ctx context.Context, names *hodis.Resolver, members []database.Member) {
+	authors := make([]database.Author, len(members))
+	for i, member := range members {
+		authors[i] = database.Author{KthID: member.KthID, PreferedName: member.PreferedName}
 	}
+	resolveAuthors(ctx, names, authors)
+}
 
-	contents, err := io.ReadAll(io.Reader(resp.Body))
-	if err != nil {
-		log.Println(err)
-		return a.KthID
-	}
-	m := make(map[string]interface{})
-	err = json.Unmarshal(contents, &m)
-	if err != nil {
-		log.Println(err)
-		return a.KthID
+// Function to remove the "/" before parameters, which was
+// a problem. Turns "/123": string, into 123: int.
+func pathIntSeparator(paramRaw string) (int, error) {
+	_, paramLessRaw, found := strings.Cut(paramRaw, "/")
+
+	if found {
+		param, err := strconv.Atoi(paramLessRaw)
+		if err != nil {
+			return 0, err
+		}
+		return param, nil
 	}
 
-	displayName, ok := m["displayName"].(string)
-	if !ok {
-		log.Printf("Failed to convert displayName to string, from kthid %v", a.KthID)
-		return a.KthID
+	param, err := strconv.Atoi(paramRaw)
+	if err != nil {
+		return 0, err
 	}
-	return displayName
+	return param, nil
 }
 
-type DarkmodeStatus struct {
-	Darkmode bool
-	LastPoll time.Time
-	Url      string
-	Mutex    sync.RWMutex
+// Turns a search snippet from the database into html, escaping everything
+// but marking the words which matched the search.
+func highlightSnippet(snippet string) template.HTML {
+	escaped := template.HTMLEscapeString(snippet)
+	escaped = strings.ReplaceAll(escaped, database.SnippetStart, "<mark>")
+	escaped = strings.ReplaceAll(escaped, database.SnippetStop, "</mark>")
+	return template.HTML(escaped)
 }
 
-// darkmode checks if the mörkläggning is active by making request to
-// an external API. It parses and outputs the result as a bool.
-// If any error occurs during the request or parsing the response, it returns
-// the default dark mode status which is true.
-func Darkmode(ds *DarkmodeStatus) bool {
-	ds.Mutex.RLock()
-	if time.Since(ds.LastPoll) <= time.Hour*24 {
-		ds.Mutex.RUnlock()
-		return ds.Darkmode
+// The page asked for in the "page" query parameter, starting at 1. Anything
+// which isn't a valid page becomes the first page.
+func pageParam(c *gin.Context) int {
+	page, err := strconv.Atoi(c.Query("page"))
+	if err != nil || page < 1 {
+		return 1
 	}
+	return page
+}
 
-	ds.Mutex.RUnlock()
-	ds.Mutex.Lock()
-	defer ds.Mutex.Unlock()
-	defDarkmode := true
+func searchLink(query string, page int) string {
+	return "/search?" + url.Values{"q": {query}, "page": {strconv.Itoa(page)}}.Encode()
+}
 
-	resp, err := http.Get(ds.Url)
-	if err != nil {
-		log.Println(err)
-		return defDarkmode
+// Reads the title, publishing date and publication from a posted issue
+// form.
+func issueForm(c *gin.Context) (string, time.Time, database.Publication, error) {
+	title := strings.TrimSpace(c.PostForm("title"))
+	if title == "" {
+		return "", time.Time{}, "", errors.New("the issue needs a title")
 	}
 
-	contents, err := io.ReadAll(io.Reader(resp.Body))
+	publishingDate, err := time.Parse(time.DateOnly, c.PostForm("publishing_date"))
 	if err != nil {
-		log.Println(err)
-		return defDarkmode
+		return "", time.Time{}, "", err
 	}
 
-	darkmodeStatus, err := strconv.ParseBool(strings.TrimSpace(string(contents)))
-	if err != nil {
-		log.Println(err)
-		return defDarkmode
+	publication := database.Publication(c.DefaultPostForm("publication", string(database.Dbuggen)))
+	if publication != database.Dbuggen && publication != database.Dtugget {
+		return "", time.Time{}, "", fmt.Errorf("unknown publication %q", publication)
 	}
 
-	ds.LastPoll = time.Now()
-	ds.Darkmode = darkmodeStatus
-	return darkmodeStatus
+	return title, publishingDate, publication, nil
 }
 
-// Function to remove the "/" before parameters, which was
-// a problem. Turns "/123": string, into 123: int.
-func pathIntSeparator(paramRaw string) (int, error) {
-	_, paramLessRaw, found := strings.Cut(paramRaw, "/")
+// Moves the article with the given id one step "up" or "down" in the order
+// of articles. Moving the first article up or the last one down leaves
+// the order as it is.
+func moveArticle(order []int, articleID int, direction string) ([]int, error) {
+	i := slices.Index(order, articleID)
+	if i == -1 {
+		return order, fmt.Errorf("article %v is not in the issue", articleID)
+	}
 
-	if found {
-		param, err := strconv.Atoi(paramLessRaw)
-		if err != nil {
-			return 0, err
-		}
-		return param, nil
+	var j int
+	switch direction {
+	case "up":
+		j = i - 1
+	case "down":
+		j = i + 1
+	default:
+		return order, fmt.Errorf("unknown direction %q", direction)
 	}
 
-	param, err := strconv.Atoi(paramRaw)
-	if err != nil {
-		return 0, err
+	if j < 0 || j >= len(order) {
+		return order, nil
 	}
-	return param, nil
+
+	moved := slices.Clone(order)
+	moved[i], moved[j] = moved[j], moved[i]
+	return moved, nil
 }
@@ -1,51 +1,41 @@
 package client
 
 import (
+	"context"
 	"database/sql"
 	"dbuggen/server/database"
 	"net/http"
-	"strconv"
-	"sync"
+	"net/http/httptest"
+	"slices"
 	"testing"
-	"time"
 
-	"github.com/h2non/gock"
+	"github.com/gin-gonic/gin"
 )
 
 func TestCoverpage(t *testing.T) {
-	// Test case 1: Valid coverpage
 	cp := sql.NullString{String: "https://example.com/cover.jpg", Valid: true}
-	expected := `<img src="https://example.com/cover.jpg" style="max-width: 40vw;">`
-	got := coverpage(cp)
-	if string(got) != expected {
+	expected := picture{Src: "https://example.com/cover.jpg", Alt: "Cover of Testdbuggen", Class: "coverpage"}
+	if got := coverpage(nil, cp, "Testdbuggen"); got == nil || *got != expected {
 		t.Errorf("got %v, wanted %v", got, expected)
 	}
 
-	// Test case 2: Invalid coverpage
-	cp = sql.NullString{String: "", Valid: false}
-	expected = ""
-	got = coverpage(cp)
-	if string(got) != expected {
-		t.Errorf("got %v, wanted %v", got, expected)
+	if got := coverpage(nil, sql.NullString{}, "Testdbuggen"); got != nil {
+		t.Errorf("got %v, wanted nothing", got)
 	}
 }
 
 func TestMemberpicture(t *testing.T) {
 	t.Run("valid picture", func(t *testing.T) {
 		mp := sql.NullString{String: "https://example.com/cover.jpg", Valid: true}
-		expected := `<img src="https://example.com/cover.jpg" style="max-width: 10vw;">`
-		got := memberpicture(mp)
-		if string(got) != expected {
+		expected := picture{Src: "https://example.com/cover.jpg", Alt: "Testerino", Class: "memberPicture"}
+		if got := memberpicture(nil, mp, "Testerino"); got != expected {
 			t.Errorf("got %v, wanted %v", got, expected)
 		}
 	})
 
-	// Test case 2: Invalid picture
 	t.Run("invalid picture", func(t *testing.T) {
-		mp := sql.NullString{String: "", Valid: false}
-		expected := `<img src="/public/default_member.svg" style="max-width: 10vw;">`
-		got := memberpicture(mp)
-		if string(got) != expected {
+		expected := picture{Src: "/public/default_member.svg", Alt: "Testerino", Class: "memberPicture"}
+		if got := memberpicture(nil, sql.NullString{}, "Testerino"); got != expected {
 			t.Errorf("got %v, wanted %v", got, expected)
 		}
 	})
@@ -54,7 +44,7 @@ func TestMemberpicture(t *testing.T) {
 func TestDisplaymemberize(t *testing.T) {
 	t.Run("empty list of members", func(t *testing.T) {
 		members := make([]database.Member, 0)
-		got := displaymemberize(members)
+		got := displaymemberize(context.Background(), fakeHodis(t), nil, members)
 		if len(got) != 0 {
 			t.Errorf("length of displaymembers is %v, not 0", len(got))
 		}
@@ -89,24 +79,24 @@ func TestDisplaymemberize(t *testing.T) {
 			{
 				KthID:   "redaqtionen/testsupp",
 				Name:    "Testerino",
-				Picture: memberpicture(members[0].PictureURL),
+				Picture: memberpicture(nil, members[0].PictureURL, "Testerino"),
 				Title:   "the cool one",
 			},
 			{
 				KthID:   "redaqtionen/test1",
 				Name:    "Test 1sson",
-				Picture: memberpicture(members[1].PictureURL),
+				Picture: memberpicture(nil, members[1].PictureURL, "Test 1sson"),
 				Title:   "1ssons frestelse",
 			},
 			{
 				KthID:   "redaqtionen/test2",
 				Name:    "TE S. T",
-				Picture: memberpicture(members[2].PictureURL),
+				Picture: memberpicture(nil, members[2].PictureURL, "TE S. T"),
 				Title:   "",
 			},
 		}
 
-		got := displaymemberize(members)
+		got := displaymemberize(context.Background(), fakeHodis(t), nil, members)
 		if len(got) != len(expected) {
 			t.Fatalf("list of display members is %v, instead of %v", len(got), len(expected))
 		}
@@ -120,13 +110,8 @@ func TestDisplaymemberize(t *testing.T) {
 }
 
 func TestGetChefreds(t *testing.T) {
-	dfunktURL := "https://dfunkt.datasektionen.se"
 	t.Run("not ok response", func(t *testing.T) {
-		defer gock.Off()
-		gock.New(dfunktURL).
-			Get("api/role/chefred/current").
-			Reply(http.StatusNotFound).
-			JSON(`{
+		dfunkt := fakeService(t, "/api/role/chefred/current", http.StatusNotFound, `{
 					"role": {
 						"id": 1,
 						"title": "Chefredaqtör",
@@ -153,18 +138,14 @@ func TestGetChefreds(t *testing.T) {
 						}
 					]
 				}`)
-		got := getChefreds(dfunktURL)
+		got := getChefreds(context.Background(), dfunkt)
 		if len(got) != 0 {
 			t.Errorf("the result should be empty, but it is %v", got)
 		}
 	})
 
 	t.Run("no current chefred", func(t *testing.T) {
-		defer gock.Off()
-		gock.New(dfunktURL).
-			Get("api/role/chefred/current").
-			Reply(http.StatusOK).
-			JSON(`{
+		dfunkt := fakeService(t, "/api/role/chefred/current", http.StatusOK, `{
 					"role": {
 						"id": 1,
 						"title": "Chefredaqtör",
@@ -180,18 +161,14 @@ func TestGetChefreds(t *testing.T) {
 					"mandates": []
 				}`)
 
-		got := getChefreds(dfunktURL)
+		got := getChefreds(context.Background(), dfunkt)
 		if len(got) != 0 {
 			t.Errorf("the result should be empty, but it is %v", got)
 		}
 	})
 
 	t.Run("single chefred", func(t *testing.T) {
-		defer gock.Off()
-		gock.New(dfunktURL).
-			Get("api/role/chefred/current").
-			Reply(http.StatusOK).
-			JSON(`{
+		dfunkt := fakeService(t, "/api/role/chefred/current", http.StatusOK, `{
 					"role": {
 						"id": 1,
 						"title": "Chefredaqtör",
@@ -219,7 +196,7 @@ func TestGetChefreds(t *testing.T) {
 					]
 				}`)
 
-		got := getChefreds(dfunktURL)
+		got := getChefreds(context.Background(), dfunkt)
 		expected := "chefen"
 		if len(got) != 1 {
 			t.Fatalf("there should only be a single chefred, there are %v many: %v", len(got), got)
@@ -231,11 +208,7 @@ func TestGetChefreds(t *testing.T) {
 	})
 
 	t.Run("multiple chefreds", func(t *testing.T) {
-		defer gock.Off()
-		gock.New(dfunktURL).
-			Get("api/role/chefred/current").
-			Reply(http.StatusOK).
-			JSON(`{
+		dfunkt := fakeService(t, "/api/role/chefred/current", http.StatusOK, `{
 					"role": {
 						"id": 1,
 						"title": "Chefredaqtör",
@@ -274,7 +247,7 @@ func TestGetChefreds(t *testing.T) {
 					]
 				}`)
 
-		got := getChefreds(dfunktURL)
+		got := getChefreds(context.Background(), dfunkt)
 		expected := []string{"chefen", "bossen"}
 		if len(got) != len(expected) {
 			t.Fatalf("there should only be 2 chefreds, there are %v many: %v", len(got), got)
@@ -482,11 +455,13 @@ func TestRemoveDuplicateChefreds(t *testing.T) {
 }
 
 func TestAuthortext(t *testing.T) {
+	names := fakeHodis(t)
+
 	// Test case 1: Valid AuthorText
 	authorText := sql.NullString{String: "Skriven av Test Testström", Valid: true}
 	authors := []database.Author{{PreferedName: sql.NullString{String: "Ej Korrektström", Valid: true}, KthID: "testsupp"}}
 	expected := "Skriven av Test Testström"
-	got := authortext(authorText, authors)
+	got := authortext(context.Background(), names, authorText, authors)
 	if got != expected {
 		t.Errorf("got %v, wanted %v", got, expected)
 	}
@@ -495,7 +470,7 @@ func TestAuthortext(t *testing.T) {
 	authorText = sql.NullString{String: "", Valid: false}
 	authors = []database.Author{}
 	expected = "Skriven av redaqtionen"
-	got = authortext(authorText, authors)
+	got = authortext(context.Background(), names, authorText, authors)
 	if got != expected {
 		t.Errorf("got %v, wanted %v", got, expected)
 	}
@@ -508,7 +483,7 @@ func TestAuthortext(t *testing.T) {
 		{PreferedName: sql.NullString{String: "", Valid: false}, KthID: "testsupp"},
 	}
 	expected = "Skriven av Skribent Skrivarsson, Skämt Skojsdotter och test support"
-	got = authortext(authorText, authors)
+	got = authortext(context.Background(), names, authorText, authors)
 	if got != expected {
 		t.Errorf("got %v, wanted %v", got, expected)
 	}
@@ -517,20 +492,22 @@ func TestAuthortext(t *testing.T) {
 	authorText = sql.NullString{String: "", Valid: false}
 	authors = []database.Author{{PreferedName: sql.NullString{String: "Testare #1", Valid: true}, KthID: "testsupp"}}
 	expected = "Skriven av Testare #1"
-	got = authortext(authorText, authors)
+	got = authortext(context.Background(), names, authorText, authors)
 	if got != expected {
 		t.Errorf("got %v, wanted %v", got, expected)
 	}
 }
 
 func TestAuthorsName(t *testing.T) {
+	names := fakeHodis(t)
+
 	// Test case 1: Preferred name is available
 	author := database.Author{
 		PreferedName: sql.NullString{String: "Testaren i dbuggen", Valid: true},
 		KthID:        "testsupp",
 	}
 	expected := "Testaren i dbuggen"
-	got := authorsName(author)
+	got := authorsName(context.Background(), names, author)
 	if got != expected {
 		t.Errorf("got %v, wanted %v", got, expected)
 	}
@@ -541,7 +518,7 @@ func TestAuthorsName(t *testing.T) {
 		KthID:        "testsupp",
 	}
 	expected = "test support"
-	got = authorsName(author)
+	got = authorsName(context.Background(), names, author)
 	if got != expected {
 		t.Errorf("got %v, wanted %v", got, expected)
 	}
@@ -552,106 +529,10 @@ func TestAuthorsName(t *testing.T) {
 		KthID:        "jaghoppasingenpåkthhetersåhär",
 	}
 	expected = "jaghoppasingenpåkthhetersåhär"
-	got = authorsName(author)
-	if got != expected {
-		t.Errorf("got %v, wanted %v", got, expected)
-	}
-}
-
-func TestDarkmodeFalse(t *testing.T) {
-	defer gock.Off()
-	darkmodeURL := "http://darkmode.datasektionen.se"
-	expected := false
-	gock.New(darkmodeURL).
-		Get("").
-		Reply(http.StatusOK).
-		JSON(strconv.FormatBool(expected))
-
-	oldpoll := time.Date(1983, time.October, 7, 17, 0, 0, 0, time.Local)
-	ds := DarkmodeStatus{
-		Darkmode: true,
-		LastPoll: oldpoll,
-		Url:      darkmodeURL,
-		Mutex:    sync.RWMutex{},
-	}
-
-	got := Darkmode(&ds)
-	if got != expected {
-		t.Errorf("got %v, wanted %v", got, expected)
-	}
-	newpoll := ds.LastPoll
-	if newpoll == oldpoll {
-		t.Errorf("The polling date of the struct has not been updated")
-	}
-
-	got2 := Darkmode(&ds)
-	if got2 != expected {
-		t.Errorf("got %v, wanted %v", got2, expected)
-	}
-	if ds.LastPoll != newpoll {
-		t.Errorf("The darkmode status was polled again when it should not have been")
-	}
-}
-
-func TestDarkmodeTrue(t *testing.T) {
-	defer gock.Off()
-	darkmodeURL := "http://darkmode.datasektionen.se"
-	expected := true
-	gock.New(darkmodeURL).
-		Get("").
-		Reply(http.StatusOK).
-		JSON(strconv.FormatBool(expected))
-
-	oldpoll := time.Date(1983, time.October, 7, 17, 0, 0, 0, time.Local)
-	ds := DarkmodeStatus{
-		Darkmode: false,
-		LastPoll: oldpoll,
-		Url:      darkmodeURL,
-		Mutex:    sync.RWMutex{},
-	}
-
-	got := Darkmode(&ds)
-	if got != expected {
-		t.Errorf("got %v, wanted %v", got, expected)
-	}
-	newpoll := ds.LastPoll
-	if newpoll == oldpoll {
-		t.Errorf("The polling date of the struct has not been updated")
-	}
-
-	got2 := Darkmode(&ds)
-	if got2 != expected {
-		t.Errorf("got %v, wanted %v", got2, expected)
-	}
-	if ds.LastPoll != newpoll {
-		t.Errorf("The darkmode status was polled again when it should not have been")
-	}
-}
-
-func TestDarkmodeInvalid(t *testing.T) {
-	defer gock.Off()
-	darkmodeURL := "http://darkmode.datasektionen.se"
-	gock.New(darkmodeURL).
-		Get("").
-		Reply(http.StatusOK).
-		JSON("hehe, not a bool n00b")
-
-	oldpoll := time.Date(1983, time.October, 7, 17, 0, 0, 0, time.Local)
-	ds := DarkmodeStatus{
-		Darkmode: false,
-		LastPoll: oldpoll,
-		Url:      darkmodeURL,
-		Mutex:    sync.RWMutex{},
-	}
-
-	expected := true
-	got := Darkmode(&ds)
+	got = authorsName(context.Background(), names, author)
 	if got != expected {
 		t.Errorf("got %v, wanted %v", got, expected)
 	}
-	if ds.LastPoll != oldpoll {
-		t.Errorf("The darkmode status has been updated with an invalid url")
-	}
 }
 
 func TestPathIntSeparator(t *testing.T) {
@@ -693,3 +574,87 @@ func TestPathIntSeparator(t *testing.T) {
 		}
 	}
 }
+
+func TestMoveArticle(t *testing.T) {
+	order := []int{4, 7, 2}
+
+	cases := []struct {
+		name      string
+		articleID int
+		direction string
+		expected  []int
+	}{
+		{"move up", 7, "up", []int{7, 4, 2}},
+		{"move down", 7, "down", []int{4, 2, 7}},
+		{"first article up", 4, "up", []int{4, 7, 2}},
+		{"last article down", 2, "down", []int{4, 7, 2}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := moveArticle(order, tc.articleID, tc.direction)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tc.expected) {
+				t.Errorf("got %v, wanted %v", got, tc.expected)
+			}
+		})
+	}
+
+	if !slices.Equal(order, []int{4, 7, 2}) {
+		t.Errorf("the original order was modified: %v", order)
+	}
+
+	t.Run("article not in issue", func(t *testing.T) {
+		if _, err := moveArticle(order, 1, "up"); err == nil {
+			t.Error("expected an error for an article not in the order")
+		}
+	})
+
+	t.Run("unknown direction", func(t *testing.T) {
+		if _, err := moveArticle(order, 7, "sideways"); err == nil {
+			t.Error("expected an error for an unknown direction")
+		}
+	})
+}
+
+func TestHtmlLink(t *testing.T) {
+	issue := database.HomeIssue{ID: 3, Html: sql.NullString{String: "https://example.com/3.html", Valid: true}}
+	if got := htmlLink(issue); got != "/issue/3/html" {
+		t.Errorf("got %v, wanted /issue/3/html", got)
+	}
+
+	issue.Html = sql.NullString{}
+	if got := htmlLink(issue); got != "" {
+		t.Errorf("got %v for an issue without html, wanted nothing", got)
+	}
+}
+
+func TestHighlightSnippet(t *testing.T) {
+	snippet := "Jo. Du bara kör " + database.SnippetStart + "hårt" + database.SnippetStop + " <script>mannen</script>"
+	expected := "Jo. Du bara kör <mark>hårt</mark> &lt;script&gt;mannen&lt;/script&gt;"
+	if got := highlightSnippet(snippet); string(got) != expected {
+		t.Errorf("got %v, wanted %v", got, expected)
+	}
+}
+
+func TestPageParam(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cases := map[string]int{
+		"":          1,
+		"?page=3":   3,
+		"?page=0":   1,
+		"?page=-2":  1,
+		"?page=tre": 1,
+	}
+
+	for query, expected := range cases {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/search"+query, nil)
+		if got := pageParam(c); got != expected {
+			t.Errorf("page of %q is %v, wanted %v", query, got, expected)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const visitorCookie = "dbuggen_visitor"
+
+// How many visitors are remembered at most by default. Once there are this
+// many within the window, new ones aren't counted until some have expired,
+// so that a crawler can't use up all memory.
+const DefaultMaxSeen = 100_000
+
+// ViewCounter counts the views of issues. A visitor only counts once per
+// issue within Window, and the views are collected and written to the
+// database in batches by Run, instead of once per page load.
+type ViewCounter struct {
+	Window  time.Duration
+	MaxSeen int
+
+	mutex   sync.Mutex
+	seen    map[viewKey]time.Time
+	pending map[int]int
+	flush   func(views map[int]int) error
+}
+
+type viewKey struct {
+	visitor string
+	issueID int
+}
+
+// NewViewCounter creates a view counter which writes the views it has
+// counted using flush, such as database.IncrementViews.
+func NewViewCounter(window time.Duration, flush func(views map[int]int) error) *ViewCounter {
+	return &ViewCounter{
+		Window:  window,
+		MaxSeen: DefaultMaxSeen,
+		seen:    make(map[viewKey]time.Time),
+		pending: make(map[int]int),
+		flush:   flush,
+	}
+}
+
+// Record counts a view of an issue, unless the same visitor has already
+// viewed it within the window.
+func (vc *ViewCounter) Record(issueID int, visitor string) {
+	vc.mutex.Lock()
+	defer vc.mutex.Unlock()
+
+	key := viewKey{visitor, issueID}
+	if last, ok := vc.seen[key]; ok && time.Since(last) < vc.Window {
+		return
+	}
+	if len(vc.seen) >= vc.MaxSeen {
+		return
+	}
+
+	vc.seen[key] = time.Now()
+	vc.pending[issueID]++
+}
+
+// Flush writes all views counted since the last flush. If the write fails
+// the views are kept, to be written the next time instead.
+func (vc *ViewCounter) Flush() error {
+	vc.mutex.Lock()
+	pending := vc.pending
+	vc.pending = make(map[int]int)
+
+	for key, last := range vc.seen {
+		if time.Since(last) >= vc.Window {
+			delete(vc.seen, key)
+		}
+	}
+	vc.mutex.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	if err := vc.flush(pending); err != nil {
+		vc.mutex.Lock()
+		for issueID, views := range pending {
+			vc.pending[issueID] += views
+		}
+		vc.mutex.Unlock()
+		return err
+	}
+
+	return nil
+}
+
+// Run flushes the counted views every interval until ctx is done, after
+// which it flushes one last time.
+func (vc *ViewCounter) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := vc.Flush(); err != nil {
+				log.Println(err)
+			}
+		case <-ctx.Done():
+			if err := vc.Flush(); err != nil {
+				log.Println(err)
+			}
+			return
+		}
+	}
+}
+
+// visitorID identifies a visitor by a random id kept in a cookie, giving
+// those without one a new cookie. Only when no cookie can be given are
+// visitors told apart by their address, since everyone behind the same
+// network would otherwise be counted as one.
+func visitorID(c *gin.Context, ds *DarkmodeStatus) string {
+	if id, err := c.Cookie(visitorCookie); err == nil && id != "" {
+		return id
+	}
+
+	// a page anyone may cache mustn't come with someone's cookie, see
+	// notModified
+	if Darkmode(ds) && !requestDrafts(c) {
+		return c.ClientIP()
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return c.ClientIP()
+	}
+
+	id := hex.EncodeToString(b)
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(visitorCookie, id, int((365 * 24 * time.Hour).Seconds()), "/", "", false, true)
+	return id
+}
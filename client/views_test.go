@@ -0,0 +1,165 @@
+package client
+
+import (
+	"errors"
+	"maps"
+	"testing"
+	"time"
+
+	"dbuggen/server/database"
+)
+
+func TestViewCounterDeduplicates(t *testing.T) {
+	var flushed []map[int]int
+	vc := NewViewCounter(time.Hour, func(views map[int]int) error {
+		flushed = append(flushed, views)
+		return nil
+	})
+
+	vc.Record(1, "nollan")
+	vc.Record(1, "nollan")
+	vc.Record(2, "nollan")
+	vc.Record(1, "phos")
+
+	if err := vc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[int]int{1: 2, 2: 1}
+	if len(flushed) != 1 || !maps.Equal(flushed[0], expected) {
+		t.Fatalf("flushed %v, wanted %v", flushed, []map[int]int{expected})
+	}
+
+	// still within the window, so nothing more should be counted
+	vc.Record(1, "nollan")
+	if err := vc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if len(flushed) != 1 {
+		t.Errorf("flushed again without any new views: %v", flushed[1:])
+	}
+}
+
+func TestViewCounterWindow(t *testing.T) {
+	var flushed []map[int]int
+	vc := NewViewCounter(time.Hour, func(views map[int]int) error {
+		flushed = append(flushed, views)
+		return nil
+	})
+
+	vc.Record(1, "nollan")
+	// pretend the view happened long ago
+	vc.seen[viewKey{"nollan", 1}] = time.Now().Add(-2 * time.Hour)
+	vc.Record(1, "nollan")
+
+	if err := vc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[int]int{1: 2}
+	if len(flushed) != 1 || !maps.Equal(flushed[0], expected) {
+		t.Errorf("flushed %v, wanted %v", flushed, []map[int]int{expected})
+	}
+}
+
+func TestViewCounterFailedFlush(t *testing.T) {
+	fail := true
+	var flushed map[int]int
+	vc := NewViewCounter(time.Hour, func(views map[int]int) error {
+		if fail {
+			return errors.New("the database is on fire")
+		}
+		flushed = views
+		return nil
+	})
+
+	vc.Record(1, "nollan")
+	if err := vc.Flush(); err == nil {
+		t.Fatal("expected the error from the failed flush")
+	}
+
+	fail = false
+	vc.Record(1, "phos")
+	if err := vc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[int]int{1: 2}
+	if !maps.Equal(flushed, expected) {
+		t.Errorf("flushed %v, wanted %v", flushed, expected)
+	}
+}
+
+func TestViewCounterEmptyFlush(t *testing.T) {
+	vc := NewViewCounter(time.Hour, func(views map[int]int) error {
+		t.Errorf("flushed %v without any views", views)
+		return nil
+	})
+
+	if err := vc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestViewCounterMaxSeen(t *testing.T) {
+	var flushed map[int]int
+	vc := NewViewCounter(time.Hour, func(views map[int]int) error {
+		flushed = views
+		return nil
+	})
+	vc.MaxSeen = 2
+
+	for _, visitor := range []string{"nollan", "phos", "crawler", "crawler2"} {
+		vc.Record(1, visitor)
+	}
+	if err := vc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if flushed[1] != 2 || len(vc.seen) != 2 {
+		t.Errorf("counted %v views of %v visitors, wanted only the first 2", flushed[1], len(vc.seen))
+	}
+}
+
+func TestViewsWithoutCookies(t *testing.T) {
+	db := database.Testdata()
+	var flushed map[int]int
+	views := NewViewCounter(time.Hour, func(views map[int]int) error {
+		flushed = views
+		return nil
+	})
+
+	// two people behind the same network, who are both given a cookie
+	r := testRouter(t, "/issue/:issue", Issue(db, fixedDarkmode(false), fakeHodis(t), views, renderCache(db)))
+	w := getWithHeaders(t, r, "/issue/0", nil)
+	cookie := w.Result().Cookies()
+	if len(cookie) != 1 || cookie[0].Name != visitorCookie {
+		t.Fatalf("got cookies %v, wanted a visitor cookie", cookie)
+	}
+	getWithHeaders(t, r, "/issue/0", nil)
+
+	// and the first one coming back with theirs, which was already counted
+	getWithHeaders(t, r, "/issue/0", map[string]string{"Cookie": cookie[0].String()})
+
+	if err := views.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if flushed[0] != 2 {
+		t.Errorf("counted %v views, wanted 2", flushed[0])
+	}
+
+	// pages anyone may cache during mörkläggningen don't get anyone's
+	// cookie, so those visitors are told apart by their address
+	r = testRouter(t, "/issue/:issue", Issue(db, fixedDarkmode(true), fakeHodis(t), views, renderCache(db)))
+	w = getWithHeaders(t, r, "/issue/0", nil)
+	if w.Header().Get("Cache-Control") != darkmodeCacheControl || w.Header().Get("Set-Cookie") != "" {
+		t.Errorf("got %q with Set-Cookie %q", w.Header().Get("Cache-Control"), w.Header().Get("Set-Cookie"))
+	}
+	getWithHeaders(t, r, "/issue/0", nil)
+
+	if err := views.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if flushed[0] != 1 {
+		t.Errorf("counted %v views during mörkläggningen, wanted 1", flushed[0])
+	}
+}
@@ -10,15 +10,59 @@ type Config struct {
 	DATABASE_URL string
 	DFUNKT_URL   string
 	DARKMODE_URL string
+	// Lets darkmode change the status right away, no webhook if empty
+	DARKMODE_WEBHOOK_SECRET string
+	// Where names are looked up, the real hodis if empty
+	HODIS_URL string
+
+	OIDC_ISSUER        string
+	OIDC_CLIENT_ID     string
+	OIDC_CLIENT_SECRET string
+	SESSION_SECRET     string
+	// Where uploaded images are kept unless S3_BUCKET is set
+	MEDIA_DIR            string
+	S3_ENDPOINT          string
+	S3_REGION            string
+	S3_BUCKET            string
+	S3_ACCESS_KEY_ID     string
+	S3_SECRET_ACCESS_KEY string
+	// Where uploaded images are reached from, straight from the endpoint if
+	// empty
+	S3_PUBLIC_URL string
+	// Keeps rendered articles in the database too if "true", so they
+	// aren't all rendered again after a restart
+	RENDER_CACHE_PERSIST string
+
+	// Logs everyone in as this kth id instead of using oidc. Only for
+	// running locally.
+	DEV_LOGIN_KTHID string
 }
 
 func GetConfig() *Config {
 	_ = godotenv.Load()
 
 	conf := Config{
-		DATABASE_URL: os.Getenv("DATABASE_URL"),
-		DFUNKT_URL:   os.Getenv("DFUNKT_URL"),
-		DARKMODE_URL: os.Getenv("DARKMODE_URL"),
+		DATABASE_URL:            os.Getenv("DATABASE_URL"),
+		DFUNKT_URL:              os.Getenv("DFUNKT_URL"),
+		DARKMODE_URL:            os.Getenv("DARKMODE_URL"),
+		DARKMODE_WEBHOOK_SECRET: os.Getenv("DARKMODE_WEBHOOK_SECRET"),
+		HODIS_URL:               os.Getenv("HODIS_URL"),
+
+		OIDC_ISSUER:        os.Getenv("OIDC_ISSUER"),
+		OIDC_CLIENT_ID:     os.Getenv("OIDC_CLIENT_ID"),
+		OIDC_CLIENT_SECRET: os.Getenv("OIDC_CLIENT_SECRET"),
+		SESSION_SECRET:     os.Getenv("SESSION_SECRET"),
+		DEV_LOGIN_KTHID:    os.Getenv("DEV_LOGIN_KTHID"),
+
+		MEDIA_DIR:            os.Getenv("MEDIA_DIR"),
+		S3_ENDPOINT:          os.Getenv("S3_ENDPOINT"),
+		S3_REGION:            os.Getenv("S3_REGION"),
+		S3_BUCKET:            os.Getenv("S3_BUCKET"),
+		S3_ACCESS_KEY_ID:     os.Getenv("S3_ACCESS_KEY_ID"),
+		S3_SECRET_ACCESS_KEY: os.Getenv("S3_SECRET_ACCESS_KEY"),
+		S3_PUBLIC_URL:        os.Getenv("S3_PUBLIC_URL"),
+
+		RENDER_CACHE_PERSIST: os.Getenv("RENDER_CACHE_PERSIST"),
 	}
 
 	return &conf
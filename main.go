@@ -1,13 +1,81 @@
 package main
 
 import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
 	"dbuggen/config"
 	"dbuggen/server"
 	"dbuggen/server/database"
 )
 
+const usage = `usage:
+	dbuggen                       start the server
+	dbuggen migrate up [n]        apply n migrations, or all of them
+	dbuggen migrate down [n]      undo the last n migrations, or just the last one
+	dbuggen migrate status        show the current schema version
+	dbuggen migrate force <n>     mark migration n as the latest applied, without running anything`
+
 func main() {
 	conf := config.GetConfig()
+
+	if len(os.Args) > 1 {
+		if os.Args[1] != "migrate" {
+			log.Fatal(usage)
+		}
+		migrate(conf, os.Args[2:])
+		return
+	}
+
 	db := database.Start(conf.DATABASE_URL)
 	server.Start(db, conf)
 }
+
+func migrate(conf *config.Config, args []string) {
+	if len(args) == 0 || len(args) > 2 {
+		log.Fatal(usage)
+	}
+
+	n := 0
+	if len(args) == 2 {
+		var err error
+		n, err = strconv.Atoi(args[1])
+		if err != nil || n < 0 {
+			log.Fatal(usage)
+		}
+	}
+
+	db := database.Connect(conf.DATABASE_URL)
+	defer db.Close()
+
+	var err error
+	switch args[0] {
+	case "up":
+		err = database.MigrateUp(db, n)
+	case "down":
+		err = database.MigrateDown(db, max(n, 1))
+	case "force":
+		if len(args) != 2 {
+			log.Fatal(usage)
+		}
+		err = database.ForceVersion(db, n)
+	case "status":
+		var version int
+		var migrations []database.Migration
+		version, err = database.SchemaVersion(db)
+		if err == nil {
+			migrations, err = database.Migrations()
+		}
+		if err == nil {
+			fmt.Printf("schema version %v of %v\n", version, len(migrations))
+		}
+	default:
+		log.Fatal(usage)
+	}
+
+	if err != nil {
+		log.Fatal(err)
+	}
+}
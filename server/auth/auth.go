@@ -0,0 +1,198 @@
+// Package auth handles logging in redaqtionen and keeping everyone else out
+// of the admin pages. Who the user is gets decided by a Provider, while what
+// they are allowed to do is decided by an Authorizer.
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The key under which the kth id of a logged in user is stored in the gin
+// context.
+const KthIDKey = "kthid"
+
+const stateCookie = "dbuggen_login_state"
+
+// Provider is an identity provider, such as the login service of the
+// section, which can tell who a user is.
+type Provider interface {
+	// LoginURL is where the user is sent to log in. Once done the provider
+	// should send them back to callback with the given state.
+	LoginURL(ctx context.Context, callback, state string) string
+	// Identify uses the request to the callback to find out the kth id of
+	// the user who just logged in.
+	Identify(ctx context.Context, r *http.Request, callback string) (string, error)
+}
+
+// Authorizer decides whether the user with the given kth id is allowed into
+// the admin pages.
+type Authorizer func(kthID string) (bool, error)
+
+type Auth struct {
+	Provider  Provider
+	Sessions  *Sessions
+	Authorize Authorizer
+}
+
+func New(provider Provider, secret []byte, authorize Authorizer) *Auth {
+	return &Auth{
+		Provider:  provider,
+		Sessions:  NewSessions(secret, 7*24*time.Hour),
+		Authorize: authorize,
+	}
+}
+
+// KthID returns the kth id of the user logged in during the request, or an
+// empty string if nobody is.
+func KthID(c *gin.Context) string {
+	return c.GetString(KthIDKey)
+}
+
+// Require is a middleware which only lets through users who are logged in
+// and allowed in by the authorizer. Anyone not logged in is sent to log in.
+func (a *Auth) Require() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		kthID, ok := a.Sessions.Get(c)
+		if !ok {
+			if c.Request.Method == http.MethodGet {
+				c.Redirect(http.StatusFound, "/login?next="+url.QueryEscape(c.Request.URL.RequestURI()))
+				c.Abort()
+				return
+			}
+			abort(c, http.StatusUnauthorized, errors.New("not logged in"))
+			return
+		}
+
+		allowed, err := a.Authorize(kthID)
+		if err != nil {
+			abort(c, http.StatusInternalServerError, err)
+			return
+		}
+		if !allowed {
+			abort(c, http.StatusForbidden, fmt.Errorf("%v isn't allowed into the admin pages", kthID))
+			return
+		}
+
+		c.Set(KthIDKey, kthID)
+		c.Next()
+	}
+}
+
+// Allowed tells whether the user making the request is logged in and
+// allowed into the admin pages, for the few things outside of them which
+// only redaqtionen gets to do.
+func (a *Auth) Allowed(c *gin.Context) bool {
+	kthID, ok := a.Sessions.Get(c)
+	if !ok {
+		return false
+	}
+
+	allowed, err := a.Authorize(kthID)
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+
+	return allowed
+}
+
+// Login sends the user on to the provider, remembering where they wanted
+// to go afterwards.
+func (a *Auth) Login() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		nonce := make([]byte, 16)
+		if _, err := rand.Read(nonce); err != nil {
+			abort(c, http.StatusInternalServerError, err)
+			return
+		}
+		state := base64.RawURLEncoding.EncodeToString(nonce)
+
+		// the state and where to go next are kept in a short lived cookie,
+		// signed so that nobody can pick where the callback sends them
+		cookie := a.Sessions.sign(state + "|" + safeNext(c.Query("next")))
+		c.SetSameSite(http.SameSiteLaxMode)
+		c.SetCookie(stateCookie, cookie, int((10 * time.Minute).Seconds()), "/", "", Secure(c), true)
+
+		c.Redirect(http.StatusFound, a.Provider.LoginURL(c.Request.Context(), callbackURL(c), state))
+	}
+}
+
+// Callback is where the provider sends the user back to after logging in.
+func (a *Auth) Callback() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cookie, err := c.Cookie(stateCookie)
+		if err != nil {
+			abort(c, http.StatusBadRequest, errors.New("no login in progress"))
+			return
+		}
+		c.SetCookie(stateCookie, "", -1, "/", "", Secure(c), true)
+
+		value, ok := a.Sessions.verify(cookie)
+		state, next, found := strings.Cut(value, "|")
+		if !ok || !found || state != c.Query("state") {
+			abort(c, http.StatusBadRequest, errors.New("login state does not match"))
+			return
+		}
+
+		kthID, err := a.Provider.Identify(c.Request.Context(), c.Request, callbackURL(c))
+		if err != nil {
+			log.Println(err)
+			abort(c, http.StatusUnauthorized, err)
+			return
+		}
+
+		a.Sessions.Set(c, kthID)
+		c.Redirect(http.StatusFound, next)
+	}
+}
+
+// Logout forgets the logged in user.
+func (a *Auth) Logout() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		a.Sessions.Clear(c)
+		c.Redirect(http.StatusFound, "/")
+	}
+}
+
+// Only allows redirecting to paths on this site, as to not be an open
+// redirect.
+func safeNext(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/admin"
+	}
+	return next
+}
+
+// The absolute url of the login callback, as seen by the user.
+func callbackURL(c *gin.Context) string {
+	scheme := "http"
+	if Secure(c) {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host + "/login/callback"
+}
+
+// Secure tells whether the request was made over https, for deciding
+// whether cookies should be secure and what absolute links start with.
+func Secure(c *gin.Context) bool {
+	return c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+}
+
+// Aborts the request without writing anything yet, unlike
+// c.AbortWithError, so that an error page can be shown for it further up
+func abort(c *gin.Context, status int, err error) {
+	c.Error(err)
+	c.Abort()
+	c.Status(status)
+}
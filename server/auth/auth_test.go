@@ -0,0 +1,259 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Sets up a router with the login routes and a protected admin page, where
+// only the kth ids in allowed get in.
+func testRouter(provider Provider, allowed ...string) (*gin.Engine, *Auth) {
+	gin.SetMode(gin.TestMode)
+
+	a := New(provider, []byte("hemligt"), func(kthID string) (bool, error) {
+		for _, id := range allowed {
+			if id == kthID {
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+
+	r := gin.New()
+	r.GET("login", a.Login())
+	r.GET("login/callback", a.Callback())
+	r.GET("logout", a.Logout())
+	r.GET("admin", a.Require(), func(c *gin.Context) {
+		c.String(http.StatusOK, "hej %v", KthID(c))
+	})
+	r.GET("allowed", func(c *gin.Context) {
+		c.String(http.StatusOK, "%v", a.Allowed(c))
+	})
+
+	return r, a
+}
+
+// A very small browser, which keeps its cookies between requests.
+type browser struct {
+	t       *testing.T
+	r       *gin.Engine
+	cookies map[string]*http.Cookie
+}
+
+func (b *browser) get(path string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for _, cookie := range b.cookies {
+		req.AddCookie(cookie)
+	}
+
+	w := httptest.NewRecorder()
+	b.r.ServeHTTP(w, req)
+
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.MaxAge < 0 {
+			delete(b.cookies, cookie.Name)
+		} else {
+			b.cookies[cookie.Name] = cookie
+		}
+	}
+	return w
+}
+
+// Follows redirects until a page that isn't one.
+func (b *browser) follow(path string) *httptest.ResponseRecorder {
+	for i := 0; i < 10; i++ {
+		w := b.get(path)
+		if w.Code != http.StatusFound {
+			return w
+		}
+
+		location, err := url.Parse(w.Header().Get("Location"))
+		if err != nil {
+			b.t.Fatal(err)
+		}
+		path = location.RequestURI()
+	}
+
+	b.t.Fatal("too many redirects")
+	return nil
+}
+
+func TestLoginFlow(t *testing.T) {
+	r, _ := testRouter(Fake{KthID: "testsupp"}, "testsupp")
+	b := &browser{t, r, map[string]*http.Cookie{}}
+
+	w := b.get("/admin")
+	if w.Code != http.StatusFound || !strings.HasPrefix(w.Header().Get("Location"), "/login") {
+		t.Fatalf("a visitor should be sent to log in, got %v to %q", w.Code, w.Header().Get("Location"))
+	}
+
+	w = b.follow("/admin")
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %v after logging in, wanted %v", w.Code, http.StatusOK)
+	}
+	if w.Body.String() != "hej testsupp" {
+		t.Errorf("got %q, wanted %q", w.Body.String(), "hej testsupp")
+	}
+
+	b.get("/logout")
+	w = b.get("/admin")
+	if w.Code != http.StatusFound {
+		t.Errorf("got %v after logging out, wanted %v", w.Code, http.StatusFound)
+	}
+}
+
+func TestNotAllowed(t *testing.T) {
+	r, _ := testRouter(Fake{KthID: "nollan"}, "testsupp")
+	b := &browser{t, r, map[string]*http.Cookie{}}
+
+	w := b.follow("/admin")
+	if w.Code != http.StatusForbidden {
+		t.Errorf("got %v, wanted %v", w.Code, http.StatusForbidden)
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	for kthID, expected := range map[string]string{"testsupp": "true", "nollan": "false"} {
+		r, _ := testRouter(Fake{KthID: kthID}, "testsupp")
+		b := &browser{t, r, map[string]*http.Cookie{}}
+
+		if w := b.get("/allowed"); w.Body.String() != "false" {
+			t.Errorf("got %v before logging in, wanted false", w.Body.String())
+		}
+		b.follow("/login")
+		if w := b.get("/allowed"); w.Body.String() != expected {
+			t.Errorf("got %v for %v, wanted %v", w.Body.String(), kthID, expected)
+		}
+	}
+}
+
+func TestAuthorizerError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	a := New(Fake{KthID: "testsupp"}, []byte("hemligt"), func(string) (bool, error) {
+		return false, errors.New("the database is on fire")
+	})
+	r := gin.New()
+	r.GET("login", a.Login())
+	r.GET("login/callback", a.Callback())
+	r.GET("admin", a.Require())
+	b := &browser{t, r, map[string]*http.Cookie{}}
+
+	w := b.follow("/admin")
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("got %v, wanted %v", w.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestCallbackWithoutLogin(t *testing.T) {
+	r, _ := testRouter(Fake{KthID: "testsupp"}, "testsupp")
+	b := &browser{t, r, map[string]*http.Cookie{}}
+
+	w := b.get("/login/callback?state=whatever")
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("got %v, wanted %v", w.Code, http.StatusBadRequest)
+	}
+	if _, ok := b.cookies[sessionCookie]; ok {
+		t.Error("a session was created without logging in")
+	}
+}
+
+func TestCallbackWrongState(t *testing.T) {
+	r, _ := testRouter(Fake{KthID: "testsupp"}, "testsupp")
+	b := &browser{t, r, map[string]*http.Cookie{}}
+
+	b.get("/login")
+	w := b.get("/login/callback?state=somethingelse")
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("got %v, wanted %v", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestTamperedSession(t *testing.T) {
+	r, a := testRouter(Fake{KthID: "testsupp"}, "chefen")
+
+	// a session signed with another secret, claiming to be chefen
+	other := NewSessions([]byte("inte hemligt"), time.Hour)
+	forged := other.sign("chefen|" + "99999999999")
+
+	req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+	req.AddCookie(&http.Cookie{Name: sessionCookie, Value: forged})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusFound {
+		t.Errorf("a forged session got %v, wanted a redirect to log in", w.Code)
+	}
+
+	// and the same session signed correctly, to make sure it's the
+	// signature that was the problem
+	signed := a.Sessions.sign("chefen|" + "99999999999")
+	req = httptest.NewRequest(http.MethodGet, "/admin", nil)
+	req.AddCookie(&http.Cookie{Name: sessionCookie, Value: signed})
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("a correctly signed session got %v, wanted %v", w.Code, http.StatusOK)
+	}
+}
+
+func TestExpiredSession(t *testing.T) {
+	r, a := testRouter(Fake{KthID: "testsupp"}, "testsupp")
+
+	expired := a.Sessions.sign("testsupp|" + "1")
+	req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+	req.AddCookie(&http.Cookie{Name: sessionCookie, Value: expired})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusFound {
+		t.Errorf("an expired session got %v, wanted a redirect to log in", w.Code)
+	}
+}
+
+func TestSafeNext(t *testing.T) {
+	cases := map[string]string{
+		"/admin/issue/1":      "/admin/issue/1",
+		"":                    "/admin",
+		"https://evil.com":    "/admin",
+		"//evil.com/admin":    "/admin",
+		"/\\evil.com":         "/admin",
+		"/admin?tab=articles": "/admin?tab=articles",
+	}
+
+	for next, expected := range cases {
+		if got := safeNext(next); got != expected {
+			t.Errorf("safeNext(%q) = %q, wanted %q", next, got, expected)
+		}
+	}
+}
+
+func TestOIDCNotAnswering(t *testing.T) {
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	t.Cleanup(provider.Close)
+
+	o := &OIDC{Issuer: provider.URL, HTTP: &http.Client{Timeout: 50 * time.Millisecond}}
+
+	// neither login should wait for the provider forever, nor on each other
+	done := make(chan string, 2)
+	for range 2 {
+		go func() { done <- o.LoginURL(context.Background(), "/login/callback", "state") }()
+	}
+	for range 2 {
+		select {
+		case url := <-done:
+			if url != "/" {
+				t.Errorf("got %v, wanted to be sent home", url)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("still waiting for the provider")
+		}
+	}
+}
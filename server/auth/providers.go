@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How long to wait for the provider before giving up, so that a provider
+// which never answers can't hold up every login
+const oidcTimeout = 10 * time.Second
+
+// OIDC logs users in through an OpenID Connect provider, such as the login
+// service of the section, using the authorization code flow. The user is
+// identified by the "sub" claim from the userinfo endpoint, which is their
+// kth id.
+type OIDC struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// Optional, a client giving up after oidcTimeout is used if nil
+	HTTP *http.Client
+
+	mutex     sync.Mutex
+	discovery *oidcDiscovery
+}
+
+type oidcDiscovery struct {
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+}
+
+// Fetches the endpoints of the provider the first time they are needed. If
+// that fails it is tried again the next time.
+func (o *OIDC) discover(ctx context.Context) (oidcDiscovery, error) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if o.discovery != nil {
+		return *o.discovery, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(o.Issuer, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return oidcDiscovery{}, err
+	}
+	resp, err := o.client().Do(req)
+	if err != nil {
+		return oidcDiscovery{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return oidcDiscovery{}, fmt.Errorf("unexpected http response from oidc discovery: %v", resp.StatusCode)
+	}
+
+	var discovery oidcDiscovery
+	if err := json.NewDecoder(resp.Body).Decode(&discovery); err != nil {
+		return oidcDiscovery{}, err
+	}
+
+	o.discovery = &discovery
+	return discovery, nil
+}
+
+func (o *OIDC) LoginURL(ctx context.Context, callback, state string) string {
+	discovery, err := o.discover(ctx)
+	if err != nil {
+		log.Println(err)
+		return "/"
+	}
+
+	query := url.Values{
+		"response_type": {"code"},
+		"client_id":     {o.ClientID},
+		"redirect_uri":  {callback},
+		"scope":         {"openid"},
+		"state":         {state},
+	}
+	return discovery.AuthorizationEndpoint + "?" + query.Encode()
+}
+
+func (o *OIDC) Identify(ctx context.Context, r *http.Request, callback string) (string, error) {
+	discovery, err := o.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	code := r.URL.Query().Get("code")
+	if code == "" {
+		return "", errors.New("no code in oidc callback")
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {callback},
+		"client_id":     {o.ClientID},
+		"client_secret": {o.ClientSecret},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := doJSON(o.client(), req, &token); err != nil {
+		return "", err
+	}
+
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, discovery.UserinfoEndpoint, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+
+	var userinfo struct {
+		Sub string `json:"sub"`
+	}
+	if err := doJSON(o.client(), req, &userinfo); err != nil {
+		return "", err
+	}
+	if userinfo.Sub == "" {
+		return "", errors.New("no sub in oidc userinfo")
+	}
+
+	return userinfo.Sub, nil
+}
+
+func (o *OIDC) client() *http.Client {
+	if o.HTTP != nil {
+		return o.HTTP
+	}
+	return &http.Client{Timeout: oidcTimeout}
+}
+
+func doJSON(client *http.Client, req *http.Request, v any) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected http response from %v: %v", req.URL.Host, resp.StatusCode)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// Fake is a provider which doesn't ask anyone anything, and logs everyone
+// in as KthID. Meant for tests and running locally, never production.
+type Fake struct {
+	KthID string
+}
+
+func (f Fake) LoginURL(ctx context.Context, callback, state string) string {
+	return callback + "?" + url.Values{"state": {state}}.Encode()
+}
+
+func (f Fake) Identify(ctx context.Context, r *http.Request, callback string) (string, error) {
+	if f.KthID == "" {
+		return "", errors.New("no user to fake a login as")
+	}
+	return f.KthID, nil
+}
@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const sessionCookie = "dbuggen_session"
+
+// Sessions are kept entirely in a cookie, signed with a secret so that the
+// user can't change who they are logged in as.
+type Sessions struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+func NewSessions(secret []byte, ttl time.Duration) *Sessions {
+	return &Sessions{secret: secret, ttl: ttl}
+}
+
+// Set logs in the user with the given kth id for the rest of the session.
+func (s *Sessions) Set(c *gin.Context, kthID string) {
+	expires := time.Now().Add(s.ttl).Unix()
+	value := s.sign(kthID + "|" + strconv.FormatInt(expires, 10))
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(sessionCookie, value, int(s.ttl.Seconds()), "/", "", Secure(c), true)
+}
+
+// Get returns the kth id of the logged in user, if the session cookie is
+// both valid and not yet expired.
+func (s *Sessions) Get(c *gin.Context) (string, bool) {
+	cookie, err := c.Cookie(sessionCookie)
+	if err != nil {
+		return "", false
+	}
+
+	value, ok := s.verify(cookie)
+	if !ok {
+		return "", false
+	}
+
+	kthID, expiresRaw, found := strings.Cut(value, "|")
+	if !found || kthID == "" {
+		return "", false
+	}
+
+	expires, err := strconv.ParseInt(expiresRaw, 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return "", false
+	}
+
+	return kthID, true
+}
+
+func (s *Sessions) Clear(c *gin.Context) {
+	c.SetCookie(sessionCookie, "", -1, "/", "", Secure(c), true)
+}
+
+// Turns value into "value.signature", both base64 encoded.
+func (s *Sessions) sign(value string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(value))
+
+	return base64.RawURLEncoding.EncodeToString([]byte(value)) + "." +
+		base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// The opposite of sign, making sure that the signature is correct.
+func (s *Sessions) verify(signed string) (string, bool) {
+	valueRaw, signatureRaw, found := strings.Cut(signed, ".")
+	if !found {
+		return "", false
+	}
+
+	value, err := base64.RawURLEncoding.DecodeString(valueRaw)
+	if err != nil {
+		return "", false
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(signatureRaw)
+	if err != nil {
+		return "", false
+	}
+
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write(value)
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return "", false
+	}
+
+	return string(value), true
+}
@@ -5,6 +5,52 @@ import (
 	"time"
 )
 
+// Which publication an issue belongs to.
+type Publication string
+
+const (
+	Dbuggen Publication = "dbuggen"
+	Dtugget Publication = "dtugget"
+)
+
+type External struct {
+	ID             int
+	HostedURL      string `db:"hosted_url"`
+	TypeOfExternal string `db:"type_of_external"`
+	// Only known for images uploaded through the media library
+	Width      sql.NullInt32
+	Height     sql.NullInt32
+	Filename   sql.NullString
+	UploadedBy sql.NullString `db:"uploaded_by"`
+	UploadedAt sql.NullTime   `db:"uploaded_at"`
+	// Describes the image for those who can't see it
+	AltText sql.NullString `db:"alt_text"`
+}
+
+// A smaller version of an uploaded image
+type ExternalSize struct {
+	External  int
+	Width     int
+	Height    int
+	HostedURL string `db:"hosted_url"`
+}
+
+// An image in the media library, with its smaller versions from the
+// smallest up and the articles it's used in.
+type Image struct {
+	External
+	Sizes    []ExternalSize
+	Articles []int
+}
+
+// The smallest version of the image, or the image itself if it has none
+func (i Image) Thumbnail() string {
+	if len(i.Sizes) == 0 {
+		return i.HostedURL
+	}
+	return i.Sizes[0].HostedURL
+}
+
 type Member struct {
 	KthID        string         `db:"kth_id"`
 	PreferedName sql.NullString `db:"prefered_name"`
@@ -21,6 +67,30 @@ type Issue struct {
 	Html           sql.NullInt32
 	Coverpage      sql.NullInt32
 	Views          int
+	Publication    Publication
+	Status         IssueStatus
+	// When a scheduled issue comes out
+	PublishAt sql.NullTime `db:"publish_at"`
+}
+
+// Whether an issue is out yet.
+type IssueStatus string
+
+const (
+	// Only shown to redaqtionen
+	IssueDraft IssueStatus = "draft"
+	// Comes out by itself at PublishAt
+	IssueScheduled IssueStatus = "scheduled"
+	IssuePublished IssueStatus = "published"
+)
+
+// Whether everyone gets to see the issue at the given time
+func (i Issue) Published(now time.Time) bool {
+	return published(i.Status, i.PublishAt, now)
+}
+
+func published(status IssueStatus, publishAt sql.NullTime, now time.Time) bool {
+	return status == IssuePublished || (status == IssueScheduled && publishAt.Valid && !now.Before(publishAt.Time))
 }
 
 // Relevant information for issue on home page
@@ -29,7 +99,19 @@ type HomeIssue struct {
 	Title          string
 	PublishingDate time.Time `db:"publishing_date"`
 	Coverpage      sql.NullString
+	Pdf            sql.NullString
+	Html           sql.NullString
 	Views          int
+	Publication    Publication
+	// How many of its articles are hidden by the mörkläggning
+	Hidden    int
+	Status    IssueStatus
+	PublishAt sql.NullTime `db:"publish_at"`
+}
+
+// Whether everyone gets to see the issue at the given time
+func (i HomeIssue) Published(now time.Time) bool {
+	return published(i.Status, i.PublishAt, now)
 }
 
 type Article struct {
@@ -43,7 +125,91 @@ type Article struct {
 	N0lleSafe  bool      `db:"n0lle_safe"`
 }
 
+// What's left of an article which isn't nØllesafe during the mörkläggning,
+// just enough to know where in its issue it was.
+func (a Article) Hide() Article {
+	return Article{ID: a.ID, Issue: a.Issue, IssueIndex: a.IssueIndex}
+}
+
+// A saved version of an article.
+type Revision struct {
+	ID      int
+	Article int
+	Title   string
+	Content string
+	// Null for the version an article had before revisions were kept
+	EditedBy sql.NullString `db:"edited_by"`
+	EditedAt time.Time      `db:"edited_at"`
+}
+
+type AuthoredBy struct {
+	ArticleID int    `db:"article_id"`
+	KthID     string `db:"kth_id"`
+}
+
+type PictureUsedInArticle struct {
+	ArticleID int `db:"article_id"`
+	PictureID int `db:"picture_id"`
+}
+
+// The html an article was rendered to, where ContentHash tells which
+// revision of it that was.
+type RenderedArticle struct {
+	ArticleID   int    `db:"article"`
+	ContentHash []byte `db:"content_hash"`
+	HTML        string `db:"html"`
+}
+
 type Author struct {
 	KthID        string         `db:"kth_id"`
 	PreferedName sql.NullString `db:"prefered_name"`
 }
+
+// An article together with the issue it was published in, for listing
+// articles outside of their issue.
+type AuthoredArticle struct {
+	ID             int
+	Title          string
+	IssueID        int       `db:"issue_id"`
+	IssueIndex     int       `db:"issue_index"`
+	IssueTitle     string    `db:"issue_title"`
+	PublishingDate time.Time `db:"publishing_date"`
+}
+
+// An article matching a search, with a snippet of the content around where
+// it matched. The matching words in the snippet are surrounded by
+// SnippetStart and SnippetStop.
+type SearchResult struct {
+	AuthoredArticle
+	Snippet string
+	Rank    float64
+}
+
+const (
+	SnippetStart = "⟦"
+	SnippetStop  = "⟧"
+)
+
+// A name looked up from hodis. DisplayName is null if the lookup failed.
+type HodisName struct {
+	KthID       string         `db:"kth_id"`
+	DisplayName sql.NullString `db:"display_name"`
+	FetchedAt   time.Time      `db:"fetched_at"`
+}
+
+// What redaqtionen has decided about darkmode.
+type DarkmodeMode string
+
+const (
+	// Whatever the darkmode service says
+	DarkmodeFollow   DarkmodeMode = "follow"
+	DarkmodeForceOn  DarkmodeMode = "on"
+	DarkmodeForceOff DarkmodeMode = "off"
+)
+
+// The darkmode override, along with who last changed it and when.
+type DarkmodeOverride struct {
+	Mode      DarkmodeMode
+	ChangedBy sql.NullString `db:"changed_by"`
+	ChangedAt time.Time      `db:"changed_at"`
+}
@@ -3,13 +3,38 @@ package database
 import (
 	"database/sql"
 	"errors"
+	"fmt"
 	"log"
+	"time"
 
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
-func Start(db_url string) *sqlx.DB {
+// Whether an issue is out, for the where clause of anything selecting from
+// Archive.Issue. Scheduled issues come out by themselves once it's time.
+const issuePublished = `(status = 'published' OR (status = 'scheduled' AND publish_at <= NOW()))`
+
+// Postgres is the Store used in production, backed by a postgresql
+// database.
+type Postgres struct {
+	*sqlx.DB
+}
+
+// Start connects to the database, refusing to go on if its schema isn't
+// up to date with the migrations.
+func Start(db_url string) *Postgres {
+	db := Connect(db_url)
+
+	if err := CheckSchema(db); err != nil {
+		log.Fatal(err)
+	}
+
+	return &Postgres{db}
+}
+
+// Connect connects to the database without caring about its schema.
+func Connect(db_url string) *sqlx.DB {
 	db, err := sqlx.Connect("postgres", db_url)
 	if err != nil {
 		log.Fatal(err)
@@ -18,7 +43,7 @@ func Start(db_url string) *sqlx.DB {
 	return db
 }
 
-func GetIssues(db *sqlx.DB) ([]Issue, error) {
+func (db *Postgres) GetIssues() ([]Issue, error) {
 	issues := []Issue{}
 
 	err := db.Select(&issues, "SELECT * FROM Archive.Issue ORDER BY publishing_date DESC")
@@ -30,7 +55,7 @@ func GetIssues(db *sqlx.DB) ([]Issue, error) {
 	return issues, nil
 }
 
-func GetIssue(db *sqlx.DB, issueID int, darkmode bool) (HomeIssue, error) {
+func (db *Postgres) GetIssue(issueID int, darkmode bool, drafts bool) (HomeIssue, error) {
 	var issue HomeIssue
 
 	if darkmode {
@@ -39,30 +64,53 @@ func GetIssue(db *sqlx.DB, issueID int, darkmode bool) (HomeIssue, error) {
 										WHERE id IN
 											(SELECT issue FROM Archive.Article
 												WHERE n0lle_safe = TRUE)
+										OR NOT EXISTS
+											(SELECT 1 FROM Archive.Article
+												WHERE Article.issue = Issue.id)
 								)
-								SELECT id, title, publishing_date, hosted_url AS coverpage, views
+								SELECT id, title, publishing_date, hosted_url AS coverpage,
+									(SELECT ext_pdf.hosted_url FROM Archive.External AS ext_pdf
+										WHERE ext_pdf.id = pdf AND ext_pdf.type_of_external = 'pdf') AS pdf,
+									(SELECT ext_html.hosted_url FROM Archive.External AS ext_html
+										WHERE ext_html.id = html AND ext_html.type_of_external = 'html') AS html,
+									views, publication, status, publish_at,
+									(SELECT COUNT(*) FROM Archive.Article AS article
+										WHERE article.issue = safe_issues.id AND NOT article.n0lle_safe) AS hidden
 									FROM (safe_issues FULL JOIN (
 										SELECT id AS coverpage, hosted_url
 											FROM Archive.External
 											WHERE type_of_external = 'image'
 										) AS ext
 										USING(coverpage))
-									WHERE id=$1`, issueID)
-		if err != nil {
+									WHERE id=$1 AND ($2 OR `+issuePublished+`)`, issueID, drafts)
+		if errors.Is(err, sql.ErrNoRows) {
+			// told apart by whether it's there when not hiding anything
+			if _, err := db.GetIssue(issueID, false, drafts); err != nil {
+				return issue, err
+			}
+			return issue, ErrHidden
+		} else if err != nil {
 			log.Println(err)
 			return issue, err
 		}
 	} else {
-		err := db.Get(&issue, `SELECT id, title, publishing_date, hosted_url AS coverpage, views
+		err := db.Get(&issue, `SELECT id, title, publishing_date, hosted_url AS coverpage,
+										(SELECT ext_pdf.hosted_url FROM Archive.External AS ext_pdf
+											WHERE ext_pdf.id = pdf AND ext_pdf.type_of_external = 'pdf') AS pdf,
+										(SELECT ext_html.hosted_url FROM Archive.External AS ext_html
+											WHERE ext_html.id = html AND ext_html.type_of_external = 'html') AS html,
+										views, publication, status, publish_at
 									FROM (Archive.Issue FULL JOIN (
 										SELECT id AS coverpage, hosted_url
 											FROM Archive.External
 											WHERE type_of_external = 'image'
 										) AS ext
 										USING(coverpage))
-									WHERE id=$1`, issueID)
+									WHERE id=$1 AND ($2 OR `+issuePublished+`)`, issueID, drafts)
 
-		if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return issue, ErrNotFound
+		} else if err != nil {
 			log.Println(err)
 			return issue, err
 		}
@@ -72,7 +120,12 @@ func GetIssue(db *sqlx.DB, issueID int, darkmode bool) (HomeIssue, error) {
 }
 
 // haha.
-func GetHomeIssues(db *sqlx.DB, darkmode bool) ([]HomeIssue, error) {
+func (db *Postgres) GetHomeIssues(darkmode bool, drafts bool) ([]HomeIssue, error) {
+	return db.GetPublicationIssues(Dbuggen, darkmode, drafts)
+}
+
+// Gets all issues of a publication, newest first.
+func (db *Postgres) GetPublicationIssues(publication Publication, darkmode bool, drafts bool) ([]HomeIssue, error) {
 	issues := []HomeIssue{}
 
 	if darkmode { // if the mörkläggning is active
@@ -81,31 +134,48 @@ func GetHomeIssues(db *sqlx.DB, darkmode bool) ([]HomeIssue, error) {
 											WHERE id IN
 												(SELECT issue FROM Archive.Article
 													WHERE n0lle_safe = TRUE)
+											OR NOT EXISTS
+												(SELECT 1 FROM Archive.Article
+													WHERE Article.issue = Issue.id)
 									)
-									SELECT id, title, publishing_date, hosted_url AS coverpage, views
+									SELECT id, title, publishing_date, hosted_url AS coverpage,
+										(SELECT ext_pdf.hosted_url FROM Archive.External AS ext_pdf
+											WHERE ext_pdf.id = pdf AND ext_pdf.type_of_external = 'pdf') AS pdf,
+										(SELECT ext_html.hosted_url FROM Archive.External AS ext_html
+											WHERE ext_html.id = html AND ext_html.type_of_external = 'html') AS html,
+										views, publication, status, publish_at,
+										(SELECT COUNT(*) FROM Archive.Article AS article
+											WHERE article.issue = safe_issues.id AND NOT article.n0lle_safe) AS hidden
 										FROM (safe_issues FULL JOIN (
 											SELECT id AS coverpage, hosted_url
 												FROM Archive.External
 												WHERE type_of_external = 'image'
 											) AS ext
 											USING(coverpage))
-										WHERE id IS NOT NULL
-										ORDER BY publishing_date DESC`)
+										WHERE id IS NOT NULL AND publication=$1
+											AND ($2 OR `+issuePublished+`)
+										ORDER BY publishing_date DESC`, publication, drafts)
 
 		if err != nil {
 			log.Println(err)
 			return issues, err
 		}
 	} else {
-		err := db.Select(&issues, `SELECT id, title, publishing_date, hosted_url AS coverpage, views
+		err := db.Select(&issues, `SELECT id, title, publishing_date, hosted_url AS coverpage,
+										(SELECT ext_pdf.hosted_url FROM Archive.External AS ext_pdf
+											WHERE ext_pdf.id = pdf AND ext_pdf.type_of_external = 'pdf') AS pdf,
+										(SELECT ext_html.hosted_url FROM Archive.External AS ext_html
+											WHERE ext_html.id = html AND ext_html.type_of_external = 'html') AS html,
+										views, publication, status, publish_at
 									FROM (Archive.Issue FULL JOIN (
 										SELECT id AS coverpage, hosted_url
 											FROM Archive.External
 											WHERE type_of_external = 'image'
 										) AS ext
 										USING(coverpage))
-									WHERE id IS NOT NULL
-									ORDER BY publishing_date DESC`)
+									WHERE id IS NOT NULL AND publication=$1
+										AND ($2 OR `+issuePublished+`)
+									ORDER BY publishing_date DESC`, publication, drafts)
 
 		if err != nil {
 			log.Println(err)
@@ -116,20 +186,20 @@ func GetHomeIssues(db *sqlx.DB, darkmode bool) ([]HomeIssue, error) {
 	return issues, nil
 }
 
-// Gets all articles in a certain issue. Will return an error if any article
-// is not nØllesafe.
-func GetArticles(db *sqlx.DB, issue int, darkmode bool) ([]Article, error) {
+// Gets all articles in a certain issue. During the mörkläggning the articles
+// which aren't nØllesafe are hidden, see Hide.
+func (db *Postgres) GetArticles(issue int, darkmode bool) ([]Article, error) {
 	var articles []Article
 
-	if err := db.Select(&articles, `SELECT * FROM Archive.Article WHERE issue=$1`, issue); err != nil {
+	if err := db.Select(&articles, `SELECT * FROM Archive.Article WHERE issue=$1 ORDER BY issue_index ASC`, issue); err != nil {
 		log.Println(err)
 		return articles, err
 	}
 
 	if darkmode {
-		for _, article := range articles {
+		for i, article := range articles {
 			if !article.N0lleSafe {
-				return articles, errors.New("not safe")
+				articles[i] = article.Hide()
 			}
 		}
 	}
@@ -137,26 +207,27 @@ func GetArticles(db *sqlx.DB, issue int, darkmode bool) ([]Article, error) {
 	return articles, nil
 }
 
-func GetArticle(db *sqlx.DB, issueID int, index int, darkmode bool) (Article, error) {
+func (db *Postgres) GetArticle(issueID int, index int, darkmode bool, drafts bool) (Article, error) {
 	var article Article
 
-	if darkmode {
-		if err := db.Get(&article, `SELECT * FROM Archive.Article
-										WHERE issue=$1
-											AND issue_index=$2
-											AND issue IN (
-												SELECT id FROM Archive.Issue
-													WHERE id IN (
-														SELECT issue FROM Archive.Article
-															WHERE n0lle_safe = TRUE))`, issueID, index); err != nil {
-			log.Println(err)
-			return article, err
-		}
-	} else {
-		if err := db.Get(&article, "SELECT * FROM Archive.Article WHERE issue=$1 AND issue_index=$2", issueID, index); err != nil {
-			log.Println(err)
-			return article, err
+	if err := db.Get(&article, `SELECT * FROM Archive.Article
+									WHERE issue=$1
+										AND issue_index=$2
+										AND (NOT $3 OR n0lle_safe = TRUE)
+										AND issue IN (
+											SELECT id FROM Archive.Issue
+												WHERE $4 OR `+issuePublished+`)`, issueID, index, darkmode, drafts); errors.Is(err, sql.ErrNoRows) {
+		if darkmode {
+			// told apart by whether it's there when not hiding anything
+			if _, err := db.GetArticle(issueID, index, false, drafts); err != nil {
+				return article, err
+			}
+			return article, ErrHidden
 		}
+		return article, ErrNotFound
+	} else if err != nil {
+		log.Println(err)
+		return article, err
 	}
 
 	return article, nil
@@ -164,7 +235,7 @@ func GetArticle(db *sqlx.DB, issueID int, index int, darkmode bool) (Article, er
 
 // Creates a list of all authors who've contributed to an issue. Lists them in
 // the order of which articles they've written.
-func GetAuthorsForIssue(db *sqlx.DB, issueID int) ([][]Author, error) {
+func (db *Postgres) GetAuthorsForIssue(issueID int) ([][]Author, error) {
 	type authoredArticle struct {
 		IssueIndex   int            `db:"issue_index"`
 		KthID        string         `db:"kth_id"`
@@ -201,7 +272,7 @@ func GetAuthorsForIssue(db *sqlx.DB, issueID int) ([][]Author, error) {
 	return authors, nil
 }
 
-func GetAuthorsForArticle(db *sqlx.DB, article int) ([]Author, error) {
+func (db *Postgres) GetAuthorsForArticle(article int) ([]Author, error) {
 	var authors []Author
 	err := db.Select(&authors, `SELECT kth_id, prefered_name FROM
 								(Archive.Member LEFT JOIN Archive.AuthoredBy USING(kth_id))
@@ -214,7 +285,7 @@ func GetAuthorsForArticle(db *sqlx.DB, article int) ([]Author, error) {
 	return authors, nil
 }
 
-func GetActiveMembers(db *sqlx.DB) ([]Member, error) {
+func (db *Postgres) GetActiveMembers() ([]Member, error) {
 	var members []Member
 	err := db.Select(&members, `SELECT kth_id, prefered_name, hosted_url, title, active
 									FROM (Archive.Member FULL JOIN (
@@ -231,3 +302,630 @@ func GetActiveMembers(db *sqlx.DB) ([]Member, error) {
 
 	return members, nil
 }
+
+// Gets every member, active or not, ordered by kth id. Used when choosing
+// authors in the admin pages.
+func (db *Postgres) GetMembers() ([]Member, error) {
+	var members []Member
+	err := db.Select(&members, `SELECT kth_id, prefered_name, hosted_url, COALESCE(title, '') AS title, active
+									FROM (Archive.Member LEFT JOIN (
+											SELECT id AS picture, hosted_url
+												FROM Archive.External
+												WHERE type_of_external = 'image'
+											) AS ext USING(picture))
+										ORDER BY kth_id ASC`)
+
+	if err != nil {
+		log.Println(err)
+		return members, err
+	}
+
+	return members, nil
+}
+
+// Gets a single article by its id, regardless of darkmode. Only meant for
+// the admin pages.
+func (db *Postgres) GetArticleByID(articleID int) (Article, error) {
+	var article Article
+	if err := db.Get(&article, "SELECT * FROM Archive.Article WHERE id=$1", articleID); err != nil {
+		log.Println(err)
+		return article, err
+	}
+
+	return article, nil
+}
+
+// Creates a new issue as a draft, so that nobody sees it before it's
+// ready, and returns its id.
+func (db *Postgres) CreateIssue(title string, publishingDate time.Time, publication Publication) (int, error) {
+	var id int
+	err := db.Get(&id, `INSERT INTO Archive.Issue (title, publishing_date, views, publication, status)
+							VALUES ($1, $2, 0, $3, 'draft')
+							RETURNING id`, title, publishingDate, publication)
+	if err != nil {
+		log.Println(err)
+		return id, err
+	}
+
+	return id, nil
+}
+
+// Gives ErrNotFound if there is no such issue
+func (db *Postgres) UpdateIssue(issueID int, title string, publishingDate time.Time, publication Publication) error {
+	result, err := db.Exec(`UPDATE Archive.Issue SET title=$2, publishing_date=$3, publication=$4 WHERE id=$1`,
+		issueID, title, publishingDate, publication)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	if updated, err := result.RowsAffected(); err == nil && updated == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Publishes, schedules or unpublishes an issue. publishAt is only used for
+// scheduled issues. Gives ErrNotFound if there is no such issue.
+func (db *Postgres) SetIssueStatus(issueID int, status IssueStatus, publishAt sql.NullTime) error {
+	result, err := db.Exec(`UPDATE Archive.Issue SET status=$2, publish_at=$3 WHERE id=$1`, issueID, status, publishAt)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	if updated, err := result.RowsAffected(); err == nil && updated == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Creates a new article last in the given issue and returns it.
+func (db *Postgres) CreateArticle(issueID int, title string, authorText sql.NullString, content string, n0lleSafe bool) (Article, error) {
+	var article Article
+	err := db.Get(&article, `INSERT INTO Archive.Article
+								(title, issue, author_text, issue_index, content, last_edited, n0lle_safe)
+								VALUES (
+									$2, $1, $3,
+									(SELECT COALESCE(MAX(issue_index), -1) + 1 FROM Archive.Article WHERE issue=$1),
+									$4, CURRENT_DATE, $5)
+								RETURNING *`, issueID, title, authorText, content, n0lleSafe)
+	if err != nil {
+		log.Println(err)
+		return article, err
+	}
+
+	return article, nil
+}
+
+// Saves the title, author text, content and nØllesafety of an article as
+// changed by editor, keeping the new version as a revision so that it can
+// be restored later. The issue and index are left alone, use
+// ReorderArticles for that.
+func (db *Postgres) UpdateArticle(article Article, editor string) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer tx.Rollback()
+
+	// articles from before revisions were kept get their old version saved
+	// first, so that it isn't lost
+	_, err = tx.Exec(`INSERT INTO Archive.ArticleRevision (article, title, content, edited_by, edited_at)
+						SELECT id, title, content, NULL, last_edited
+							FROM Archive.Article
+							WHERE id=$1 AND NOT EXISTS (
+								SELECT 1 FROM Archive.ArticleRevision WHERE article=$1)`, article.ID)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	result, err := tx.Exec(`UPDATE Archive.Article
+							SET title=$2, author_text=$3, content=$4, n0lle_safe=$5, last_edited=CURRENT_DATE
+							WHERE id=$1`,
+		article.ID, article.Title, article.AuthorText, article.Content, article.N0lleSafe)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	if updated, err := result.RowsAffected(); err == nil && updated == 0 {
+		return sql.ErrNoRows
+	}
+
+	_, err = tx.Exec(`INSERT INTO Archive.ArticleRevision (article, title, content, edited_by, edited_at)
+						VALUES ($1, $2, $3, $4, NOW())`,
+		article.ID, article.Title, article.Content, sql.NullString{String: editor, Valid: editor != ""})
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Every saved version of an article, newest first
+func (db *Postgres) GetRevisions(articleID int) ([]Revision, error) {
+	revisions := []Revision{}
+	err := db.Select(&revisions, `SELECT * FROM Archive.ArticleRevision
+									WHERE article=$1
+									ORDER BY edited_at DESC, id DESC`, articleID)
+	if err != nil {
+		log.Println(err)
+		return revisions, err
+	}
+
+	return revisions, nil
+}
+
+func (db *Postgres) GetRevision(revisionID int) (Revision, error) {
+	var revision Revision
+	if err := db.Get(&revision, "SELECT * FROM Archive.ArticleRevision WHERE id=$1", revisionID); err != nil {
+		log.Println(err)
+		return revision, err
+	}
+
+	return revision, nil
+}
+
+// Deletes an article and moves the articles after it up one step, so that
+// the issue indices stay without gaps.
+func (db *Postgres) DeleteArticle(articleID int) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer tx.Rollback()
+
+	var deleted Article
+	if err := tx.Get(&deleted, "DELETE FROM Archive.Article WHERE id=$1 RETURNING *", articleID); err != nil {
+		log.Println(err)
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE Archive.Article SET issue_index = issue_index - 1
+						WHERE issue=$1 AND issue_index > $2`, deleted.Issue, deleted.IssueIndex)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Sets the order of the articles in an issue. articleIDs has to contain
+// every article in the issue, and the article at position i gets issue
+// index i.
+func (db *Postgres) ReorderArticles(issueID int, articleIDs []int) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer tx.Rollback()
+
+	var count int
+	if err := tx.Get(&count, "SELECT COUNT(*) FROM Archive.Article WHERE issue=$1", issueID); err != nil {
+		log.Println(err)
+		return err
+	}
+	if count != len(articleIDs) {
+		return fmt.Errorf("issue %v has %v articles, got an order of %v", issueID, count, len(articleIDs))
+	}
+
+	// otherwise an article given twice could make up for one left out
+	seen := make(map[int]bool, len(articleIDs))
+	for _, id := range articleIDs {
+		if seen[id] {
+			return fmt.Errorf("article %v is in the order twice", id)
+		}
+		seen[id] = true
+	}
+
+	for i, id := range articleIDs {
+		res, err := tx.Exec("UPDATE Archive.Article SET issue_index=$3 WHERE id=$1 AND issue=$2", id, issueID, i)
+		if err != nil {
+			log.Println(err)
+			return err
+		}
+		if n, _ := res.RowsAffected(); n != 1 {
+			return fmt.Errorf("article %v is not in issue %v", id, issueID)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Gives ErrUnknownMember if kthID isn't a member, and ErrNotFound if there
+// is no such article
+func (db *Postgres) AddAuthor(articleID int, kthID string) error {
+	_, err := db.Exec(`INSERT INTO Archive.AuthoredBy (article_id, kth_id) VALUES ($1, $2)
+							ON CONFLICT DO NOTHING`, articleID, kthID)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+		if pqErr.Constraint == "authoredby_kth_id_fkey" {
+			return fmt.Errorf("%w: %v", ErrUnknownMember, kthID)
+		}
+		return ErrNotFound
+	}
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+func (db *Postgres) RemoveAuthor(articleID int, kthID string) error {
+	_, err := db.Exec("DELETE FROM Archive.AuthoredBy WHERE article_id=$1 AND kth_id=$2", articleID, kthID)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// Checks whether someone is an active member of redaqtionen, which is what
+// is needed to use the admin pages.
+func (db *Postgres) IsActiveMember(kthID string) (bool, error) {
+	var active bool
+	err := db.Get(&active, "SELECT EXISTS (SELECT 1 FROM Archive.Member WHERE kth_id=$1 AND active = true)", kthID)
+	if err != nil {
+		log.Println(err)
+		return false, err
+	}
+
+	return active, nil
+}
+
+// Adds views to issues, with views mapping issue ids to how many new views
+// they've had. Everything is written in a single statement, so that the
+// views can be batched up instead of updating once per page load.
+func (db *Postgres) IncrementViews(views map[int]int) error {
+	if len(views) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(views))
+	counts := make([]int64, 0, len(views))
+	for id, count := range views {
+		ids = append(ids, int64(id))
+		counts = append(counts, int64(count))
+	}
+
+	_, err := db.Exec(`UPDATE Archive.Issue AS issue
+							SET views = COALESCE(issue.views, 0) + new.views
+							FROM unnest($1::int[], $2::int[]) AS new(id, views)
+							WHERE issue.id = new.id`, pq.Array(ids), pq.Array(counts))
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// Gets a single member of redaqtionen, active or not.
+func (db *Postgres) GetMember(kthID string) (Member, error) {
+	var member Member
+	err := db.Get(&member, `SELECT kth_id, prefered_name, hosted_url, COALESCE(title, '') AS title, active
+								FROM (Archive.Member LEFT JOIN (
+										SELECT id AS picture, hosted_url
+											FROM Archive.External
+											WHERE type_of_external = 'image'
+										) AS ext USING(picture))
+									WHERE kth_id=$1`, kthID)
+
+	if err != nil {
+		log.Println(err)
+		return member, err
+	}
+
+	return member, nil
+}
+
+// Gets every article a member has authored, newest issue first. During the
+// mörkläggning only the nØllesafe articles are included.
+func (db *Postgres) GetArticlesByAuthor(kthID string, darkmode bool, drafts bool) ([]AuthoredArticle, error) {
+	articles := []AuthoredArticle{}
+	err := db.Select(&articles, `SELECT article.id, article.title, issue.id AS issue_id, article.issue_index,
+									issue.title AS issue_title, issue.publishing_date
+									FROM Archive.AuthoredBy AS authored
+										JOIN Archive.Article AS article ON article.id = authored.article_id
+										JOIN Archive.Issue AS issue ON issue.id = article.issue
+									WHERE authored.kth_id=$1
+										AND (NOT $2 OR article.n0lle_safe = TRUE)
+										AND ($3 OR `+issuePublished+`)
+									ORDER BY issue.publishing_date DESC, article.issue_index ASC`, kthID, darkmode, drafts)
+
+	if err != nil {
+		log.Println(err)
+		return articles, err
+	}
+
+	return articles, nil
+}
+
+// Searches the titles and contents of all articles, best matches first,
+// returning at most limit results after skipping offset of them. Also
+// returns how many results there are in total. During the mörkläggning
+// the same articles as for GetArticle are searched.
+func (db *Postgres) SearchArticles(query string, darkmode bool, drafts bool, limit int, offset int) ([]SearchResult, int, error) {
+	type searchRow struct {
+		SearchResult
+		Total int
+	}
+
+	var rows []searchRow
+	err := db.Select(&rows, `WITH query AS (SELECT websearch_to_tsquery('swedish', $1) AS q)
+								SELECT article.id, article.title, article.issue AS issue_id, article.issue_index,
+									issue.title AS issue_title, issue.publishing_date,
+									ts_headline('swedish', article.content, query.q,
+										'StartSel=`+SnippetStart+`, StopSel=`+SnippetStop+`, MaxWords=35, MinWords=15, MaxFragments=2')
+										AS snippet,
+									ts_rank(Archive.article_search(article.title, article.content), query.q) AS rank,
+									COUNT(*) OVER () AS total
+									FROM query, Archive.Article AS article
+										JOIN Archive.Issue AS issue ON issue.id = article.issue
+									WHERE Archive.article_search(article.title, article.content) @@ query.q
+										AND (NOT $2 OR article.n0lle_safe = TRUE)
+										AND ($3 OR `+issuePublished+`)
+									ORDER BY rank DESC, issue.publishing_date DESC, article.issue_index ASC
+									LIMIT $4 OFFSET $5`, query, darkmode, drafts, limit, offset)
+
+	if err != nil {
+		log.Println(err)
+		return []SearchResult{}, 0, err
+	}
+
+	results := make([]SearchResult, len(rows))
+	total := 0
+	for i, row := range rows {
+		results[i] = row.SearchResult
+		total = row.Total
+	}
+
+	return results, total, nil
+}
+
+// Saves an uploaded image and its smaller versions, returning the id it got
+func (db *Postgres) CreateImage(image External, sizes []ExternalSize) (int, error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.Get(&id, `INSERT INTO Archive.External
+							(hosted_url, type_of_external, width, height, filename, uploaded_by, uploaded_at)
+							VALUES ($1, 'image', $2, $3, $4, $5, $6)
+							RETURNING id`,
+		image.HostedURL, image.Width, image.Height, image.Filename, image.UploadedBy, image.UploadedAt)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+
+	for _, size := range sizes {
+		_, err := tx.Exec(`INSERT INTO Archive.ExternalSize (external, width, height, hosted_url) VALUES ($1, $2, $3, $4)`,
+			id, size.Width, size.Height, size.HostedURL)
+		if err != nil {
+			log.Println(err)
+			return 0, err
+		}
+	}
+
+	return id, tx.Commit()
+}
+
+// Every image, the most recently uploaded first and those from before the
+// media library last
+func (db *Postgres) GetImages() ([]Image, error) {
+	return db.images(`SELECT * FROM Archive.External
+						WHERE type_of_external='image'
+						ORDER BY uploaded_at DESC NULLS LAST, id DESC`)
+}
+
+func (db *Postgres) GetImage(externalID int) (Image, error) {
+	images, err := db.images("SELECT * FROM Archive.External WHERE id=$1 AND type_of_external='image'", externalID)
+	if err != nil {
+		return Image{}, err
+	}
+	if len(images) == 0 {
+		return Image{}, sql.ErrNoRows
+	}
+
+	return images[0], nil
+}
+
+// The images hosted at any of the urls. Urls which aren't images are left
+// out.
+func (db *Postgres) GetImagesByURL(urls []string) ([]Image, error) {
+	return db.images(`SELECT * FROM Archive.External
+						WHERE type_of_external='image' AND hosted_url = ANY($1)
+						ORDER BY id`, pq.Array(urls))
+}
+
+// The images selected by the query, along with their smaller versions and
+// the articles using them
+func (db *Postgres) images(query string, args ...any) ([]Image, error) {
+	var externals []External
+	if err := db.Select(&externals, query, args...); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	images := make([]Image, len(externals))
+	ids := make([]int64, len(externals))
+	index := make(map[int]int, len(externals))
+	for i, external := range externals {
+		images[i] = Image{External: external}
+		ids[i] = int64(external.ID)
+		index[external.ID] = i
+	}
+	if len(images) == 0 {
+		return images, nil
+	}
+
+	var sizes []ExternalSize
+	err := db.Select(&sizes, "SELECT * FROM Archive.ExternalSize WHERE external = ANY($1) ORDER BY width", pq.Array(ids))
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	for _, size := range sizes {
+		i := index[size.External]
+		images[i].Sizes = append(images[i].Sizes, size)
+	}
+
+	var used []PictureUsedInArticle
+	err = db.Select(&used, `SELECT * FROM Archive.PictureUsedInArticle
+								WHERE picture_id = ANY($1)
+								ORDER BY article_id`, pq.Array(ids))
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	for _, u := range used {
+		i := index[u.PictureID]
+		images[i].Articles = append(images[i].Articles, u.ArticleID)
+	}
+
+	return images, nil
+}
+
+// Sets the text describing an image, or removes it if alt is empty
+func (db *Postgres) SetImageAltText(externalID int, altText string) error {
+	result, err := db.Exec(`UPDATE Archive.External SET alt_text=$2 WHERE id=$1 AND type_of_external='image'`,
+		externalID, sql.NullString{String: altText, Valid: altText != ""})
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	if updated, err := result.RowsAffected(); err == nil && updated == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// Replaces which images an article uses
+func (db *Postgres) SetPicturesUsedInArticle(articleID int, pictureIDs []int) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM Archive.PictureUsedInArticle WHERE article_id=$1", articleID); err != nil {
+		log.Println(err)
+		return err
+	}
+
+	for _, pictureID := range pictureIDs {
+		_, err := tx.Exec(`INSERT INTO Archive.PictureUsedInArticle (article_id, picture_id) VALUES ($1, $2)
+								ON CONFLICT DO NOTHING`, articleID, pictureID)
+		if err != nil {
+			log.Println(err)
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// The html an article was rendered to, as long as it was rendered from
+// content with the same hash. Anything else gives sql.ErrNoRows.
+func (db *Postgres) GetRenderedArticle(articleID int, contentHash []byte) (RenderedArticle, error) {
+	var rendered RenderedArticle
+	err := db.Get(&rendered, `SELECT article, content_hash, html FROM Archive.RenderedArticle
+								WHERE article=$1 AND content_hash=$2`, articleID, contentHash)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Println(err)
+	}
+	return rendered, err
+}
+
+// Saves the html of an article, replacing that of any earlier revision
+func (db *Postgres) SaveRenderedArticle(rendered RenderedArticle) error {
+	_, err := db.Exec(`INSERT INTO Archive.RenderedArticle (article, content_hash, html) VALUES ($1, $2, $3)
+							ON CONFLICT (article) DO UPDATE
+							SET content_hash = EXCLUDED.content_hash, html = EXCLUDED.html`,
+		rendered.ArticleID, rendered.ContentHash, rendered.HTML)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+func (db *Postgres) ClearRenderedArticles() error {
+	_, err := db.Exec("DELETE FROM Archive.RenderedArticle")
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// Every name which has been looked up from hodis
+func (db *Postgres) GetHodisNames() ([]HodisName, error) {
+	var names []HodisName
+	err := db.Select(&names, "SELECT kth_id, display_name, fetched_at FROM Archive.HodisName")
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return names, nil
+}
+
+// Saves a name looked up from hodis, replacing any earlier lookup
+func (db *Postgres) SaveHodisName(name HodisName) error {
+	_, err := db.Exec(`INSERT INTO Archive.HodisName (kth_id, display_name, fetched_at) VALUES ($1, $2, $3)
+							ON CONFLICT (kth_id) DO UPDATE
+							SET display_name = EXCLUDED.display_name, fetched_at = EXCLUDED.fetched_at`,
+		name.KthID, name.DisplayName, name.FetchedAt)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// The darkmode override, which is to follow darkmode unless anyone has said
+// otherwise
+func (db *Postgres) GetDarkmodeOverride() (DarkmodeOverride, error) {
+	var override DarkmodeOverride
+	err := db.Get(&override, "SELECT mode, changed_by, changed_at FROM Archive.DarkmodeOverride")
+	if errors.Is(err, sql.ErrNoRows) {
+		return DarkmodeOverride{Mode: DarkmodeFollow}, nil
+	} else if err != nil {
+		log.Println(err)
+		return override, err
+	}
+
+	return override, nil
+}
+
+func (db *Postgres) SetDarkmodeOverride(override DarkmodeOverride) error {
+	_, err := db.Exec(`INSERT INTO Archive.DarkmodeOverride (mode, changed_by, changed_at) VALUES ($1, $2, $3)
+							ON CONFLICT (only_row) DO UPDATE
+							SET mode = EXCLUDED.mode, changed_by = EXCLUDED.changed_by, changed_at = EXCLUDED.changed_at`,
+		override.Mode, override.ChangedBy, override.ChangedAt)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
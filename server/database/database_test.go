@@ -0,0 +1,863 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Connects to the database in TEST_DATABASE_URL, migrates it from scratch
+// and fills it with the test data. Everything in the database is thrown
+// away, so never point it at anything but a database for testing. Tests
+// needing the database are skipped if it isn't set.
+func testDB(t *testing.T) *Postgres {
+	t.Helper()
+
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	db, err := sqlx.Connect("postgres", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	_, err = db.Exec("DROP SCHEMA IF EXISTS Archive CASCADE; DROP TABLE IF EXISTS " + migrationsTable)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := MigrateUp(db, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	testdata, err := os.ReadFile("testdata.psql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(string(testdata)); err != nil {
+		t.Fatal(err)
+	}
+
+	return &Postgres{db}
+}
+
+// Runs the test against both Memory and Postgres, filled with the same test
+// data, to make sure that they behave the same.
+func forEachStore(t *testing.T, test func(t *testing.T, store Store)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, Testdata())
+	})
+	t.Run("postgres", func(t *testing.T) {
+		test(t, testDB(t))
+	})
+}
+
+func issueViews(t *testing.T, store Store, issueID int) int {
+	t.Helper()
+
+	issues, err := store.GetIssues()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, issue := range issues {
+		if issue.ID == issueID {
+			return issue.Views
+		}
+	}
+
+	t.Fatalf("there is no issue %v", issueID)
+	return 0
+}
+
+func TestIncrementViews(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		before0 := issueViews(t, store, 0)
+		before1 := issueViews(t, store, 1)
+
+		if err := store.IncrementViews(map[int]int{0: 3, 1: 1}); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := issueViews(t, store, 0); got != before0+3 {
+			t.Errorf("issue 0 has %v views, wanted %v", got, before0+3)
+		}
+		if got := issueViews(t, store, 1); got != before1+1 {
+			t.Errorf("issue 1 has %v views, wanted %v", got, before1+1)
+		}
+	})
+}
+
+func TestIncrementViewsNull(t *testing.T) {
+	store := testDB(t)
+
+	if _, err := store.Exec("UPDATE Archive.Issue SET views = NULL WHERE id=0"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.IncrementViews(map[int]int{0: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := issueViews(t, store, 0); got != 2 {
+		t.Errorf("issue 0 has %v views, wanted 2", got)
+	}
+}
+
+func TestIncrementViewsMissingIssue(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		before := issueViews(t, store, 0)
+		if err := store.IncrementViews(map[int]int{0: 1, 1000: 5}); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := issueViews(t, store, 0); got != before+1 {
+			t.Errorf("issue 0 has %v views, wanted %v", got, before+1)
+		}
+	})
+}
+
+func TestIncrementViewsEmpty(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		before := issueViews(t, store, 0)
+		if err := store.IncrementViews(map[int]int{}); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := issueViews(t, store, 0); got != before {
+			t.Errorf("issue 0 has %v views, wanted %v", got, before)
+		}
+	})
+}
+
+func TestGetArticlesByAuthor(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		ids := func(articles []AuthoredArticle) []int {
+			var ids []int
+			for _, a := range articles {
+				ids = append(ids, a.ID)
+			}
+			return ids
+		}
+
+		cases := []struct {
+			kthID    string
+			darkmode bool
+			expected []int
+		}{
+			{"testsupp", false, []int{2, 0}},
+			{"testsupp", true, []int{0}},
+			{"frblo", false, []int{0, 1}},
+			{"frblo", true, []int{0, 1}},
+			{"nobody", false, nil},
+		}
+
+		for _, tc := range cases {
+			articles, err := store.GetArticlesByAuthor(tc.kthID, tc.darkmode, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := ids(articles); !slices.Equal(got, tc.expected) {
+				t.Errorf("articles by %v with darkmode %v are %v, wanted %v", tc.kthID, tc.darkmode, got, tc.expected)
+			}
+		}
+	})
+}
+
+func TestGetMember(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		member, err := store.GetMember("testsupp")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if member.PreferedName.String != "BULL" || member.Title != "slave" {
+			t.Errorf("got %v, wanted BULL the slave", member)
+		}
+
+		if _, err := store.GetMember("nobody"); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("got %v for a missing member, wanted %v", err, sql.ErrNoRows)
+		}
+	})
+}
+
+func TestGetPublicationIssues(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		ids := func(issues []HomeIssue) []int {
+			var ids []int
+			for _, i := range issues {
+				ids = append(ids, i.ID)
+			}
+			return ids
+		}
+
+		dbuggen, err := store.GetHomeIssues(false, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := ids(dbuggen); !slices.Equal(got, []int{1, 0}) {
+			t.Errorf("dbuggen issues are %v, wanted [1 0]", got)
+		}
+
+		dtugget, err := store.GetPublicationIssues(Dtugget, false, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := ids(dtugget); !slices.Equal(got, []int{2}) {
+			t.Errorf("dtugget issues are %v, wanted [2]", got)
+		}
+	})
+}
+
+// Makes the second article of Testdbuggen not nØllesafe, so that the issue
+// is only partly hidden during darkmode
+func hideSecondArticle(t *testing.T, store Store) {
+	t.Helper()
+
+	article, err := store.GetArticleByID(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	article.N0lleSafe = false
+	if err := store.UpdateArticle(article, "frblo"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Publishes an issue without any articles, like one which is only a pdf,
+// which has nothing for darkmode to hide
+func emptyIssue(t *testing.T, store Store) int {
+	t.Helper()
+
+	id, err := store.CreateIssue("Tomdbuggen", time.Date(2024, time.September, 1, 0, 0, 0, 0, time.UTC), Dbuggen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetIssueStatus(id, IssuePublished, sql.NullTime{}); err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestGetIssueDarkmode(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		hideSecondArticle(t, store)
+
+		issue, err := store.GetIssue(0, true, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if issue.Hidden != 1 {
+			t.Errorf("got %v hidden articles in Testdbuggen, wanted 1", issue.Hidden)
+		}
+
+		issue, err = store.GetIssue(0, false, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if issue.Hidden != 0 {
+			t.Errorf("got %v hidden articles without darkmode, wanted 0", issue.Hidden)
+		}
+
+		// Skojdbuggen has nothing nØllesafe in it
+		if _, err := store.GetIssue(1, true, false); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("got %v for Skojdbuggen during darkmode, wanted sql.ErrNoRows", err)
+		}
+
+		issue, err = store.GetIssue(emptyIssue(t, store), true, false)
+		if err != nil {
+			t.Fatalf("got %v for an issue without articles during darkmode", err)
+		}
+		if issue.Hidden != 0 {
+			t.Errorf("got %v hidden articles in an issue without articles, wanted 0", issue.Hidden)
+		}
+	})
+}
+
+func TestGetPublicationIssuesDarkmode(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		hideSecondArticle(t, store)
+
+		issues, err := store.GetHomeIssues(true, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(issues) != 1 || issues[0].ID != 0 {
+			t.Fatalf("got %v during darkmode, wanted only Testdbuggen", issues)
+		}
+		if issues[0].Hidden != 1 {
+			t.Errorf("got %v hidden articles in Testdbuggen, wanted 1", issues[0].Hidden)
+		}
+
+		dtugget, err := store.GetPublicationIssues(Dtugget, true, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(dtugget) != 1 || dtugget[0].Hidden != 0 {
+			t.Errorf("got %v, wanted Sommardtugget with nothing hidden", dtugget)
+		}
+
+		id := emptyIssue(t, store)
+		issues, err = store.GetHomeIssues(true, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(issues) != 2 || issues[0].ID != id || issues[0].Hidden != 0 {
+			t.Errorf("got %v during darkmode, wanted the issue without articles first with nothing hidden", issues)
+		}
+	})
+}
+
+func TestGetArticlesDarkmode(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		hideSecondArticle(t, store)
+
+		articles, err := store.GetArticles(0, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(articles) != 2 {
+			t.Fatalf("got %v articles, wanted both with one of them hidden", len(articles))
+		}
+		if articles[0].Title != "ledare" || !articles[0].N0lleSafe {
+			t.Errorf("the nØllesafe article was changed: %+v", articles[0])
+		}
+		if hidden := articles[1]; hidden.Title != "" || hidden.Content != "" || hidden.AuthorText.Valid || hidden.IssueIndex != 1 {
+			t.Errorf("the article which isn't nØllesafe wasn't hidden: %+v", hidden)
+		}
+
+		articles, err = store.GetArticles(0, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if articles[1].Title != "bästa toan att ta koks i på KTH" {
+			t.Errorf("got %+v without darkmode, wanted the whole article", articles[1])
+		}
+
+		if _, err := store.GetArticle(0, 0, true, false); err != nil {
+			t.Errorf("got %v for a nØllesafe article", err)
+		}
+		if _, err := store.GetArticle(0, 1, true, false); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("got %v for a hidden article, wanted sql.ErrNoRows", err)
+		}
+		if _, err := store.GetArticle(0, 1, false, false); err != nil {
+			t.Errorf("got %v for an article without darkmode", err)
+		}
+
+		articles, err = store.GetArticles(emptyIssue(t, store), true)
+		if err != nil || len(articles) != 0 {
+			t.Errorf("got %v and %v for an issue without articles, wanted nothing", articles, err)
+		}
+	})
+}
+
+func TestStoreErrors(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		hideSecondArticle(t, store)
+
+		for name, err := range map[string]error{
+			"a missing issue":                 second(store.GetIssue(100, false, false)),
+			"a missing article":               second(store.GetArticle(0, 100, true, false)),
+			"a scheduled issue":               second(store.GetIssue(3, true, false)),
+			"an article in a draft":           second(store.GetArticle(3, 0, true, false)),
+			"updating a missing issue":        store.UpdateIssue(100, "Spökdbuggen", time.Date(2024, time.October, 31, 0, 0, 0, 0, time.UTC), Dbuggen),
+			"publishing a missing issue":      store.SetIssueStatus(100, IssuePublished, sql.NullTime{}),
+			"an author for a missing article": store.AddAuthor(100, "frblo"),
+		} {
+			if !errors.Is(err, ErrNotFound) || !errors.Is(err, sql.ErrNoRows) || KindOf(err) != NotFound {
+				t.Errorf("got %v for %v, wanted it not found", err, name)
+			}
+		}
+
+		// Skojdbuggen has nothing nØllesafe in it
+		for name, err := range map[string]error{
+			"Skojdbuggen":      second(store.GetIssue(1, true, false)),
+			"a hidden article": second(store.GetArticle(0, 1, true, false)),
+		} {
+			if !errors.Is(err, ErrHidden) || !errors.Is(err, sql.ErrNoRows) || KindOf(err) != Hidden {
+				t.Errorf("got %v for %v during darkmode, wanted it hidden", err, name)
+			}
+		}
+
+		if err := store.AddAuthor(0, "nollan"); !errors.Is(err, ErrUnknownMember) {
+			t.Errorf("got %v for an author who isn't a member, wanted ErrUnknownMember", err)
+		}
+	})
+
+	if kind := KindOf(errors.New("the database is on fire")); kind != Internal {
+		t.Errorf("got %v for an unknown error, wanted %v", kind, Internal)
+	}
+}
+
+// The error of something giving two values
+func second[T any](_ T, err error) error {
+	return err
+}
+
+func TestGetIssueExternals(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		issue, err := store.GetIssue(0, false, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !issue.Pdf.Valid || issue.Pdf.String != "https://dbuggen.s3.eu-west-1.amazonaws.com/dbuggen2/dbuggen-var-2024.pdf" {
+			t.Errorf("got pdf %v for issue 0", issue.Pdf)
+		}
+		if issue.Html.Valid {
+			t.Errorf("got html %v for issue 0, which has none", issue.Html)
+		}
+
+		issue, err = store.GetIssue(1, false, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if issue.Pdf.Valid {
+			t.Errorf("got pdf %v for issue 1, which has none", issue.Pdf)
+		}
+	})
+}
+
+func TestSearchArticles(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		results, total, err := store.SearchArticles("kör hårt", false, false, 10, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != 1 || len(results) != 1 || results[0].ID != 1 {
+			t.Fatalf("got %v results in total, %v, wanted only article 1", total, results)
+		}
+		if !strings.Contains(results[0].Snippet, SnippetStart) {
+			t.Errorf("the snippet %q doesn't mark where it matched", results[0].Snippet)
+		}
+
+		// "lugnt" is only in article 2, which isn't nØllesafe
+		_, total, err = store.SearchArticles("lugnt", false, false, 10, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != 1 {
+			t.Errorf("got %v results without darkmode, wanted 1", total)
+		}
+
+		results, total, err = store.SearchArticles("lugnt", true, false, 10, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != 0 || len(results) != 0 {
+			t.Errorf("got %v results during darkmode, wanted none", results)
+		}
+	})
+}
+
+func TestSearchArticlesPagination(t *testing.T) {
+	store := testDB(t)
+
+	query := "kul or lugnt or tillbaka"
+	first, total, err := store.SearchArticles(query, false, false, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total < 2 {
+		t.Fatalf("got %v results in total, wanted at least 2 to paginate", total)
+	}
+
+	second, _, err := store.SearchArticles(query, false, false, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first) != 1 || len(second) != 1 || first[0].ID == second[0].ID {
+		t.Errorf("the pages %v and %v should be different single results", first, second)
+	}
+}
+
+func TestHodisNames(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		fetched := time.Date(2024, time.August, 19, 12, 0, 0, 0, time.UTC)
+		found := HodisName{"frblo", sql.NullString{String: "Fredrik Blomqvist", Valid: true}, fetched}
+		if err := store.SaveHodisName(found); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.SaveHodisName(HodisName{"nollan", sql.NullString{}, fetched}); err != nil {
+			t.Fatal(err)
+		}
+
+		// saving again replaces the earlier lookup
+		found.FetchedAt = fetched.Add(time.Hour)
+		if err := store.SaveHodisName(found); err != nil {
+			t.Fatal(err)
+		}
+
+		names, err := store.GetHodisNames()
+		if err != nil {
+			t.Fatal(err)
+		}
+		slices.SortFunc(names, func(a, b HodisName) int { return strings.Compare(a.KthID, b.KthID) })
+
+		if len(names) != 2 {
+			t.Fatalf("got %v names, wanted 2", names)
+		}
+		if names[0].KthID != "frblo" || names[0].DisplayName != found.DisplayName || !names[0].FetchedAt.Equal(found.FetchedAt) {
+			t.Errorf("got %+v, wanted %+v", names[0], found)
+		}
+		if names[1].KthID != "nollan" || names[1].DisplayName.Valid {
+			t.Errorf("got %+v, wanted a failed lookup of nollan", names[1])
+		}
+	})
+}
+
+func TestDarkmodeOverride(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		override, err := store.GetDarkmodeOverride()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if override.Mode != DarkmodeFollow {
+			t.Errorf("got %v before anyone changed it, wanted %v", override.Mode, DarkmodeFollow)
+		}
+
+		changed := time.Date(2024, time.August, 19, 12, 0, 0, 0, time.UTC)
+		for _, mode := range []DarkmodeMode{DarkmodeForceOn, DarkmodeForceOff} {
+			set := DarkmodeOverride{mode, sql.NullString{String: "frblo", Valid: true}, changed}
+			if err := store.SetDarkmodeOverride(set); err != nil {
+				t.Fatal(err)
+			}
+
+			override, err := store.GetDarkmodeOverride()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if override.Mode != mode || override.ChangedBy != set.ChangedBy || !override.ChangedAt.Equal(changed) {
+				t.Errorf("got %+v, wanted %+v", override, set)
+			}
+		}
+	})
+}
+
+func TestIssueStatus(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		// Framtidsdbuggen is scheduled for 2100
+		if _, err := store.GetIssue(3, false, false); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("got %v for a scheduled issue, wanted sql.ErrNoRows", err)
+		}
+		if _, err := store.GetArticle(3, 0, false, false); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("got %v for an article in a scheduled issue, wanted sql.ErrNoRows", err)
+		}
+		if issues, _ := store.GetHomeIssues(false, false); slices.ContainsFunc(issues, func(i HomeIssue) bool { return i.ID == 3 }) {
+			t.Error("the scheduled issue is listed")
+		}
+		if articles, _ := store.GetArticlesByAuthor("frblo", false, false); slices.ContainsFunc(articles, func(a AuthoredArticle) bool { return a.ID == 4 }) {
+			t.Error("the article in the scheduled issue is listed for its author")
+		}
+		if _, total, _ := store.SearchArticles("hemlig", false, false, 10, 0); total != 0 {
+			t.Error("the article in the scheduled issue can be searched for")
+		}
+
+		// but redaqtionen sees it
+		issue, err := store.GetIssue(3, false, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if issue.Status != IssueScheduled || issue.Published(time.Now()) {
+			t.Errorf("got status %v, wanted it scheduled", issue.Status)
+		}
+		if _, err := store.GetArticle(3, 0, false, true); err != nil {
+			t.Errorf("got %v for an article in a scheduled issue with drafts", err)
+		}
+		if issues, _ := store.GetHomeIssues(false, true); !slices.ContainsFunc(issues, func(i HomeIssue) bool { return i.ID == 3 }) {
+			t.Error("the scheduled issue isn't listed with drafts")
+		}
+
+		// once it's time it comes out by itself
+		past := sql.NullTime{Time: time.Now().Add(-time.Minute), Valid: true}
+		if err := store.SetIssueStatus(3, IssueScheduled, past); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.GetIssue(3, false, false); err != nil {
+			t.Errorf("got %v for an issue scheduled in the past", err)
+		}
+
+		if err := store.SetIssueStatus(0, IssueDraft, sql.NullTime{}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.GetIssue(0, false, false); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("got %v for an issue turned back into a draft, wanted sql.ErrNoRows", err)
+		}
+	})
+}
+
+func TestCreateIssueDraft(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		id, err := store.CreateIssue("Nydbuggen", time.Date(2024, time.September, 1, 0, 0, 0, 0, time.UTC), Dbuggen)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := store.GetIssue(id, false, false); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("got %v for a new issue, wanted it to be a draft", err)
+		}
+		issue, err := store.GetIssue(id, false, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if issue.Status != IssueDraft {
+			t.Errorf("got status %v for a new issue, wanted %v", issue.Status, IssueDraft)
+		}
+	})
+}
+
+func TestCreateIssueConcurrently(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		ids := make([]int, 10)
+		errs := make([]error, len(ids))
+
+		var wg sync.WaitGroup
+		for i := range ids {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ids[i], errs[i] = store.CreateIssue("Samtidigdbuggen", time.Date(2024, time.September, 1, 0, 0, 0, 0, time.UTC), Dbuggen)
+			}()
+		}
+		wg.Wait()
+
+		if err := errors.Join(errs...); err != nil {
+			t.Fatal(err)
+		}
+		slices.Sort(ids)
+		if len(slices.Compact(ids)) != len(errs) {
+			t.Errorf("got the ids %v, wanted them all different", ids)
+		}
+	})
+}
+
+func TestReorderArticles(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		order := func() []int {
+			t.Helper()
+			articles, err := store.GetArticles(0, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			slices.SortFunc(articles, func(a, b Article) int { return a.IssueIndex - b.IssueIndex })
+
+			var ids []int
+			for _, article := range articles {
+				ids = append(ids, article.ID)
+			}
+			return ids
+		}
+
+		if err := store.ReorderArticles(0, []int{1, 0}); err != nil {
+			t.Fatal(err)
+		}
+		if got := order(); !slices.Equal(got, []int{1, 0}) {
+			t.Errorf("got the order %v, wanted [1 0]", got)
+		}
+
+		// the right number of articles, but one of them twice
+		if err := store.ReorderArticles(0, []int{0, 0}); err == nil {
+			t.Error("got no error for an order with an article twice")
+		}
+		if err := store.ReorderArticles(0, []int{0, 3}); err == nil {
+			t.Error("got no error for an order with an article from another issue")
+		}
+		if got := order(); !slices.Equal(got, []int{1, 0}) {
+			t.Errorf("got the order %v after the bad ones, wanted it unchanged", got)
+		}
+	})
+}
+
+func TestRevisions(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		article, err := store.GetArticleByID(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		original := article.Content
+
+		article.Content = "det här är **ännu roligare**."
+		if err := store.UpdateArticle(article, "frblo"); err != nil {
+			t.Fatal(err)
+		}
+		article.Title = "ledare 2"
+		if err := store.UpdateArticle(article, "testsupp"); err != nil {
+			t.Fatal(err)
+		}
+
+		revisions, err := store.GetRevisions(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(revisions) != 3 {
+			t.Fatalf("got %v revisions, wanted the original and two edits", len(revisions))
+		}
+
+		newest, oldest := revisions[0], revisions[2]
+		if newest.Title != "ledare 2" || newest.EditedBy.String != "testsupp" {
+			t.Errorf("unexpected newest revision %+v", newest)
+		}
+		if oldest.Content != original || oldest.EditedBy.Valid {
+			t.Errorf("got %+v, wanted the version from before revisions were kept", oldest)
+		}
+
+		revision, err := store.GetRevision(revisions[1].ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if revision.Content != "det här är **ännu roligare**." || revision.EditedBy.String != "frblo" {
+			t.Errorf("unexpected revision %+v", revision)
+		}
+
+		if err := store.UpdateArticle(Article{ID: 1000, Title: "finns inte"}, "frblo"); err == nil {
+			t.Error("expected an error updating an article which doesn't exist")
+		}
+
+		if err := store.DeleteArticle(0); err != nil {
+			t.Fatal(err)
+		}
+		if revisions, _ := store.GetRevisions(0); len(revisions) != 0 {
+			t.Errorf("got %v revisions of a deleted article", len(revisions))
+		}
+	})
+}
+
+func TestImages(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		uploaded := time.Date(2024, 9, 1, 12, 0, 0, 0, time.UTC)
+		id, err := store.CreateImage(External{
+			HostedURL:  "https://example.com/images/abc/original.jpg",
+			Width:      sql.NullInt32{Int32: 1000, Valid: true},
+			Height:     sql.NullInt32{Int32: 500, Valid: true},
+			Filename:   sql.NullString{String: "bild.jpg", Valid: true},
+			UploadedBy: sql.NullString{String: "frblo", Valid: true},
+			UploadedAt: sql.NullTime{Time: uploaded, Valid: true},
+		}, []ExternalSize{
+			{Width: 960, Height: 480, HostedURL: "https://example.com/images/abc/960.jpg"},
+			{Width: 200, Height: 100, HostedURL: "https://example.com/images/abc/200.jpg"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != 3 {
+			t.Errorf("got id %v, wanted the next free one", id)
+		}
+
+		if err := store.SetPicturesUsedInArticle(0, []int{id, 1}); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.SetPicturesUsedInArticle(1, []int{id}); err != nil {
+			t.Fatal(err)
+		}
+
+		image, err := store.GetImage(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if image.Filename.String != "bild.jpg" || image.Width.Int32 != 1000 || !image.UploadedAt.Time.Equal(uploaded) {
+			t.Errorf("unexpected image %+v", image.External)
+		}
+		if len(image.Sizes) != 2 || image.Thumbnail() != "https://example.com/images/abc/200.jpg" {
+			t.Errorf("got sizes %+v, wanted the smallest first", image.Sizes)
+		}
+		if !slices.Equal(image.Articles, []int{0, 1}) {
+			t.Errorf("got the image used in %v, wanted [0 1]", image.Articles)
+		}
+
+		images, err := store.GetImages()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []int
+		for _, image := range images {
+			ids = append(ids, image.ID)
+		}
+		if !slices.Equal(ids, []int{3, 1, 0}) {
+			t.Errorf("got images %v, wanted the uploaded one first and no pdfs", ids)
+		}
+		if images[1].Thumbnail() != images[1].HostedURL || !slices.Equal(images[1].Articles, []int{0}) {
+			t.Errorf("unexpected image from before the media library %+v", images[1])
+		}
+
+		// saving the article again replaces what it uses
+		if err := store.SetPicturesUsedInArticle(0, nil); err != nil {
+			t.Fatal(err)
+		}
+		if image, _ := store.GetImage(id); !slices.Equal(image.Articles, []int{1}) {
+			t.Errorf("got the image used in %v, wanted [1]", image.Articles)
+		}
+
+		if _, err := store.GetImage(2); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("got %v getting a pdf as an image, wanted sql.ErrNoRows", err)
+		}
+	})
+}
+
+func TestImageAltText(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		if err := store.SetImageAltText(1, "en märke"); err != nil {
+			t.Fatal(err)
+		}
+
+		images, err := store.GetImagesByURL([]string{
+			"https://dbuggen.s3.eu-west-1.amazonaws.com/dbuggen2/marke.png",
+			"https://dbuggen.s3.eu-west-1.amazonaws.com/dbuggen2/dbuggen-var-2024.pdf",
+			"https://example.com/finns-inte.png",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(images) != 1 || images[0].ID != 1 || images[0].AltText.String != "en märke" {
+			t.Fatalf("got %+v, wanted only the image with its alt text", images)
+		}
+
+		if err := store.SetImageAltText(1, ""); err != nil {
+			t.Fatal(err)
+		}
+		if image, _ := store.GetImage(1); image.AltText.Valid {
+			t.Errorf("got alt text %q, wanted it removed", image.AltText.String)
+		}
+
+		if err := store.SetImageAltText(2, "en pdf"); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("got %v setting the alt text of a pdf, wanted sql.ErrNoRows", err)
+		}
+	})
+}
+
+func TestRenderedArticles(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		first := RenderedArticle{ArticleID: 1, ContentHash: []byte{1}, HTML: "<p>första</p>"}
+		if err := store.SaveRenderedArticle(first); err != nil {
+			t.Fatal(err)
+		}
+		if rendered, err := store.GetRenderedArticle(1, []byte{1}); err != nil || rendered.HTML != first.HTML {
+			t.Errorf("got %+v, %v, wanted the saved html", rendered, err)
+		}
+
+		// a new revision replaces the old one
+		if err := store.SaveRenderedArticle(RenderedArticle{ArticleID: 1, ContentHash: []byte{2}, HTML: "<p>andra</p>"}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.GetRenderedArticle(1, []byte{1}); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("got %v for the old revision, wanted sql.ErrNoRows", err)
+		}
+		if rendered, err := store.GetRenderedArticle(1, []byte{2}); err != nil || rendered.HTML != "<p>andra</p>" {
+			t.Errorf("got %+v, %v, wanted the new revision", rendered, err)
+		}
+
+		if err := store.ClearRenderedArticles(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.GetRenderedArticle(1, []byte{2}); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("got %v after clearing, wanted sql.ErrNoRows", err)
+		}
+	})
+}
@@ -0,0 +1,76 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// What kind of thing went wrong asking a Store for something
+type ErrorKind int
+
+const (
+	// Anything else, like the database not answering
+	Internal ErrorKind = iota
+	// It doesn't exist, or isn't published yet
+	NotFound
+	// It's there, but hidden since it isn't nØllesafe during mörkläggningen
+	Hidden
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case NotFound:
+		return "not found"
+	case Hidden:
+		return "hidden by darkmode"
+	default:
+		return "internal error"
+	}
+}
+
+// Error is an error of a known kind from a Store. The NotFound and Hidden
+// ones are also sql.ErrNoRows, so checking for that still works.
+type Error struct {
+	Kind ErrorKind
+	Err  error
+}
+
+var (
+	ErrNotFound = &Error{Kind: NotFound, Err: sql.ErrNoRows}
+	ErrHidden   = &Error{Kind: Hidden, Err: sql.ErrNoRows}
+)
+
+// ErrUnknownMember is given for adding an author who isn't a member, which
+// is a mistake in what was asked for rather than something going wrong
+var ErrUnknownMember = errors.New("there is no such member")
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return e.Kind.String()
+	}
+	return e.Kind.String() + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Errors of the same kind are the same, so errors.Is(err, ErrHidden) works
+// for any Hidden error
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Kind == e.Kind
+}
+
+// KindOf tells what kind of error err is. sql.ErrNoRows on its own is
+// NotFound, and anything without a kind is Internal.
+func KindOf(err error) ErrorKind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return NotFound
+	}
+	return Internal
+}
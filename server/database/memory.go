@@ -0,0 +1,885 @@
+package database
+
+import (
+	"bytes"
+	"cmp"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Memory is a Store which keeps everything in memory, meant for tests. It
+// is filled by setting its fields directly, which work like the tables of
+// the same names, and it behaves like Postgres down to the darkmode
+// filtering.
+type Memory struct {
+	Externals            []External
+	ExternalSizes        []ExternalSize
+	Issues               []Issue
+	Articles             []Article
+	Members              []Member
+	AuthoredBy           []AuthoredBy
+	PictureUsedInArticle []PictureUsedInArticle
+	HodisNames           []HodisName
+	Revisions            []Revision
+	RenderedArticles     []RenderedArticle
+	// Following darkmode if the mode is empty
+	DarkmodeOverride DarkmodeOverride
+
+	mutex sync.RWMutex
+}
+
+func (m *Memory) GetIssues() ([]Issue, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	issues := slices.Clone(m.Issues)
+	slices.SortStableFunc(issues, func(a, b Issue) int { return b.PublishingDate.Compare(a.PublishingDate) })
+	return issues, nil
+}
+
+func (m *Memory) GetIssue(issueID int, darkmode bool, drafts bool) (HomeIssue, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	i := slices.IndexFunc(m.Issues, func(issue Issue) bool { return issue.ID == issueID })
+	if i == -1 || !m.issuePublished(issueID, drafts) {
+		return HomeIssue{}, ErrNotFound
+	}
+	if !m.issueVisible(issueID, darkmode, drafts) {
+		return HomeIssue{}, ErrHidden
+	}
+
+	return m.homeIssue(m.Issues[i], darkmode), nil
+}
+
+func (m *Memory) GetHomeIssues(darkmode bool, drafts bool) ([]HomeIssue, error) {
+	return m.GetPublicationIssues(Dbuggen, darkmode, drafts)
+}
+
+func (m *Memory) GetPublicationIssues(publication Publication, darkmode bool, drafts bool) ([]HomeIssue, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	issues := []HomeIssue{}
+	for _, issue := range m.Issues {
+		if issue.Publication == publication && m.issueVisible(issue.ID, darkmode, drafts) {
+			issues = append(issues, m.homeIssue(issue, darkmode))
+		}
+	}
+
+	slices.SortStableFunc(issues, func(a, b HomeIssue) int { return b.PublishingDate.Compare(a.PublishingDate) })
+	return issues, nil
+}
+
+func (m *Memory) GetArticles(issue int, darkmode bool) ([]Article, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	articles := m.issueArticles(issue)
+	if darkmode {
+		for i, article := range articles {
+			if !article.N0lleSafe {
+				articles[i] = article.Hide()
+			}
+		}
+	}
+
+	return articles, nil
+}
+
+func (m *Memory) GetArticle(issueID int, index int, darkmode bool, drafts bool) (Article, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	for _, article := range m.Articles {
+		if article.Issue == issueID && article.IssueIndex == index && m.issuePublished(issueID, drafts) {
+			if darkmode && !article.N0lleSafe {
+				return Article{}, ErrHidden
+			}
+			return article, nil
+		}
+	}
+
+	return Article{}, ErrNotFound
+}
+
+func (m *Memory) GetArticleByID(articleID int) (Article, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	i := slices.IndexFunc(m.Articles, func(article Article) bool { return article.ID == articleID })
+	if i == -1 {
+		return Article{}, sql.ErrNoRows
+	}
+
+	return m.Articles[i], nil
+}
+
+func (m *Memory) GetAuthorsForIssue(issueID int) ([][]Author, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	var authors [][]Author
+	for _, article := range m.issueArticles(issueID) {
+		articleAuthors := m.articleAuthors(article.ID)
+		if len(articleAuthors) == 0 {
+			continue
+		}
+
+		for len(authors) <= article.IssueIndex {
+			authors = append(authors, nil)
+		}
+		authors[article.IssueIndex] = append(authors[article.IssueIndex], articleAuthors...)
+	}
+
+	return authors, nil
+}
+
+func (m *Memory) GetAuthorsForArticle(article int) ([]Author, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return m.articleAuthors(article), nil
+}
+
+func (m *Memory) GetArticlesByAuthor(kthID string, darkmode bool, drafts bool) ([]AuthoredArticle, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	articles := []AuthoredArticle{}
+	for _, authored := range m.AuthoredBy {
+		if authored.KthID != kthID {
+			continue
+		}
+
+		i := slices.IndexFunc(m.Articles, func(article Article) bool { return article.ID == authored.ArticleID })
+		if i == -1 || (darkmode && !m.Articles[i].N0lleSafe) || !m.issuePublished(m.Articles[i].Issue, drafts) {
+			continue
+		}
+
+		if authoredArticle, ok := m.authoredArticle(m.Articles[i]); ok {
+			articles = append(articles, authoredArticle)
+		}
+	}
+
+	slices.SortFunc(articles, func(a, b AuthoredArticle) int {
+		return cmp.Or(b.PublishingDate.Compare(a.PublishingDate), cmp.Compare(a.IssueIndex, b.IssueIndex))
+	})
+	return articles, nil
+}
+
+// Searches for articles containing every word of the query, in the title or
+// the content, ignoring case. Articles are ranked by how many times the
+// words appear, where appearing in the title counts more.
+func (m *Memory) SearchArticles(query string, darkmode bool, drafts bool, limit int, offset int) ([]SearchResult, int, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	words := strings.Fields(strings.ToLower(query))
+	if len(words) == 0 {
+		return []SearchResult{}, 0, nil
+	}
+
+	results := []SearchResult{}
+	for _, article := range m.Articles {
+		if (darkmode && !article.N0lleSafe) || !m.issuePublished(article.Issue, drafts) {
+			continue
+		}
+
+		title := strings.ToLower(article.Title)
+		content := strings.ToLower(article.Content)
+		rank := 0.0
+		for _, word := range words {
+			inTitle := strings.Count(title, word)
+			inContent := strings.Count(content, word)
+			if inTitle+inContent == 0 {
+				rank = 0
+				break
+			}
+			rank += float64(2*inTitle + inContent)
+		}
+		if rank == 0 {
+			continue
+		}
+
+		authoredArticle, ok := m.authoredArticle(article)
+		if !ok {
+			continue
+		}
+		results = append(results, SearchResult{
+			AuthoredArticle: authoredArticle,
+			Snippet:         memorySnippet(article.Content, words),
+			Rank:            rank,
+		})
+	}
+
+	slices.SortStableFunc(results, func(a, b SearchResult) int {
+		return cmp.Or(cmp.Compare(b.Rank, a.Rank), b.PublishingDate.Compare(a.PublishingDate), cmp.Compare(a.IssueIndex, b.IssueIndex))
+	})
+
+	total := len(results)
+	results = results[min(offset, total):min(offset+limit, total)]
+	return results, total, nil
+}
+
+func (m *Memory) GetActiveMembers() ([]Member, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	var members []Member
+	for _, member := range m.Members {
+		if member.Active {
+			members = append(members, member)
+		}
+	}
+
+	return members, nil
+}
+
+func (m *Memory) GetMembers() ([]Member, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	members := slices.Clone(m.Members)
+	slices.SortFunc(members, func(a, b Member) int { return strings.Compare(a.KthID, b.KthID) })
+	return members, nil
+}
+
+func (m *Memory) GetMember(kthID string) (Member, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	i := slices.IndexFunc(m.Members, func(member Member) bool { return member.KthID == kthID })
+	if i == -1 {
+		return Member{}, sql.ErrNoRows
+	}
+
+	return m.Members[i], nil
+}
+
+func (m *Memory) IsActiveMember(kthID string) (bool, error) {
+	member, err := m.GetMember(kthID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return member.Active, err
+}
+
+func (m *Memory) CreateIssue(title string, publishingDate time.Time, publication Publication) (int, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	id := 0
+	for _, issue := range m.Issues {
+		id = max(id, issue.ID+1)
+	}
+
+	m.Issues = append(m.Issues, Issue{
+		ID:             id,
+		Title:          title,
+		PublishingDate: publishingDate,
+		Publication:    publication,
+		Status:         IssueDraft,
+	})
+	return id, nil
+}
+
+func (m *Memory) UpdateIssue(issueID int, title string, publishingDate time.Time, publication Publication) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	i := slices.IndexFunc(m.Issues, func(issue Issue) bool { return issue.ID == issueID })
+	if i == -1 {
+		return ErrNotFound
+	}
+
+	m.Issues[i].Title = title
+	m.Issues[i].PublishingDate = publishingDate
+	m.Issues[i].Publication = publication
+
+	return nil
+}
+
+func (m *Memory) SetIssueStatus(issueID int, status IssueStatus, publishAt sql.NullTime) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	i := slices.IndexFunc(m.Issues, func(issue Issue) bool { return issue.ID == issueID })
+	if i == -1 {
+		return ErrNotFound
+	}
+
+	m.Issues[i].Status = status
+	m.Issues[i].PublishAt = publishAt
+
+	return nil
+}
+
+func (m *Memory) IncrementViews(views map[int]int) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for i := range m.Issues {
+		m.Issues[i].Views += views[m.Issues[i].ID]
+	}
+
+	return nil
+}
+
+func (m *Memory) CreateArticle(issueID int, title string, authorText sql.NullString, content string, n0lleSafe bool) (Article, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if !slices.ContainsFunc(m.Issues, func(issue Issue) bool { return issue.ID == issueID }) {
+		return Article{}, fmt.Errorf("there is no issue %v", issueID)
+	}
+
+	id, index := 0, 0
+	for _, article := range m.Articles {
+		id = max(id, article.ID+1)
+		if article.Issue == issueID {
+			index = max(index, article.IssueIndex+1)
+		}
+	}
+
+	article := Article{
+		ID:         id,
+		Title:      title,
+		Issue:      issueID,
+		AuthorText: authorText,
+		IssueIndex: index,
+		Content:    content,
+		LastEdited: today(),
+		N0lleSafe:  n0lleSafe,
+	}
+	m.Articles = append(m.Articles, article)
+	return article, nil
+}
+
+func (m *Memory) UpdateArticle(article Article, editor string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	i := slices.IndexFunc(m.Articles, func(a Article) bool { return a.ID == article.ID })
+	if i == -1 {
+		return sql.ErrNoRows
+	}
+
+	old := m.Articles[i]
+	if !slices.ContainsFunc(m.Revisions, func(r Revision) bool { return r.Article == article.ID }) {
+		m.addRevision(Revision{Article: old.ID, Title: old.Title, Content: old.Content, EditedAt: old.LastEdited})
+	}
+
+	m.Articles[i].Title = article.Title
+	m.Articles[i].AuthorText = article.AuthorText
+	m.Articles[i].Content = article.Content
+	m.Articles[i].N0lleSafe = article.N0lleSafe
+	m.Articles[i].LastEdited = today()
+
+	m.addRevision(Revision{
+		Article:  article.ID,
+		Title:    article.Title,
+		Content:  article.Content,
+		EditedBy: sql.NullString{String: editor, Valid: editor != ""},
+		EditedAt: time.Now(),
+	})
+	return nil
+}
+
+func (m *Memory) GetRevisions(articleID int) ([]Revision, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	revisions := []Revision{}
+	for _, revision := range m.Revisions {
+		if revision.Article == articleID {
+			revisions = append(revisions, revision)
+		}
+	}
+
+	slices.SortFunc(revisions, func(a, b Revision) int {
+		return cmp.Or(b.EditedAt.Compare(a.EditedAt), cmp.Compare(b.ID, a.ID))
+	})
+	return revisions, nil
+}
+
+func (m *Memory) GetRevision(revisionID int) (Revision, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	i := slices.IndexFunc(m.Revisions, func(r Revision) bool { return r.ID == revisionID })
+	if i == -1 {
+		return Revision{}, sql.ErrNoRows
+	}
+
+	return m.Revisions[i], nil
+}
+
+func (m *Memory) DeleteArticle(articleID int) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	i := slices.IndexFunc(m.Articles, func(article Article) bool { return article.ID == articleID })
+	if i == -1 {
+		return sql.ErrNoRows
+	}
+
+	deleted := m.Articles[i]
+	m.Articles = slices.Delete(m.Articles, i, i+1)
+	m.AuthoredBy = slices.DeleteFunc(m.AuthoredBy, func(a AuthoredBy) bool { return a.ArticleID == articleID })
+	m.Revisions = slices.DeleteFunc(m.Revisions, func(r Revision) bool { return r.Article == articleID })
+	m.PictureUsedInArticle = slices.DeleteFunc(m.PictureUsedInArticle, func(p PictureUsedInArticle) bool { return p.ArticleID == articleID })
+	m.RenderedArticles = slices.DeleteFunc(m.RenderedArticles, func(r RenderedArticle) bool { return r.ArticleID == articleID })
+
+	for j := range m.Articles {
+		if m.Articles[j].Issue == deleted.Issue && m.Articles[j].IssueIndex > deleted.IssueIndex {
+			m.Articles[j].IssueIndex--
+		}
+	}
+
+	return nil
+}
+
+func (m *Memory) ReorderArticles(issueID int, articleIDs []int) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	count := 0
+	for _, article := range m.Articles {
+		if article.Issue == issueID {
+			count++
+		}
+	}
+	if count != len(articleIDs) {
+		return fmt.Errorf("issue %v has %v articles, got an order of %v", issueID, count, len(articleIDs))
+	}
+
+	// otherwise an article given twice could make up for one left out
+	seen := make(map[int]bool, len(articleIDs))
+	for _, id := range articleIDs {
+		if seen[id] {
+			return fmt.Errorf("article %v is in the order twice", id)
+		}
+		seen[id] = true
+	}
+
+	indices := make(map[int]int)
+	for i, id := range articleIDs {
+		j := slices.IndexFunc(m.Articles, func(article Article) bool { return article.ID == id && article.Issue == issueID })
+		if j == -1 {
+			return fmt.Errorf("article %v is not in issue %v", id, issueID)
+		}
+		indices[j] = i
+	}
+
+	for j, i := range indices {
+		m.Articles[j].IssueIndex = i
+	}
+
+	return nil
+}
+
+func (m *Memory) AddAuthor(articleID int, kthID string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if !slices.ContainsFunc(m.Members, func(member Member) bool { return member.KthID == kthID }) {
+		return fmt.Errorf("%w: %v", ErrUnknownMember, kthID)
+	}
+	if !slices.ContainsFunc(m.Articles, func(article Article) bool { return article.ID == articleID }) {
+		return ErrNotFound
+	}
+
+	authored := AuthoredBy{articleID, kthID}
+	if !slices.Contains(m.AuthoredBy, authored) {
+		m.AuthoredBy = append(m.AuthoredBy, authored)
+	}
+
+	return nil
+}
+
+func (m *Memory) RemoveAuthor(articleID int, kthID string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.AuthoredBy = slices.DeleteFunc(m.AuthoredBy, func(a AuthoredBy) bool {
+		return a.ArticleID == articleID && a.KthID == kthID
+	})
+
+	return nil
+}
+
+func (m *Memory) CreateImage(image External, sizes []ExternalSize) (int, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	image.ID = 0
+	for _, external := range m.Externals {
+		image.ID = max(image.ID, external.ID+1)
+	}
+	image.TypeOfExternal = "image"
+	m.Externals = append(m.Externals, image)
+
+	for _, size := range sizes {
+		size.External = image.ID
+		m.ExternalSizes = append(m.ExternalSizes, size)
+	}
+
+	return image.ID, nil
+}
+
+func (m *Memory) GetImages() ([]Image, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	images := []Image{}
+	for _, external := range m.Externals {
+		if external.TypeOfExternal == "image" {
+			images = append(images, m.image(external))
+		}
+	}
+
+	slices.SortStableFunc(images, func(a, b Image) int {
+		return cmp.Or(compareUploaded(b.UploadedAt, a.UploadedAt), cmp.Compare(b.ID, a.ID))
+	})
+	return images, nil
+}
+
+func (m *Memory) GetImage(externalID int) (Image, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	i := slices.IndexFunc(m.Externals, func(e External) bool { return e.ID == externalID && e.TypeOfExternal == "image" })
+	if i == -1 {
+		return Image{}, sql.ErrNoRows
+	}
+
+	return m.image(m.Externals[i]), nil
+}
+
+func (m *Memory) GetImagesByURL(urls []string) ([]Image, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	images := []Image{}
+	for _, external := range m.Externals {
+		if external.TypeOfExternal == "image" && slices.Contains(urls, external.HostedURL) {
+			images = append(images, m.image(external))
+		}
+	}
+
+	slices.SortFunc(images, func(a, b Image) int { return cmp.Compare(a.ID, b.ID) })
+	return images, nil
+}
+
+func (m *Memory) SetImageAltText(externalID int, altText string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	i := slices.IndexFunc(m.Externals, func(e External) bool { return e.ID == externalID && e.TypeOfExternal == "image" })
+	if i == -1 {
+		return sql.ErrNoRows
+	}
+
+	m.Externals[i].AltText = sql.NullString{String: altText, Valid: altText != ""}
+	return nil
+}
+
+func (m *Memory) SetPicturesUsedInArticle(articleID int, pictureIDs []int) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.PictureUsedInArticle = slices.DeleteFunc(m.PictureUsedInArticle, func(p PictureUsedInArticle) bool { return p.ArticleID == articleID })
+	for _, pictureID := range pictureIDs {
+		used := PictureUsedInArticle{articleID, pictureID}
+		if !slices.Contains(m.PictureUsedInArticle, used) {
+			m.PictureUsedInArticle = append(m.PictureUsedInArticle, used)
+		}
+	}
+
+	return nil
+}
+
+func (m *Memory) GetHodisNames() ([]HodisName, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return slices.Clone(m.HodisNames), nil
+}
+
+func (m *Memory) GetRenderedArticle(articleID int, contentHash []byte) (RenderedArticle, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	i := slices.IndexFunc(m.RenderedArticles, func(r RenderedArticle) bool {
+		return r.ArticleID == articleID && bytes.Equal(r.ContentHash, contentHash)
+	})
+	if i == -1 {
+		return RenderedArticle{}, sql.ErrNoRows
+	}
+	return m.RenderedArticles[i], nil
+}
+
+func (m *Memory) SaveRenderedArticle(rendered RenderedArticle) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if !slices.ContainsFunc(m.Articles, func(a Article) bool { return a.ID == rendered.ArticleID }) {
+		return fmt.Errorf("there is no article %v", rendered.ArticleID)
+	}
+
+	i := slices.IndexFunc(m.RenderedArticles, func(r RenderedArticle) bool { return r.ArticleID == rendered.ArticleID })
+	if i == -1 {
+		m.RenderedArticles = append(m.RenderedArticles, rendered)
+	} else {
+		m.RenderedArticles[i] = rendered
+	}
+
+	return nil
+}
+
+func (m *Memory) ClearRenderedArticles() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.RenderedArticles = nil
+	return nil
+}
+
+func (m *Memory) SaveHodisName(name HodisName) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	i := slices.IndexFunc(m.HodisNames, func(n HodisName) bool { return n.KthID == name.KthID })
+	if i == -1 {
+		m.HodisNames = append(m.HodisNames, name)
+	} else {
+		m.HodisNames[i] = name
+	}
+
+	return nil
+}
+
+func (m *Memory) GetDarkmodeOverride() (DarkmodeOverride, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if m.DarkmodeOverride.Mode == "" {
+		return DarkmodeOverride{Mode: DarkmodeFollow}, nil
+	}
+	return m.DarkmodeOverride, nil
+}
+
+func (m *Memory) SetDarkmodeOverride(override DarkmodeOverride) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.DarkmodeOverride = override
+	return nil
+}
+
+// Whether an issue is shown, which is only once it's published unless
+// drafts are shown too, and during the mörkläggning only if it has at least
+// one nØllesafe article.
+func (m *Memory) issueVisible(issueID int, darkmode bool, drafts bool) bool {
+	if !m.issuePublished(issueID, drafts) {
+		return false
+	}
+	if !darkmode {
+		return true
+	}
+
+	articles := m.issueArticles(issueID)
+	return len(articles) == 0 || slices.ContainsFunc(articles, func(article Article) bool { return article.N0lleSafe })
+}
+
+func (m *Memory) issuePublished(issueID int, drafts bool) bool {
+	if drafts {
+		return true
+	}
+
+	i := slices.IndexFunc(m.Issues, func(issue Issue) bool { return issue.ID == issueID })
+	return i != -1 && m.Issues[i].Published(time.Now())
+}
+
+func (m *Memory) homeIssue(issue Issue, darkmode bool) HomeIssue {
+	hidden := 0
+	if darkmode {
+		for _, article := range m.issueArticles(issue.ID) {
+			if !article.N0lleSafe {
+				hidden++
+			}
+		}
+	}
+
+	return HomeIssue{
+		ID:             issue.ID,
+		Title:          issue.Title,
+		PublishingDate: issue.PublishingDate,
+		Coverpage:      m.externalURL(issue.Coverpage, "image"),
+		Pdf:            m.externalURL(issue.Pdf, "pdf"),
+		Html:           m.externalURL(issue.Html, "html"),
+		Views:          issue.Views,
+		Publication:    issue.Publication,
+		Hidden:         hidden,
+		Status:         issue.Status,
+		PublishAt:      issue.PublishAt,
+	}
+}
+
+func (m *Memory) externalURL(id sql.NullInt32, typeOfExternal string) sql.NullString {
+	if !id.Valid {
+		return sql.NullString{}
+	}
+
+	for _, external := range m.Externals {
+		if external.ID == int(id.Int32) && external.TypeOfExternal == typeOfExternal {
+			return sql.NullString{String: external.HostedURL, Valid: true}
+		}
+	}
+
+	return sql.NullString{}
+}
+
+func (m *Memory) image(external External) Image {
+	image := Image{External: external}
+	for _, size := range m.ExternalSizes {
+		if size.External == external.ID {
+			image.Sizes = append(image.Sizes, size)
+		}
+	}
+	slices.SortFunc(image.Sizes, func(a, b ExternalSize) int { return cmp.Compare(a.Width, b.Width) })
+
+	for _, used := range m.PictureUsedInArticle {
+		if used.PictureID == external.ID {
+			image.Articles = append(image.Articles, used.ArticleID)
+		}
+	}
+	slices.Sort(image.Articles)
+
+	return image
+}
+
+// Orders images without an upload time, from before the media library,
+// before those with one
+func compareUploaded(a, b sql.NullTime) int {
+	if a.Valid != b.Valid {
+		if a.Valid {
+			return 1
+		}
+		return -1
+	}
+	return a.Time.Compare(b.Time)
+}
+
+// Saves a revision with the next free id.
+func (m *Memory) addRevision(revision Revision) {
+	revision.ID = 0
+	for _, r := range m.Revisions {
+		revision.ID = max(revision.ID, r.ID+1)
+	}
+	m.Revisions = append(m.Revisions, revision)
+}
+
+// The articles of an issue, in order.
+func (m *Memory) issueArticles(issueID int) []Article {
+	var articles []Article
+	for _, article := range m.Articles {
+		if article.Issue == issueID {
+			articles = append(articles, article)
+		}
+	}
+
+	slices.SortFunc(articles, func(a, b Article) int { return cmp.Compare(a.IssueIndex, b.IssueIndex) })
+	return articles
+}
+
+func (m *Memory) articleAuthors(articleID int) []Author {
+	var authors []Author
+	for _, authored := range m.AuthoredBy {
+		if authored.ArticleID != articleID {
+			continue
+		}
+
+		i := slices.IndexFunc(m.Members, func(member Member) bool { return member.KthID == authored.KthID })
+		if i != -1 {
+			authors = append(authors, Author{m.Members[i].KthID, m.Members[i].PreferedName})
+		}
+	}
+
+	return authors
+}
+
+func (m *Memory) authoredArticle(article Article) (AuthoredArticle, bool) {
+	i := slices.IndexFunc(m.Issues, func(issue Issue) bool { return issue.ID == article.Issue })
+	if i == -1 {
+		return AuthoredArticle{}, false
+	}
+
+	return AuthoredArticle{
+		ID:             article.ID,
+		Title:          article.Title,
+		IssueID:        article.Issue,
+		IssueIndex:     article.IssueIndex,
+		IssueTitle:     m.Issues[i].Title,
+		PublishingDate: m.Issues[i].PublishingDate,
+	}, true
+}
+
+// A bit of the content around the first word of the search, with all the
+// words marked like ts_headline does.
+func memorySnippet(content string, words []string) string {
+	lower := strings.ToLower(content)
+	start := 0
+	for _, word := range words {
+		if i := strings.Index(lower, word); i != -1 {
+			start = max(0, i-60)
+			break
+		}
+	}
+	end := min(len(content), start+200)
+
+	// don't cut any characters in half
+	for start > 0 && !utf8.RuneStart(content[start]) {
+		start--
+	}
+	for end < len(content) && !utf8.RuneStart(content[end]) {
+		end++
+	}
+
+	snippet := content[start:end]
+	for _, word := range words {
+		snippet = markWord(snippet, word)
+	}
+	return snippet
+}
+
+// Surrounds every case insensitive occurrence of word in s with the
+// snippet markers.
+func markWord(s string, word string) string {
+	var sb strings.Builder
+	lower := strings.ToLower(s)
+	for {
+		i := strings.Index(lower, word)
+		if i == -1 || len(lower) != len(s) {
+			sb.WriteString(s)
+			return sb.String()
+		}
+
+		sb.WriteString(s[:i])
+		sb.WriteString(SnippetStart + s[i:i+len(word)] + SnippetStop)
+		s = s[i+len(word):]
+		lower = lower[i+len(word):]
+	}
+}
+
+func today() time.Time {
+	now := time.Now()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,288 @@
+package database
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"regexp"
+	"slices"
+	"strconv"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// The schema is built up by the migrations in the migrations directory.
+// Every migration has a version and comes as a pair of files, named
+// "<version>_<name>.up.sql" and "<version>_<name>.down.sql", where down
+// undoes what up does. The versions have to go 1, 2, 3... without gaps.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// The applied migrations are kept track of in this table. It's kept outside
+// of the Archive schema so that rolling back 0001, which drops the schema,
+// doesn't delete the record of which migrations have been applied.
+const migrationsTable = "public.schema_migrations"
+
+// Arbitrary, but unique, key for the advisory lock which stops two
+// instances from migrating at the same time.
+const migrationLock = 5318008
+
+var migrationName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Migrations returns every migration there is, ordered by version.
+func Migrations() ([]Migration, error) {
+	dir, err := fs.Sub(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	return parseMigrations(dir)
+}
+
+func parseMigrations(dir fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(dir, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := migrationName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("badly named migration %v", entry.Name())
+		}
+
+		version, err := strconv.Atoi(match[1])
+		if err != nil {
+			return nil, err
+		}
+
+		contents, err := fs.ReadFile(dir, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %v is named both %v and %v", version, m.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			m.Up = string(contents)
+		} else {
+			m.Down = string(contents)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		migrations = append(migrations, *m)
+	}
+	slices.SortFunc(migrations, func(a, b Migration) int { return a.Version - b.Version })
+
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration %v is missing", i+1)
+		}
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %v_%v needs both an up and a down", m.Version, m.Name)
+		}
+	}
+
+	return migrations, nil
+}
+
+// SchemaVersion returns the version of the latest applied migration, or 0
+// if none are.
+func SchemaVersion(db *sqlx.DB) (int, error) {
+	if err := createMigrationsTable(db); err != nil {
+		return 0, err
+	}
+
+	var version int
+	err := db.Get(&version, "SELECT COALESCE(MAX(version), 0) FROM "+migrationsTable)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+
+	return version, nil
+}
+
+// CheckSchema makes sure that every migration has been applied, and that
+// the database isn't from a newer version of dbuggen either.
+func CheckSchema(db *sqlx.DB) error {
+	migrations, err := Migrations()
+	if err != nil {
+		return err
+	}
+
+	version, err := SchemaVersion(db)
+	if err != nil {
+		return err
+	}
+
+	if version < len(migrations) {
+		return fmt.Errorf("the database schema is at version %v, but needs to be at %v. Run \"dbuggen migrate up\"", version, len(migrations))
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("the database schema is at version %v, which is newer than this version of dbuggen knows about (%v)", version, len(migrations))
+	}
+
+	return nil
+}
+
+// MigrateUp applies the given number of migrations which haven't been
+// applied yet, or all of them if steps is 0 or less.
+func MigrateUp(db *sqlx.DB, steps int) error {
+	migrations, err := Migrations()
+	if err != nil {
+		return err
+	}
+
+	version, err := SchemaVersion(db)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations[min(version, len(migrations)):] {
+		if steps == 0 {
+			break
+		}
+		steps--
+
+		err := inMigration(db, func(tx *sqlx.Tx, current int) error {
+			if current != m.Version-1 {
+				return fmt.Errorf("can't apply migration %v to schema version %v", m.Version, current)
+			}
+
+			if _, err := tx.Exec(m.Up); err != nil {
+				return fmt.Errorf("migration %v_%v: %w", m.Version, m.Name, err)
+			}
+
+			_, err := tx.Exec("INSERT INTO "+migrationsTable+" (version, name) VALUES ($1, $2)", m.Version, m.Name)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		log.Printf("applied migration %v_%v", m.Version, m.Name)
+	}
+
+	return nil
+}
+
+// MigrateDown undoes the given number of the latest migrations.
+func MigrateDown(db *sqlx.DB, steps int) error {
+	migrations, err := Migrations()
+	if err != nil {
+		return err
+	}
+
+	for ; steps > 0; steps-- {
+		var undone Migration
+		err := inMigration(db, func(tx *sqlx.Tx, current int) error {
+			if current == 0 {
+				return errors.New("there are no migrations to undo")
+			}
+			if current > len(migrations) {
+				return fmt.Errorf("don't know how to undo migration %v", current)
+			}
+
+			undone = migrations[current-1]
+			if _, err := tx.Exec(undone.Down); err != nil {
+				return fmt.Errorf("migration %v_%v: %w", undone.Version, undone.Name, err)
+			}
+
+			_, err := tx.Exec("DELETE FROM "+migrationsTable+" WHERE version=$1", current)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		log.Printf("undid migration %v_%v", undone.Version, undone.Name)
+	}
+
+	return nil
+}
+
+// ForceVersion marks every migration up to and including version as
+// applied, and every one after as not applied, without running any of
+// them. Meant for databases which were set up before there were
+// migrations.
+func ForceVersion(db *sqlx.DB, version int) error {
+	migrations, err := Migrations()
+	if err != nil {
+		return err
+	}
+	if version < 0 || version > len(migrations) {
+		return fmt.Errorf("there is no migration %v", version)
+	}
+
+	return inMigration(db, func(tx *sqlx.Tx, current int) error {
+		if _, err := tx.Exec("DELETE FROM " + migrationsTable); err != nil {
+			return err
+		}
+
+		for _, m := range migrations[:version] {
+			_, err := tx.Exec("INSERT INTO "+migrationsTable+" (version, name) VALUES ($1, $2)", m.Version, m.Name)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func createMigrationsTable(db *sqlx.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS ` + migrationsTable + ` (
+							version    INT PRIMARY KEY,
+							name       TEXT NOT NULL,
+							applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+						)`)
+	if err != nil {
+		log.Println(err)
+	}
+	return err
+}
+
+// Runs f in a transaction, holding the migration lock and knowing the
+// current schema version.
+func inMigration(db *sqlx.DB, f func(tx *sqlx.Tx, current int) error) error {
+	if err := createMigrationsTable(db); err != nil {
+		return err
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1)", migrationLock); err != nil {
+		return err
+	}
+
+	var current int
+	if err := tx.Get(&current, "SELECT COALESCE(MAX(version), 0) FROM "+migrationsTable); err != nil {
+		return err
+	}
+
+	if err := f(tx, current); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
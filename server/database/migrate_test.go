@@ -0,0 +1,149 @@
+package database
+
+import (
+	"fmt"
+	"testing"
+	"testing/fstest"
+)
+
+func TestMigrations(t *testing.T) {
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(migrations) == 0 {
+		t.Fatal("there are no migrations")
+	}
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Errorf("migration %v has version %v", i+1, m.Version)
+		}
+	}
+}
+
+func TestParseMigrations(t *testing.T) {
+	file := func(s string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(s)} }
+
+	t.Run("ordered by version", func(t *testing.T) {
+		dir := fstest.MapFS{
+			"0002_second.up.sql":   file("up 2"),
+			"0002_second.down.sql": file("down 2"),
+			"0010_tenth.up.sql":    file("up 10"),
+			"0001_first.up.sql":    file("up 1"),
+			"0001_first.down.sql":  file("down 1"),
+		}
+		for i := 3; i < 10; i++ {
+			dir[fmt.Sprintf("%04d_filler.up.sql", i)] = file("up")
+			dir[fmt.Sprintf("%04d_filler.down.sql", i)] = file("down")
+		}
+		dir["0010_tenth.down.sql"] = file("down 10")
+
+		migrations, err := parseMigrations(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(migrations) != 10 {
+			t.Fatalf("got %v migrations, wanted 10", len(migrations))
+		}
+		if migrations[0].Name != "first" || migrations[0].Up != "up 1" || migrations[0].Down != "down 1" {
+			t.Errorf("the first migration is %v", migrations[0])
+		}
+		if migrations[9].Name != "tenth" {
+			t.Errorf("the last migration is %v", migrations[9])
+		}
+	})
+
+	broken := map[string]fstest.MapFS{
+		"missing down": {
+			"0001_first.up.sql": file("up"),
+		},
+		"missing version": {
+			"0001_first.up.sql":   file("up"),
+			"0001_first.down.sql": file("down"),
+			"0003_third.up.sql":   file("up"),
+			"0003_third.down.sql": file("down"),
+		},
+		"badly named": {
+			"first.up.sql": file("up"),
+		},
+		"differently named": {
+			"0001_first.up.sql":   file("up"),
+			"0001_forst.down.sql": file("down"),
+		},
+	}
+
+	for name, dir := range broken {
+		t.Run(name, func(t *testing.T) {
+			if _, err := parseMigrations(dir); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestMigrateDownAndUp(t *testing.T) {
+	db := testDB(t)
+
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CheckSchema(db.DB); err != nil {
+		t.Fatalf("a freshly migrated database should be up to date: %v", err)
+	}
+
+	if err := MigrateDown(db.DB, len(migrations)); err != nil {
+		t.Fatal(err)
+	}
+	if version, err := SchemaVersion(db.DB); err != nil || version != 0 {
+		t.Fatalf("got version %v (%v) after undoing everything, wanted 0", version, err)
+	}
+	if err := CheckSchema(db.DB); err == nil {
+		t.Error("an empty database should not pass the schema check")
+	}
+	if err := MigrateDown(db.DB, 1); err == nil {
+		t.Error("expected an error undoing a migration on an empty database")
+	}
+
+	if err := MigrateUp(db.DB, 1); err != nil {
+		t.Fatal(err)
+	}
+	if version, err := SchemaVersion(db.DB); err != nil || version != 1 {
+		t.Fatalf("got version %v (%v) after a single step, wanted 1", version, err)
+	}
+
+	if err := MigrateUp(db.DB, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckSchema(db.DB); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestForceVersion(t *testing.T) {
+	db := testDB(t)
+
+	if err := ForceVersion(db.DB, 0); err != nil {
+		t.Fatal(err)
+	}
+	if version, err := SchemaVersion(db.DB); err != nil || version != 0 {
+		t.Fatalf("got version %v (%v), wanted 0", version, err)
+	}
+
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ForceVersion(db.DB, len(migrations)); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckSchema(db.DB); err != nil {
+		t.Error(err)
+	}
+
+	if err := ForceVersion(db.DB, len(migrations)+1); err == nil {
+		t.Error("expected an error forcing a migration which doesn't exist")
+	}
+}
@@ -0,0 +1 @@
+DROP SCHEMA IF EXISTS Archive CASCADE;
@@ -1,4 +1,3 @@
-DROP SCHEMA IF EXISTS Archive CASCADE;
 CREATE SCHEMA Archive;
 
 CREATE TYPE Archive.external_type AS ENUM (
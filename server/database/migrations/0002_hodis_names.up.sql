@@ -0,0 +1,8 @@
+-- Names looked up from hodis, so that they survive restarts. A null
+-- display_name means that the lookup failed, which is remembered too so
+-- that hodis isn't asked over and over about someone it doesn't know.
+CREATE TABLE IF NOT EXISTS Archive.HodisName (
+    kth_id       VARCHAR(255) PRIMARY KEY,
+    display_name VARCHAR(255),
+    fetched_at   TIMESTAMPTZ NOT NULL
+);
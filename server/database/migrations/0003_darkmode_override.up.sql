@@ -0,0 +1,9 @@
+-- Lets redaqtionen decide on darkmode themselves instead of following the
+-- darkmode service. There is only ever a single row, and no row at all
+-- means following darkmode.
+CREATE TABLE IF NOT EXISTS Archive.DarkmodeOverride (
+    only_row   BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (only_row),
+    mode       VARCHAR(16) NOT NULL CHECK (mode IN ('follow', 'on', 'off')),
+    changed_by VARCHAR(255),
+    changed_at TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,4 @@
+ALTER TABLE Archive.Issue
+    DROP CONSTRAINT IF EXISTS scheduled_has_publish_at,
+    DROP COLUMN IF EXISTS publish_at,
+    DROP COLUMN IF EXISTS status;
@@ -0,0 +1,9 @@
+-- Issues can be prepared in advance. Drafts are only shown to redaqtionen,
+-- while scheduled issues come out by themselves once publish_at has
+-- passed. Everything already in the archive is published.
+ALTER TABLE Archive.Issue
+    ADD COLUMN IF NOT EXISTS status VARCHAR(16) NOT NULL DEFAULT 'published'
+        CHECK (status IN ('draft', 'scheduled', 'published')),
+    ADD COLUMN IF NOT EXISTS publish_at TIMESTAMPTZ,
+    ADD CONSTRAINT scheduled_has_publish_at
+        CHECK (status <> 'scheduled' OR publish_at IS NOT NULL);
@@ -0,0 +1,16 @@
+-- Every saved version of an article, so that nothing is lost when it's
+-- edited. edited_by is null for the version an article had before
+-- revisions were kept.
+CREATE TABLE IF NOT EXISTS Archive.ArticleRevision (
+    id        INT PRIMARY KEY,
+    article   INT NOT NULL
+        REFERENCES Archive.Article
+        ON UPDATE CASCADE
+        ON DELETE CASCADE,
+    title     VARCHAR(255) NOT NULL,
+    content   TEXT NOT NULL,
+    edited_by VARCHAR(255),
+    edited_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS article_revision_article ON Archive.ArticleRevision (article, edited_at);
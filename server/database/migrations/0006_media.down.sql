@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS Archive.ExternalSize;
+
+ALTER TABLE Archive.External
+    DROP COLUMN IF EXISTS uploaded_at,
+    DROP COLUMN IF EXISTS uploaded_by,
+    DROP COLUMN IF EXISTS filename,
+    DROP COLUMN IF EXISTS height,
+    DROP COLUMN IF EXISTS width;
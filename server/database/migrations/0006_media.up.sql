@@ -0,0 +1,22 @@
+-- Images uploaded through the media library know how large they are, who
+-- uploaded them and what the file was called. Everything from before the
+-- media library has these as null.
+ALTER TABLE Archive.External
+    ADD COLUMN IF NOT EXISTS width       INT,
+    ADD COLUMN IF NOT EXISTS height      INT,
+    ADD COLUMN IF NOT EXISTS filename    VARCHAR(255),
+    ADD COLUMN IF NOT EXISTS uploaded_by VARCHAR(255),
+    ADD COLUMN IF NOT EXISTS uploaded_at TIMESTAMPTZ;
+
+-- Smaller versions of an uploaded image, the smallest of which is its
+-- thumbnail, so that browsers can pick whichever fits the screen.
+CREATE TABLE IF NOT EXISTS Archive.ExternalSize (
+    external   INT NOT NULL
+        REFERENCES Archive.External
+        ON UPDATE CASCADE
+        ON DELETE CASCADE,
+    width      INT NOT NULL,
+    height     INT NOT NULL,
+    hosted_url TEXT NOT NULL,
+    PRIMARY KEY (external, width)
+);
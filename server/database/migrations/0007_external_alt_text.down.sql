@@ -0,0 +1,2 @@
+ALTER TABLE Archive.External
+    DROP COLUMN IF EXISTS alt_text;
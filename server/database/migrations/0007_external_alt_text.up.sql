@@ -0,0 +1,4 @@
+-- Describes an image for those who can't see it. Pages fall back to
+-- something generic, like the title of the issue, when it's null.
+ALTER TABLE Archive.External
+    ADD COLUMN IF NOT EXISTS alt_text TEXT;
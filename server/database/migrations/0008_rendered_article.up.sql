@@ -0,0 +1,12 @@
+-- The html the latest rendered revision of an article was rendered to,
+-- which the render cache keeps here if told to, so that articles don't
+-- have to be rendered again after a restart. content_hash tells which
+-- revision it is.
+CREATE TABLE IF NOT EXISTS Archive.RenderedArticle (
+    article      INT PRIMARY KEY
+        REFERENCES Archive.Article
+        ON UPDATE CASCADE
+        ON DELETE CASCADE,
+    content_hash BYTEA NOT NULL,
+    html         TEXT NOT NULL
+);
@@ -0,0 +1,4 @@
+ALTER TABLE Archive.Issue
+    DROP COLUMN IF EXISTS publication;
+
+DROP TYPE IF EXISTS Archive.publication;
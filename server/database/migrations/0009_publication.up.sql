@@ -0,0 +1,13 @@
+-- dbuggen is the main publication, dtugget its smaller and more irregular
+-- sibling. They share everything except where they are listed.
+DO $$ BEGIN
+    CREATE TYPE Archive.publication AS ENUM (
+        'dbuggen',
+        'dtugget'
+    );
+EXCEPTION
+    WHEN duplicate_object THEN NULL;
+END $$;
+
+ALTER TABLE Archive.Issue
+    ADD COLUMN IF NOT EXISTS publication Archive.PUBLICATION NOT NULL DEFAULT 'dbuggen';
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS Archive.article_search_index;
+
+DROP FUNCTION IF EXISTS Archive.article_search(VARCHAR, TEXT);
@@ -0,0 +1,10 @@
+-- What articles are searched by, with the title weighted above the content.
+-- It's a function so that the index and the search queries are guaranteed
+-- to use the exact same expression.
+CREATE OR REPLACE FUNCTION Archive.article_search(title VARCHAR, content TEXT) RETURNS TSVECTOR AS $$
+    SELECT setweight(to_tsvector('swedish', title), 'A') ||
+           setweight(to_tsvector('swedish', content), 'B')
+$$ LANGUAGE SQL IMMUTABLE;
+
+CREATE INDEX IF NOT EXISTS article_search_index ON Archive.Article
+    USING GIN (Archive.article_search(title, content));
@@ -0,0 +1,9 @@
+ALTER TABLE Archive.Issue ALTER COLUMN id DROP DEFAULT;
+ALTER TABLE Archive.Article ALTER COLUMN id DROP DEFAULT;
+ALTER TABLE Archive.ArticleRevision ALTER COLUMN id DROP DEFAULT;
+ALTER TABLE Archive.External ALTER COLUMN id DROP DEFAULT;
+
+DROP SEQUENCE IF EXISTS Archive.issue_id_seq;
+DROP SEQUENCE IF EXISTS Archive.article_id_seq;
+DROP SEQUENCE IF EXISTS Archive.article_revision_id_seq;
+DROP SEQUENCE IF EXISTS Archive.external_id_seq;
@@ -0,0 +1,18 @@
+-- New ids come from sequences, since picking one more than the largest id
+-- gives two saves at the same time the same one. They start at 0 like the
+-- ids already there, and go on from the largest of those.
+CREATE SEQUENCE IF NOT EXISTS Archive.issue_id_seq MINVALUE 0 START 0 OWNED BY Archive.Issue.id;
+ALTER TABLE Archive.Issue ALTER COLUMN id SET DEFAULT nextval('Archive.issue_id_seq');
+SELECT setval('Archive.issue_id_seq', COALESCE(MAX(id) + 1, 0), false) FROM Archive.Issue;
+
+CREATE SEQUENCE IF NOT EXISTS Archive.article_id_seq MINVALUE 0 START 0 OWNED BY Archive.Article.id;
+ALTER TABLE Archive.Article ALTER COLUMN id SET DEFAULT nextval('Archive.article_id_seq');
+SELECT setval('Archive.article_id_seq', COALESCE(MAX(id) + 1, 0), false) FROM Archive.Article;
+
+CREATE SEQUENCE IF NOT EXISTS Archive.article_revision_id_seq MINVALUE 0 START 0 OWNED BY Archive.ArticleRevision.id;
+ALTER TABLE Archive.ArticleRevision ALTER COLUMN id SET DEFAULT nextval('Archive.article_revision_id_seq');
+SELECT setval('Archive.article_revision_id_seq', COALESCE(MAX(id) + 1, 0), false) FROM Archive.ArticleRevision;
+
+CREATE SEQUENCE IF NOT EXISTS Archive.external_id_seq MINVALUE 0 START 0 OWNED BY Archive.External.id;
+ALTER TABLE Archive.External ALTER COLUMN id SET DEFAULT nextval('Archive.external_id_seq');
+SELECT setval('Archive.external_id_seq', COALESCE(MAX(id) + 1, 0), false) FROM Archive.External;
@@ -0,0 +1,76 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Store is everything dbuggen reads from and writes to its database. Postgres
+// is the real one, while Memory keeps everything in memory for tests.
+//
+// Anything asked for which doesn't exist, or is hidden by darkmode, gives
+// sql.ErrNoRows. During darkmode an issue is shown as long as one of its
+// articles is nØllesafe, or it has no articles to hide, and the others are
+// hidden one by one. GetIssue and GetArticle tell the two apart, giving
+// ErrHidden for what darkmode hides and ErrNotFound otherwise, which are
+// both sql.ErrNoRows as well.
+//
+// Issues which aren't published yet aren't found, unless drafts is set.
+// GetIssues and GetArticles are only used where that has already been
+// decided, so they always include everything.
+type Store interface {
+	GetIssues() ([]Issue, error)
+	GetIssue(issueID int, darkmode bool, drafts bool) (HomeIssue, error)
+	GetHomeIssues(darkmode bool, drafts bool) ([]HomeIssue, error)
+	GetPublicationIssues(publication Publication, darkmode bool, drafts bool) ([]HomeIssue, error)
+	GetArticles(issue int, darkmode bool) ([]Article, error)
+	GetArticle(issueID int, index int, darkmode bool, drafts bool) (Article, error)
+	GetArticleByID(articleID int) (Article, error)
+	GetAuthorsForIssue(issueID int) ([][]Author, error)
+	GetAuthorsForArticle(article int) ([]Author, error)
+	GetArticlesByAuthor(kthID string, darkmode bool, drafts bool) ([]AuthoredArticle, error)
+	SearchArticles(query string, darkmode bool, drafts bool, limit int, offset int) ([]SearchResult, int, error)
+
+	GetActiveMembers() ([]Member, error)
+	GetMembers() ([]Member, error)
+	GetMember(kthID string) (Member, error)
+	IsActiveMember(kthID string) (bool, error)
+
+	CreateIssue(title string, publishingDate time.Time, publication Publication) (int, error)
+	UpdateIssue(issueID int, title string, publishingDate time.Time, publication Publication) error
+	SetIssueStatus(issueID int, status IssueStatus, publishAt sql.NullTime) error
+	IncrementViews(views map[int]int) error
+
+	CreateArticle(issueID int, title string, authorText sql.NullString, content string, n0lleSafe bool) (Article, error)
+	UpdateArticle(article Article, editor string) error
+	DeleteArticle(articleID int) error
+	ReorderArticles(issueID int, articleIDs []int) error
+	GetRevisions(articleID int) ([]Revision, error)
+	GetRevision(revisionID int) (Revision, error)
+	AddAuthor(articleID int, kthID string) error
+	RemoveAuthor(articleID int, kthID string) error
+
+	CreateImage(image External, sizes []ExternalSize) (int, error)
+	GetImages() ([]Image, error)
+	GetImage(externalID int) (Image, error)
+	GetImagesByURL(urls []string) ([]Image, error)
+	SetImageAltText(externalID int, altText string) error
+	SetPicturesUsedInArticle(articleID int, pictureIDs []int) error
+
+	// Gives sql.ErrNoRows unless the article was rendered with the same
+	// content hash
+	GetRenderedArticle(articleID int, contentHash []byte) (RenderedArticle, error)
+	SaveRenderedArticle(rendered RenderedArticle) error
+	ClearRenderedArticles() error
+
+	GetHodisNames() ([]HodisName, error)
+	SaveHodisName(name HodisName) error
+
+	GetDarkmodeOverride() (DarkmodeOverride, error)
+	SetDarkmodeOverride(override DarkmodeOverride) error
+}
+
+var (
+	_ Store = (*Postgres)(nil)
+	_ Store = (*Memory)(nil)
+)
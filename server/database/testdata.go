@@ -0,0 +1,54 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Testdata returns a Memory filled with the same things as testdata.psql,
+// so that tests can use the same data regardless of store. Remember to
+// change both.
+func Testdata() *Memory {
+	date := func(s string) time.Time {
+		t, err := time.Parse(time.DateOnly, s)
+		if err != nil {
+			panic(err)
+		}
+		return t
+	}
+	null := sql.NullString{}
+	str := func(s string) sql.NullString { return sql.NullString{String: s, Valid: true} }
+	id := func(i int32) sql.NullInt32 { return sql.NullInt32{Int32: i, Valid: true} }
+
+	return &Memory{
+		Externals: []External{
+			{ID: 0, HostedURL: "https://dbuggen.s3.eu-west-1.amazonaws.com/dbuggen2/FredrikhotarFredrik.png", TypeOfExternal: "image"},
+			{ID: 1, HostedURL: "https://dbuggen.s3.eu-west-1.amazonaws.com/dbuggen2/marke.png", TypeOfExternal: "image"},
+			{ID: 2, HostedURL: "https://dbuggen.s3.eu-west-1.amazonaws.com/dbuggen2/dbuggen-var-2024.pdf", TypeOfExternal: "pdf"},
+		},
+		Members: []Member{
+			{"frblo", null, str("https://dbuggen.s3.eu-west-1.amazonaws.com/dbuggen2/FredrikhotarFredrik.png"), "chefred", true},
+			{"testsupp", str("BULL"), null, "slave", true},
+		},
+		Issues: []Issue{
+			{0, "Testdbuggen", date("2024-02-23"), id(2), sql.NullInt32{}, id(0), 0, Dbuggen, IssuePublished, sql.NullTime{}},
+			{1, "Skojdbuggen", date("2024-04-17"), sql.NullInt32{}, sql.NullInt32{}, id(1), 0, Dbuggen, IssuePublished, sql.NullTime{}},
+			{2, "Sommardtugget", date("2024-06-20"), sql.NullInt32{}, sql.NullInt32{}, sql.NullInt32{}, 0, Dtugget, IssuePublished, sql.NullTime{}},
+			{3, "Framtidsdbuggen", date("2100-01-01"), sql.NullInt32{}, sql.NullInt32{}, sql.NullInt32{}, 0, Dbuggen, IssueScheduled, sql.NullTime{Time: date("2100-01-01"), Valid: true}},
+		},
+		Articles: []Article{
+			{0, "ledare", 0, null, 0, `# Hur man är cool \n det här är **kul**.`, date("2024-02-23"), true},
+			{1, "bästa toan att ta koks i på KTH", 0, str("skriven av anonym redaqtör"), 1, "## Hur gör man? \nJo. Du bara kör **hårt** mannen.\n$$x + x = \\frac{x}{y}$$", date("2024-02-23"), true},
+			{2, "(ledare) lol", 1, null, 0, "Typ ta det jävligt lugnt", date("2024-04-17"), false},
+			{3, "dtugget är tillbaka", 2, null, 0, "Ingen vet när nästa kommer.", date("2024-06-20"), true},
+			{4, "hemlig ledare", 3, null, 0, "Den här är inte ute än.", date("2024-08-19"), true},
+		},
+		AuthoredBy: []AuthoredBy{
+			{0, "frblo"},
+			{0, "testsupp"},
+			{1, "frblo"},
+			{2, "testsupp"},
+			{4, "frblo"},
+		},
+	}
+}
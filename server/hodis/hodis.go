@@ -0,0 +1,231 @@
+// Package hodis looks up the names of people from their kth ids, using
+// hodis.datasektionen.se. Names are cached, since asking hodis for every
+// author on every page load gets slow fast.
+package hodis
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"dbuggen/server/database"
+	"dbuggen/server/upstream"
+)
+
+const DefaultURL = "https://hodis.datasektionen.se"
+
+const (
+	// How long a name is trusted before asking hodis again
+	DefaultTTL = 24 * time.Hour
+	// How long to wait before asking hodis again about someone it couldn't
+	// give a name for, or after it couldn't be asked at all
+	DefaultNegativeTTL = 10 * time.Minute
+	// How many lookups are made at the same time when resolving many names
+	batchSize = 8
+)
+
+// Store is where names are persisted, so that the cache survives restarts.
+type Store interface {
+	GetHodisNames() ([]database.HodisName, error)
+	SaveHodisName(name database.HodisName) error
+}
+
+// Resolver looks up names from hodis and caches them. The zero value isn't
+// usable, use New.
+type Resolver struct {
+	Hodis       *upstream.Client
+	TTL         time.Duration
+	NegativeTTL time.Duration
+	// Optional, names are only kept in memory if nil
+	Store Store
+
+	mutex    sync.Mutex
+	cache    map[string]entry
+	inflight map[string]*sync.WaitGroup
+	now      func() time.Time
+}
+
+type entry struct {
+	name      string
+	found     bool
+	fetchedAt time.Time
+	// when asking hodis last failed, so that it's not asked again on every
+	// page load while it's down
+	failedAt time.Time
+}
+
+// New creates a resolver asking hodis through the client. store may be
+// nil.
+func New(hodis *upstream.Client, store Store) *Resolver {
+	return &Resolver{
+		Hodis:       hodis,
+		TTL:         DefaultTTL,
+		NegativeTTL: DefaultNegativeTTL,
+		Store:       store,
+		cache:       make(map[string]entry),
+		inflight:    make(map[string]*sync.WaitGroup),
+		now:         time.Now,
+	}
+}
+
+// Load fills the cache with the names in the store
+func (r *Resolver) Load() error {
+	if r.Store == nil {
+		return nil
+	}
+
+	names, err := r.Store.GetHodisNames()
+	if err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, name := range names {
+		r.cache[name.KthID] = entry{name: name.DisplayName.String, found: name.DisplayName.Valid, fetchedAt: name.FetchedAt}
+	}
+	return nil
+}
+
+// Name returns the name of whoever has the kth id, or the kth id itself if
+// hodis doesn't know.
+func (r *Resolver) Name(ctx context.Context, kthID string) string {
+	for {
+		r.mutex.Lock()
+		if e, ok := r.cache[kthID]; ok && r.fresh(e) {
+			r.mutex.Unlock()
+			return e.display(kthID)
+		}
+
+		// someone else is already asking, so wait for them instead
+		if wg, ok := r.inflight[kthID]; ok {
+			r.mutex.Unlock()
+			wg.Wait()
+			continue
+		}
+
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+		r.inflight[kthID] = wg
+		r.mutex.Unlock()
+
+		e, err := r.fetch(ctx, kthID)
+
+		// giving up isn't the same as hodis not knowing, so that's not
+		// remembered
+		cancelled := ctx.Err() != nil
+
+		r.mutex.Lock()
+		if err != nil && !cancelled {
+			// hodis being down says nothing about the name, so whatever
+			// was known before is kept until it can be asked again
+			e = r.cache[kthID]
+			e.failedAt = r.now()
+			r.cache[kthID] = e
+		} else if !cancelled {
+			r.cache[kthID] = e
+		}
+		delete(r.inflight, kthID)
+		r.mutex.Unlock()
+		wg.Done()
+
+		if r.Store != nil && err == nil && !cancelled {
+			err := r.Store.SaveHodisName(database.HodisName{
+				KthID:       kthID,
+				DisplayName: sql.NullString{String: e.name, Valid: e.found},
+				FetchedAt:   e.fetchedAt,
+			})
+			if err != nil {
+				log.Println(err)
+			}
+		}
+
+		return e.display(kthID)
+	}
+}
+
+// Names looks up several names at once, asking hodis about the ones which
+// aren't cached at the same time. The result maps kth ids to names.
+func (r *Resolver) Names(ctx context.Context, kthIDs []string) map[string]string {
+	kthIDs = slices.Clone(kthIDs)
+	slices.Sort(kthIDs)
+	kthIDs = slices.Compact(kthIDs)
+
+	names := make(map[string]string, len(kthIDs))
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	limit := make(chan struct{}, batchSize)
+
+	for _, kthID := range kthIDs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			limit <- struct{}{}
+			defer func() { <-limit }()
+
+			name := r.Name(ctx, kthID)
+			mutex.Lock()
+			names[kthID] = name
+			mutex.Unlock()
+		}()
+	}
+
+	wg.Wait()
+	return names
+}
+
+func (r *Resolver) fresh(e entry) bool {
+	if r.now().Sub(e.failedAt) < r.NegativeTTL {
+		return true
+	}
+
+	ttl := r.TTL
+	if !e.found {
+		ttl = r.NegativeTTL
+	}
+	return r.now().Sub(e.fetchedAt) < ttl
+}
+
+func (e entry) display(kthID string) string {
+	if !e.found {
+		return kthID
+	}
+	return e.name
+}
+
+// Asks hodis for a name. Hodis not knowing the kth id gives an entry which
+// isn't found, while an error means hodis couldn't be asked.
+func (r *Resolver) fetch(ctx context.Context, kthID string) (entry, error) {
+	unknown := entry{fetchedAt: r.now()}
+
+	body, err := r.Hodis.Get(ctx, "uid/"+url.PathEscape(kthID))
+	var status upstream.StatusError
+	if errors.As(err, &status) && status.Code == http.StatusNotFound {
+		log.Printf("hodis doesn't know kthid %v", kthID)
+		return unknown, nil
+	} else if err != nil {
+		log.Println(err)
+		return entry{}, err
+	}
+
+	var user struct {
+		DisplayName string `json:"displayName"`
+	}
+	if err := json.Unmarshal(body, &user); err != nil {
+		log.Println(err)
+		return entry{}, err
+	}
+	if user.DisplayName == "" {
+		log.Printf("hodis has no display name for kthid %v", kthID)
+		return unknown, nil
+	}
+
+	return entry{name: user.DisplayName, found: true, fetchedAt: unknown.fetchedAt}, nil
+}
@@ -0,0 +1,244 @@
+package hodis
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"dbuggen/server/database"
+	"dbuggen/server/upstream"
+)
+
+// A hodis which knows a few people and counts how often it's asked about
+// each of them
+type fakeHodis struct {
+	known map[string]string
+	asked sync.Map
+	// closed while requests are let through, for holding them up
+	gate chan struct{}
+	// answering everything with 500 Internal Server Error
+	down atomic.Bool
+}
+
+func (f *fakeHodis) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if f.gate != nil {
+		<-f.gate
+	}
+
+	kthID := strings.TrimPrefix(r.URL.Path, "/uid/")
+	count, _ := f.asked.LoadOrStore(kthID, new(atomic.Int32))
+	count.(*atomic.Int32).Add(1)
+
+	if f.down.Load() {
+		http.Error(w, "hodis is down", http.StatusInternalServerError)
+		return
+	}
+
+	name, ok := f.known[kthID]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"displayName": name})
+}
+
+func (f *fakeHodis) timesAsked(kthID string) int {
+	count, ok := f.asked.Load(kthID)
+	if !ok {
+		return 0
+	}
+	return int(count.(*atomic.Int32).Load())
+}
+
+var ctx = context.Background()
+
+func newFake(t *testing.T, store Store) (*Resolver, *fakeHodis) {
+	t.Helper()
+	fake := &fakeHodis{known: map[string]string{
+		"frblo":    "Fredrik Blomqvist",
+		"testsupp": "test support",
+	}}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	client := upstream.New("hodis", server.URL+"/", time.Second)
+	client.HTTP = server.Client()
+	return New(client, store), fake
+}
+
+func TestName(t *testing.T) {
+	r, fake := newFake(t, nil)
+
+	if name := r.Name(ctx, "frblo"); name != "Fredrik Blomqvist" {
+		t.Errorf("got %v, wanted Fredrik Blomqvist", name)
+	}
+	if name := r.Name(ctx, "frblo"); name != "Fredrik Blomqvist" {
+		t.Errorf("got %v from the cache, wanted Fredrik Blomqvist", name)
+	}
+	if n := fake.timesAsked("frblo"); n != 1 {
+		t.Errorf("hodis was asked %v times, wanted once", n)
+	}
+}
+
+func TestNameExpires(t *testing.T) {
+	r, fake := newFake(t, nil)
+	now := time.Now()
+	r.now = func() time.Time { return now }
+
+	r.Name(ctx, "frblo")
+	now = now.Add(r.TTL - time.Second)
+	r.Name(ctx, "frblo")
+	if n := fake.timesAsked("frblo"); n != 1 {
+		t.Errorf("hodis was asked %v times before the name expired, wanted once", n)
+	}
+
+	now = now.Add(2 * time.Second)
+	r.Name(ctx, "frblo")
+	if n := fake.timesAsked("frblo"); n != 2 {
+		t.Errorf("hodis was asked %v times after the name expired, wanted twice", n)
+	}
+}
+
+func TestNameNegativeCache(t *testing.T) {
+	r, fake := newFake(t, nil)
+	now := time.Now()
+	r.now = func() time.Time { return now }
+
+	if name := r.Name(ctx, "nollan"); name != "nollan" {
+		t.Errorf("got %v for someone hodis doesn't know, wanted their kth id", name)
+	}
+	r.Name(ctx, "nollan")
+	if n := fake.timesAsked("nollan"); n != 1 {
+		t.Errorf("hodis was asked %v times, wanted the failure to be cached", n)
+	}
+
+	// failures are retried sooner than names expire
+	now = now.Add(r.NegativeTTL)
+	r.Name(ctx, "nollan")
+	if n := fake.timesAsked("nollan"); n != 2 {
+		t.Errorf("hodis was asked %v times, wanted the failure to have expired", n)
+	}
+}
+
+func TestNameUnreachable(t *testing.T) {
+	client := upstream.New("hodis", "http://127.0.0.1:0", time.Second)
+	client.Retries = 0
+	r := New(client, nil)
+	if name := r.Name(ctx, "frblo"); name != "frblo" {
+		t.Errorf("got %v with hodis down, wanted the kth id", name)
+	}
+}
+
+func TestNameWhileDown(t *testing.T) {
+	store := &database.Memory{}
+	r, fake := newFake(t, store)
+	r.Hodis.Retries = 0
+	now := time.Now()
+	r.now = func() time.Time { return now }
+
+	r.Name(ctx, "frblo")
+	fake.down.Store(true)
+	now = now.Add(r.TTL)
+
+	// the old name is better than nothing
+	if name := r.Name(ctx, "frblo"); name != "Fredrik Blomqvist" {
+		t.Errorf("got %v with hodis down, wanted the name from before", name)
+	}
+	if name := r.Name(ctx, "frblo"); name != "Fredrik Blomqvist" || fake.timesAsked("frblo") != 2 {
+		t.Errorf("got %v after asking hodis %v times, wanted it left alone for a while", name, fake.timesAsked("frblo"))
+	}
+	if saved, _ := store.GetHodisNames(); len(saved) != 1 || !saved[0].DisplayName.Valid {
+		t.Errorf("got %+v saved, wanted the name kept", saved)
+	}
+
+	// and it's asked again once it's had some time to recover
+	fake.down.Store(false)
+	now = now.Add(r.NegativeTTL)
+	r.Name(ctx, "frblo")
+	if n := fake.timesAsked("frblo"); n != 3 {
+		t.Errorf("hodis was asked %v times, wanted it asked again after backing off", n)
+	}
+}
+
+func TestNames(t *testing.T) {
+	r, fake := newFake(t, nil)
+	fake.gate = make(chan struct{})
+
+	done := make(chan map[string]string)
+	go func() { done <- r.Names(ctx, []string{"frblo", "testsupp", "frblo", "nollan"}) }()
+	go func() { done <- r.Names(ctx, []string{"frblo"}) }()
+
+	// let both batches get going before hodis answers
+	time.Sleep(50 * time.Millisecond)
+	close(fake.gate)
+
+	names := <-done
+	other := <-done
+	if len(names) < len(other) {
+		names = other
+	}
+
+	expected := map[string]string{"frblo": "Fredrik Blomqvist", "testsupp": "test support", "nollan": "nollan"}
+	for kthID, name := range expected {
+		if names[kthID] != name {
+			t.Errorf("got %v for %v, wanted %v", names[kthID], kthID, name)
+		}
+	}
+	if n := fake.timesAsked("frblo"); n != 1 {
+		t.Errorf("hodis was asked about frblo %v times, wanted once", n)
+	}
+}
+
+func TestPersisted(t *testing.T) {
+	store := &database.Memory{}
+	r, _ := newFake(t, store)
+	r.Name(ctx, "frblo")
+	r.Name(ctx, "nollan")
+
+	saved, err := store.GetHodisNames()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved) != 2 {
+		t.Fatalf("got %v saved names, wanted 2", len(saved))
+	}
+
+	// a restarted resolver shouldn't need to ask hodis again
+	restarted, fake := newFake(t, store)
+	if err := restarted.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if name := restarted.Name(ctx, "frblo"); name != "Fredrik Blomqvist" {
+		t.Errorf("got %v, wanted Fredrik Blomqvist", name)
+	}
+	if name := restarted.Name(ctx, "nollan"); name != "nollan" {
+		t.Errorf("got %v, wanted nollan", name)
+	}
+	if n := fake.timesAsked("frblo") + fake.timesAsked("nollan"); n != 0 {
+		t.Errorf("hodis was asked %v times after loading the saved names", n)
+	}
+}
+
+func TestNameCancelled(t *testing.T) {
+	r, fake := newFake(t, nil)
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if name := r.Name(cancelled, "frblo"); name != "frblo" {
+		t.Errorf("got %v, wanted the kth id when giving up", name)
+	}
+
+	// giving up shouldn't be remembered as hodis not knowing
+	if name := r.Name(ctx, "frblo"); name != "Fredrik Blomqvist" {
+		t.Errorf("got %v, wanted Fredrik Blomqvist", name)
+	}
+	if n := fake.timesAsked("frblo"); n != 1 {
+		t.Errorf("hodis was asked %v times, wanted once", n)
+	}
+}
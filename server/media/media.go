@@ -0,0 +1,114 @@
+// Package media is the media library, where redaqtionen uploads the images
+// used in articles. Every image is kept as it was uploaded along with
+// smaller versions of it, in a Storage, and is an External in the
+// database, with the smaller versions as its ExternalSizes.
+package media
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"dbuggen/server/database"
+)
+
+// Library uploads images to Storage and keeps track of them in DB.
+type Library struct {
+	Storage Storage
+	DB      database.Store
+}
+
+// Upload stores an image and its smaller versions, and saves it in the
+// database. Anything which isn't an image which can be used gives
+// ErrUnsupported.
+func (l *Library) Upload(ctx context.Context, filename string, data []byte, uploadedBy string) (database.Image, error) {
+	original, sizes, err := Process(data)
+	if err != nil {
+		return database.Image{}, err
+	}
+
+	// every upload gets a directory of its own, so that nothing is ever
+	// overwritten and the files can be cached forever
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		return database.Image{}, err
+	}
+	dir := "images/" + hex.EncodeToString(random)
+
+	url, err := l.Storage.Put(ctx, dir+"/original."+original.Extension, original.ContentType, original.Data)
+	if err != nil {
+		return database.Image{}, err
+	}
+
+	image := database.Image{External: database.External{
+		HostedURL:      url,
+		TypeOfExternal: "image",
+		Width:          sql.NullInt32{Int32: int32(original.Width), Valid: true},
+		Height:         sql.NullInt32{Int32: int32(original.Height), Valid: true},
+		Filename:       sql.NullString{String: cleanFilename(filename), Valid: true},
+		UploadedBy:     sql.NullString{String: uploadedBy, Valid: uploadedBy != ""},
+		UploadedAt:     sql.NullTime{Time: time.Now(), Valid: true},
+	}}
+
+	for _, size := range sizes {
+		url, err := l.Storage.Put(ctx, fmt.Sprintf("%v/%v.%v", dir, size.Width, size.Extension), size.ContentType, size.Data)
+		if err != nil {
+			return database.Image{}, err
+		}
+		image.Sizes = append(image.Sizes, database.ExternalSize{Width: size.Width, Height: size.Height, HostedURL: url})
+	}
+
+	image.ID, err = l.DB.CreateImage(image.External, image.Sizes)
+	if err != nil {
+		return database.Image{}, err
+	}
+	for i := range image.Sizes {
+		image.Sizes[i].External = image.ID
+	}
+
+	return image, nil
+}
+
+// Image references in markdown, like ![alt](external:12)
+var externalRef = regexp.MustCompile(`\(\s*external:(\d+)`)
+
+// Used gives the ids of the images which are used in content, either by
+// linking to them in whichever size or by referring to their id.
+func Used(content string, images []database.Image) []int {
+	referred := map[string]bool{}
+	for _, match := range externalRef.FindAllStringSubmatch(content, -1) {
+		referred[match[1]] = true
+	}
+
+	var used []int
+	for _, image := range images {
+		if referred[strconv.Itoa(image.ID)] || strings.Contains(content, image.HostedURL) {
+			used = append(used, image.ID)
+			continue
+		}
+		for _, size := range image.Sizes {
+			if strings.Contains(content, size.HostedURL) {
+				used = append(used, image.ID)
+				break
+			}
+		}
+	}
+	return used
+}
+
+// Only the name of the file is kept, not where it was on the uploader's
+// computer
+func cleanFilename(filename string) string {
+	filename = path.Base(strings.ReplaceAll(filename, `\`, "/"))
+	if len(filename) > 255 {
+		filename = strings.ToValidUTF8(filename[:255], "")
+	}
+	return filename
+}
@@ -0,0 +1,170 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"dbuggen/server/database"
+)
+
+func testImage(t *testing.T, width, height int, encode func(*bytes.Buffer, image.Image) error) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 128, 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodePNG(buf *bytes.Buffer, img image.Image) error  { return png.Encode(buf, img) }
+func encodeJPEG(buf *bytes.Buffer, img image.Image) error { return jpeg.Encode(buf, img, nil) }
+
+func TestProcess(t *testing.T) {
+	original, sizes, err := Process(testImage(t, 1000, 500, encodePNG))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if original.Width != 1000 || original.Height != 500 || original.ContentType != "image/png" {
+		t.Errorf("unexpected original %vx%v %v", original.Width, original.Height, original.ContentType)
+	}
+
+	var widths []int
+	for _, size := range sizes {
+		widths = append(widths, size.Width)
+
+		img, format, err := image.Decode(bytes.NewReader(size.Data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if format != "png" || img.Bounds().Dx() != size.Width || img.Bounds().Dy() != size.Width/2 {
+			t.Errorf("got a %v of %v, wanted a png of %vx%v", format, img.Bounds(), size.Width, size.Width/2)
+		}
+	}
+	if !slices.Equal(widths, []int{200, 480, 960}) {
+		t.Errorf("got widths %v, wanted every one smaller than the original", widths)
+	}
+}
+
+func TestProcessSmallJPEG(t *testing.T) {
+	original, sizes, err := Process(testImage(t, 150, 100, encodeJPEG))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if original.ContentType != "image/jpeg" || original.Extension != "jpg" || len(sizes) != 0 {
+		t.Errorf("got a %v with %v sizes, wanted a jpeg without any", original.ContentType, len(sizes))
+	}
+}
+
+func TestProcessOrientation(t *testing.T) {
+	// stored as 600x300 with the left half red and the right half blue, and
+	// an EXIF orientation of 6 to turn it a quarter clockwise when shown
+	data, err := os.ReadFile("testdata/orientation6.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	original, sizes, err := Process(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if original.Width != 300 || original.Height != 600 {
+		t.Errorf("got an original of %vx%v, wanted 300x600 as it's shown", original.Width, original.Height)
+	}
+	if len(sizes) != 1 || sizes[0].Width != 200 || sizes[0].Height != 400 {
+		t.Fatalf("got sizes %+v, wanted only 200x400", sizes)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(sizes[0].Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != 200 || img.Bounds().Dy() != 400 {
+		t.Fatalf("got %v, wanted 200x400", img.Bounds())
+	}
+	// red on top and blue at the bottom once turned
+	top, bottom := img.At(100, 50), img.At(100, 350)
+	if r, _, b, _ := top.RGBA(); r < 0xc000 || b > 0x4000 {
+		t.Errorf("got %v at the top, wanted red", top)
+	}
+	if r, _, b, _ := bottom.RGBA(); b < 0xc000 || r > 0x4000 {
+		t.Errorf("got %v at the bottom, wanted blue", bottom)
+	}
+}
+
+func TestProcessUnsupported(t *testing.T) {
+	if _, _, err := Process([]byte("<svg></svg>")); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("got %v, wanted ErrUnsupported", err)
+	}
+}
+
+func TestUpload(t *testing.T) {
+	dir := t.TempDir()
+	db := database.Testdata()
+	library := Library{Storage: Local{Dir: dir, BaseURL: "/media/"}, DB: db}
+
+	image, err := library.Upload(context.Background(), `C:\Users\frblo\bild.png`, testImage(t, 600, 300, encodePNG), "frblo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if image.Filename.String != "bild.png" || image.UploadedBy.String != "frblo" {
+		t.Errorf("unexpected image %+v", image.External)
+	}
+	if len(image.Sizes) != 2 || image.Sizes[0].External != image.ID {
+		t.Fatalf("got sizes %+v, wanted 200 and 480", image.Sizes)
+	}
+
+	for _, url := range []string{image.HostedURL, image.Thumbnail()} {
+		if !strings.HasPrefix(url, "/media/images/") {
+			t.Fatalf("got url %v, wanted it under /media/images/", url)
+		}
+		if _, err := os.Stat(filepath.Join(dir, strings.TrimPrefix(url, "/media/"))); err != nil {
+			t.Error(err)
+		}
+	}
+
+	saved, err := db.GetImage(image.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.HostedURL != image.HostedURL || len(saved.Sizes) != 2 {
+		t.Errorf("got %+v saved, wanted %+v", saved, image)
+	}
+}
+
+func TestUsed(t *testing.T) {
+	images := []database.Image{
+		{External: database.External{ID: 0, HostedURL: "/media/images/a/original.png"}},
+		{
+			External: database.External{ID: 1, HostedURL: "/media/images/b/original.jpg"},
+			Sizes:    []database.ExternalSize{{External: 1, Width: 200, HostedURL: "/media/images/b/200.jpg"}},
+		},
+		{External: database.External{ID: 2, HostedURL: "/media/images/c/original.jpg"}},
+	}
+
+	content := "![](/media/images/a/original.png)\n\n![liten](/media/images/b/200.jpg)"
+	if used := Used(content, images); !slices.Equal(used, []int{0, 1}) {
+		t.Errorf("got %v, wanted [0 1]", used)
+	}
+
+	content = "![](external:2) ![](external:12)"
+	if used := Used(content, images); !slices.Equal(used, []int{2}) {
+		t.Errorf("got %v, wanted [2]", used)
+	}
+}
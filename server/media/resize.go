@@ -0,0 +1,148 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"slices"
+)
+
+// Widths of the smaller versions made of every uploaded image, as long as
+// it's wider than that. The smallest is used as the thumbnail.
+var Widths = []int{200, 480, 960, 1600}
+
+// Images larger than this are refused rather than risking running out of
+// memory decoding them
+const maxPixels = 50_000_000
+
+// Returned for anything which isn't a jpeg, png or gif, or is too large
+var ErrUnsupported = errors.New("unsupported image")
+
+// A version of an image, encoded and ready to store
+type Version struct {
+	Width       int
+	Height      int
+	ContentType string
+	Extension   string
+	Data        []byte
+}
+
+// Process checks that data is an image which can be used, and makes the
+// smaller versions of it from the smallest up. The original is returned
+// as it was uploaded. Smaller versions of jpegs are jpegs, while pngs and
+// gifs become pngs to keep their transparency.
+//
+// Photos from phones are often stored sideways with an EXIF orientation
+// saying how to turn them. Browsers follow it when showing the original,
+// so the sizes given are those of the turned image, and the smaller
+// versions, which lose the EXIF data, are turned before being made.
+func Process(data []byte) (original Version, sizes []Version, err error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return original, nil, fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+	if config.Width*config.Height > maxPixels {
+		return original, nil, fmt.Errorf("%w: %vx%v is too large", ErrUnsupported, config.Width, config.Height)
+	}
+
+	orientation := 1
+	if format == "jpeg" {
+		orientation = jpegOrientation(data)
+	}
+	width, height := config.Width, config.Height
+	if swapsSides(orientation) {
+		width, height = height, width
+	}
+
+	original = Version{Width: width, Height: height, Data: data}
+	switch format {
+	case "jpeg":
+		original.ContentType, original.Extension = "image/jpeg", "jpg"
+	case "png":
+		original.ContentType, original.Extension = "image/png", "png"
+	case "gif":
+		original.ContentType, original.Extension = "image/gif", "gif"
+	default:
+		return original, nil, fmt.Errorf("%w: %v", ErrUnsupported, format)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return original, nil, fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+
+	// every size is made from the one above it, which is a lot faster than
+	// going from the original every time and looks just as good
+	current := orient(toRGBA(img), orientation)
+	for i := len(Widths) - 1; i >= 0; i-- {
+		sizeWidth := Widths[i]
+		if sizeWidth >= width {
+			continue
+		}
+
+		sizeHeight := max(1, height*sizeWidth/width)
+		current = downscale(current, sizeWidth, sizeHeight)
+
+		size := Version{Width: sizeWidth, Height: sizeHeight}
+		var buf bytes.Buffer
+		if format == "jpeg" {
+			size.ContentType, size.Extension = "image/jpeg", "jpg"
+			err = jpeg.Encode(&buf, current, &jpeg.Options{Quality: 85})
+		} else {
+			size.ContentType, size.Extension = "image/png", "png"
+			err = png.Encode(&buf, current)
+		}
+		if err != nil {
+			return original, nil, err
+		}
+		size.Data = buf.Bytes()
+		sizes = append(sizes, size)
+	}
+	slices.Reverse(sizes)
+
+	return original, sizes, nil
+}
+
+func toRGBA(img image.Image) *image.RGBA {
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Src)
+	return rgba
+}
+
+// Shrinks an image by averaging the pixels which end up in the same place.
+// Only meant for making images smaller.
+func downscale(src *image.RGBA, width, height int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+
+	for y := range height {
+		y0, y1 := y*sh/height, max((y+1)*sh/height, y*sh/height+1)
+		for x := range width {
+			x0, x1 := x*sw/width, max((x+1)*sw/width, x*sw/width+1)
+
+			var r, g, b, a, n int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r += int(p[0])
+					g += int(p[1])
+					b += int(p[2])
+					a += int(p[3])
+					n++
+				}
+			}
+
+			d := dst.Pix[y*dst.Stride+x*4:]
+			d[0], d[1], d[2], d[3] = uint8(r/n), uint8(g/n), uint8(b/n), uint8(a/n)
+		}
+	}
+
+	return dst
+}
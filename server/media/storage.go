@@ -0,0 +1,45 @@
+package media
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Storage is where uploaded files end up. Local is for running locally and
+// for tests, while S3 is used in production.
+type Storage interface {
+	// Put stores a file under key, replacing anything already there, and
+	// returns the URL it can be reached from.
+	Put(ctx context.Context, key string, contentType string, data []byte) (string, error)
+}
+
+var (
+	_ Storage = Local{}
+	_ Storage = (*S3)(nil)
+)
+
+// Local keeps the files in a directory, which has to be served at BaseURL
+// for the URLs to work.
+type Local struct {
+	Dir     string
+	BaseURL string
+}
+
+func (l Local) Put(ctx context.Context, key string, contentType string, data []byte) (string, error) {
+	if !filepath.IsLocal(key) {
+		return "", fmt.Errorf("invalid key %q", key)
+	}
+
+	path := filepath.Join(l.Dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(l.BaseURL, "/") + "/" + key, nil
+}
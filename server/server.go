@@ -1,17 +1,23 @@
 package server
 
 import (
+	"context"
+	"crypto/rand"
 	"html/template"
 	"io/fs"
+	"log"
 	"net/http"
-	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/jmoiron/sqlx"
 
 	"dbuggen/client"
 	"dbuggen/config"
+	"dbuggen/server/auth"
+	"dbuggen/server/database"
+	"dbuggen/server/hodis"
+	"dbuggen/server/media"
+	"dbuggen/server/upstream"
 )
 
 func must[T any](t T, err error) T {
@@ -22,34 +28,141 @@ func must[T any](t T, err error) T {
 }
 
 // Start starts the server and initializes the routes and templates.
-func Start(db *sqlx.DB, conf *config.Config) {
+func Start(db database.Store, conf *config.Config) {
 	r := gin.Default()
 	r.SetHTMLTemplate(template.Must(template.ParseFS(client.HTMLTemplates, "**/*.html")))
+	// before any routes, so that it also covers pages which don't exist
+	r.Use(client.ErrorPages())
 
 	r.StaticFS("public", http.FS(must(fs.Sub(client.PublicFiles, "public"))))
 
-	var ds client.DarkmodeStatus
-	initDarkmode(&ds, conf.DARKMODE_URL)
+	dfunkt := upstream.New("dfunkt", conf.DFUNKT_URL, 3*time.Second)
+	darkmode := upstream.New("darkmode", conf.DARKMODE_URL, 2*time.Second)
+	hodisURL := conf.HODIS_URL
+	if hodisURL == "" {
+		hodisURL = hodis.DefaultURL
+	}
 
-	r.GET("/", client.Home(db, &ds))
-	r.GET("issue/:issue", client.Issue(db, &ds))
-	r.GET("issue/:issue/:article", client.Article(db, &ds))
-	r.GET("redaqtionen", client.Redaqtionen(db, conf.DFUNKT_URL))
+	// everything is hidden until darkmode has said otherwise
+	ds := client.DarkmodeStatus{Darkmode: true, Upstream: darkmode}
+	if override, err := db.GetDarkmodeOverride(); err != nil {
+		log.Printf("could not get the darkmode override, following darkmode: %v", err)
+	} else {
+		ds.Override = override.Mode
+	}
+	go ds.Run(context.Background(), 5*time.Minute)
+	r.POST("webhook/darkmode", client.DarkmodeWebhook(&ds, conf.DARKMODE_WEBHOOK_SECRET))
+
+	names := hodis.New(upstream.New("hodis", hodisURL, 2*time.Second), db)
+	if err := names.Load(); err != nil {
+		log.Printf("starting without any cached names: %v", err)
+	}
 
-	r.NoRoute(func(c *gin.Context) {
-		c.JSON(http.StatusNotFound, gin.H{"code": "PAGE_NOT_FOUND", "message": "Page not found"})
+	a := initAuth(db, conf)
+	r.Use(client.Editors(a.Allowed))
+	r.GET("login", a.Login())
+	r.GET("login/callback", a.Callback())
+	r.GET("logout", a.Logout())
+
+	r.GET("/", client.Home(db, &ds))
+	r.GET("dtugget", client.Dtugget(db, &ds))
+	views := client.NewViewCounter(6*time.Hour, func(v map[int]int) error {
+		return db.IncrementViews(v)
 	})
+	go views.Run(context.Background(), time.Minute)
+
+	rendered := client.NewRenderCache(db, 500, conf.RENDER_CACHE_PERSIST == "true")
+
+	r.GET("issue/:issue", client.Issue(db, &ds, names, views, rendered))
+	r.GET("issue/:issue/pdf", client.IssuePDF(db, &ds))
+	r.GET("issue/:issue/html", client.IssueHTML(db, &ds))
+	r.GET("issue/:issue/:article", client.Article(db, &ds, names, views, rendered))
+	r.GET("search", client.Search(db, &ds))
+	r.GET("feed.xml", client.RSS(db, &ds, names, rendered))
+	r.GET("atom.xml", client.Atom(db, &ds, names, rendered))
+	r.GET("redaqtionen", client.Redaqtionen(db, names, dfunkt))
+	r.GET("redaqtionen/:kthid", client.Member(db, &ds, names))
+
+	api := r.Group("api/v1")
+	api.GET("issues", client.APIIssues(db, &ds))
+	api.GET("issues/:issue", client.APIIssue(db, &ds, names))
+	api.GET("issues/:issue/articles/:article", client.APIArticle(db, &ds, names, rendered))
+	api.GET("members", client.APIMembers(db, names))
+
+	admin := r.Group("admin", a.Require())
+	admin.GET("", client.AdminHome(db, rendered))
+	admin.GET("add-dbuggen", client.AdminAddIssueForm())
+	admin.POST("add-dbuggen", client.AdminAddIssue(db))
+	admin.GET("issue/:issue", client.AdminIssue(db))
+	admin.POST("issue/:issue", client.AdminUpdateIssue(db))
+	admin.POST("issue/:issue/status", client.AdminSetIssueStatus(db))
+	admin.POST("issue/:issue/article", client.AdminAddArticle(db))
+	admin.POST("issue/:issue/move", client.AdminMoveArticle(db))
+	admin.GET("article/:article", client.AdminArticle(db, names))
+	admin.POST("article/:article", client.AdminUpdateArticle(db, rendered))
+	admin.POST("article/:article/delete", client.AdminDeleteArticle(db, rendered))
+	admin.GET("article/:article/revisions", client.AdminRevisions(db, names))
+	admin.GET("article/:article/diff", client.AdminDiff(db))
+	admin.POST("article/:article/revisions/:revision/restore", client.AdminRestoreRevision(db, rendered))
+	admin.POST("article/:article/author", client.AdminAddAuthor(db))
+	admin.POST("article/:article/author/remove", client.AdminRemoveAuthor(db))
+	library := &media.Library{Storage: initStorage(r, conf), DB: db}
+	admin.GET("media", client.AdminMedia(db, names))
+	admin.POST("media", client.AdminUploadMedia(library, rendered))
+	admin.POST("media/:image/alt", client.AdminSetImageAltText(db, rendered))
+	admin.GET("darkmode", client.AdminDarkmode(db, &ds))
+	admin.POST("darkmode", client.AdminSetDarkmode(db, &ds))
+	admin.POST("darkmode/preview", client.AdminPreviewDarkmode())
 
 	r.Run()
 }
 
-func initDarkmode(ds *client.DarkmodeStatus, url string) {
-	*ds = client.DarkmodeStatus{
-		Darkmode: true,
-		LastPoll: time.Date(1983, time.October, 7, 17, 0, 0, 0, time.Local),
-		Url:      url,
-		Mutex:    sync.RWMutex{},
+// Puts uploaded images in S3 if a bucket is configured, and otherwise in a
+// local directory served from /media.
+func initStorage(r *gin.Engine, conf *config.Config) media.Storage {
+	if conf.S3_BUCKET != "" {
+		return &media.S3{
+			Endpoint:        conf.S3_ENDPOINT,
+			Region:          conf.S3_REGION,
+			Bucket:          conf.S3_BUCKET,
+			AccessKeyID:     conf.S3_ACCESS_KEY_ID,
+			SecretAccessKey: conf.S3_SECRET_ACCESS_KEY,
+			PublicURL:       conf.S3_PUBLIC_URL,
+			HTTP:            &http.Client{Timeout: time.Minute},
+		}
 	}
 
-	client.Darkmode(ds)
+	dir := conf.MEDIA_DIR
+	if dir == "" {
+		dir = "media"
+	}
+	log.Printf("keeping uploaded images in %v", dir)
+	r.Static("media", dir)
+	return media.Local{Dir: dir, BaseURL: "/media"}
+}
+
+// Uses oidc for logging in, unless a development login is configured.
+func initAuth(db database.Store, conf *config.Config) *auth.Auth {
+	var provider auth.Provider
+	if conf.DEV_LOGIN_KTHID != "" {
+		log.Printf("logging in everyone as %v, this should never be used in production", conf.DEV_LOGIN_KTHID)
+		provider = auth.Fake{KthID: conf.DEV_LOGIN_KTHID}
+	} else {
+		provider = &auth.OIDC{
+			Issuer:       conf.OIDC_ISSUER,
+			ClientID:     conf.OIDC_CLIENT_ID,
+			ClientSecret: conf.OIDC_CLIENT_SECRET,
+		}
+	}
+
+	secret := []byte(conf.SESSION_SECRET)
+	if len(secret) == 0 {
+		log.Println("no SESSION_SECRET set, logins won't survive a restart")
+		secret = make([]byte, 32)
+		_ = must(rand.Read(secret))
+	}
+
+	return auth.New(provider, secret, func(kthID string) (bool, error) {
+		return db.IsActiveMember(kthID)
+	})
 }
@@ -0,0 +1,175 @@
+// Package upstream is how dbuggen talks to the other services it depends
+// on, like dfunkt, hodis and darkmode. None of them are important enough to
+// hang a page for, so every call has a timeout, is retried a couple of
+// times if it fails, and stops being made for a while if a service keeps
+// failing.
+package upstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Returned instead of calling a service which has failed too many times in
+// a row, until it has had some time to recover.
+var ErrCircuitOpen = errors.New("circuit open")
+
+// Returned when a service answers with anything but 200 OK.
+type StatusError struct {
+	Service string
+	Code    int
+}
+
+func (e StatusError) Error() string {
+	return fmt.Sprintf("unexpected http response from %v: %v", e.Service, e.Code)
+}
+
+// Client calls a single service. Create it with New and change the fields
+// before using it if the defaults don't fit.
+type Client struct {
+	// Used in logs and errors
+	Name    string
+	BaseURL string
+	// How long a single attempt may take
+	Timeout time.Duration
+	// How many times a failed call is retried
+	Retries int
+	// How long to wait before the first retry, doubling for every one after
+	Backoff time.Duration
+	// How many failed calls in a row it takes to stop calling the service,
+	// and for how long
+	FailureThreshold int
+	Cooldown         time.Duration
+	HTTP             *http.Client
+
+	mutex     sync.Mutex
+	failures  int
+	openUntil time.Time
+	now       func() time.Time
+}
+
+// New creates a client for the service at baseURL, which paths given to
+// Get are relative to.
+func New(name string, baseURL string, timeout time.Duration) *Client {
+	return &Client{
+		Name:             name,
+		BaseURL:          strings.TrimSuffix(baseURL, "/"),
+		Timeout:          timeout,
+		Retries:          2,
+		Backoff:          100 * time.Millisecond,
+		FailureThreshold: 5,
+		Cooldown:         30 * time.Second,
+		HTTP:             &http.Client{},
+		now:              time.Now,
+	}
+}
+
+// Get fetches the path from the service and returns the body, as long as
+// the service answers with 200 OK. Server errors and network errors are
+// retried, while other statuses are returned as a StatusError right away.
+func (c *Client) Get(ctx context.Context, path string) ([]byte, error) {
+	if err := c.allow(); err != nil {
+		return nil, err
+	}
+
+	url := c.BaseURL + "/" + strings.TrimPrefix(path, "/")
+	backoff := c.Backoff
+
+	var err error
+	for attempt := 0; attempt <= c.Retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+
+		var body []byte
+		var retry bool
+		body, retry, err = c.attempt(ctx, url)
+		if err == nil {
+			c.record(true)
+			return body, nil
+		}
+		if !retry || ctx.Err() != nil || attempt == c.Retries {
+			break
+		}
+		log.Printf("%v: attempt %v failed, retrying: %v", c.Name, attempt+1, err)
+	}
+
+	// the service did answer, so it's not down
+	var status StatusError
+	if !errors.As(err, &status) || status.Code >= 500 {
+		// and neither is it when whoever asked gave up
+		if ctx.Err() == nil {
+			c.record(false)
+		}
+	}
+	return nil, err
+}
+
+// A single request, and whether it's worth retrying if it failed
+func (c *Client) attempt(ctx context.Context, url string) ([]byte, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, false, err
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return nil, retry, StatusError{c.Name, resp.StatusCode}
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, true, err
+	}
+	return body, false, nil
+}
+
+func (c *Client) allow() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.now().Before(c.openUntil) {
+		return fmt.Errorf("%v: %w", c.Name, ErrCircuitOpen)
+	}
+	return nil
+}
+
+// Keeps track of failures in a row. Once the cooldown is over the service
+// gets another chance, but a single failure is enough to stop calling it
+// again.
+func (c *Client) record(ok bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if ok {
+		c.failures = 0
+		return
+	}
+
+	c.failures++
+	if c.failures >= c.FailureThreshold {
+		log.Printf("%v has failed %v times in a row, not calling it for %v", c.Name, c.failures, c.Cooldown)
+		c.openUntil = c.now().Add(c.Cooldown)
+	}
+}
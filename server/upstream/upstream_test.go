@@ -0,0 +1,168 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// A service answering with the statuses in order, and 200 OK once they run
+// out
+func newService(t *testing.T, statuses ...int) (*Client, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(calls.Add(1))
+		if n <= len(statuses) {
+			w.WriteHeader(statuses[n-1])
+			return
+		}
+		w.Write([]byte("ok " + r.URL.Path))
+	}))
+	t.Cleanup(server.Close)
+
+	c := New("test", server.URL+"/", time.Second)
+	c.HTTP = server.Client()
+	c.Backoff = time.Millisecond
+	return c, &calls
+}
+
+func TestGet(t *testing.T) {
+	c, _ := newService(t)
+	body, err := c.Get(context.Background(), "/api/thing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "ok /api/thing" {
+		t.Errorf("got %q", body)
+	}
+}
+
+func TestGetRetries(t *testing.T) {
+	c, calls := newService(t, http.StatusBadGateway, http.StatusServiceUnavailable)
+	body, err := c.Get(context.Background(), "thing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "ok /thing" || calls.Load() != 3 {
+		t.Errorf("got %q after %v calls, wanted success on the third", body, calls.Load())
+	}
+}
+
+func TestGetGivesUp(t *testing.T) {
+	c, calls := newService(t, 500, 500, 500, 500)
+	_, err := c.Get(context.Background(), "thing")
+
+	var status StatusError
+	if !errors.As(err, &status) || status.Code != 500 {
+		t.Errorf("got %v, wanted a 500", err)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("got %v calls, wanted one and two retries", calls.Load())
+	}
+}
+
+func TestGetDoesNotRetryClientErrors(t *testing.T) {
+	c, calls := newService(t, http.StatusNotFound)
+	_, err := c.Get(context.Background(), "thing")
+
+	var status StatusError
+	if !errors.As(err, &status) || status.Code != http.StatusNotFound {
+		t.Errorf("got %v, wanted a 404", err)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("got %v calls, a 404 shouldn't be retried", calls.Load())
+	}
+}
+
+func TestGetTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	c := New("slow", server.URL, 10*time.Millisecond)
+	c.HTTP = server.Client()
+	c.Retries = 0
+
+	start := time.Now()
+	if _, err := c.Get(context.Background(), ""); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, wanted a timeout", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("the timeout wasn't respected")
+	}
+}
+
+func TestGetCancelled(t *testing.T) {
+	c, calls := newService(t, 500, 500, 500)
+	c.Backoff = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	if _, err := c.Get(ctx, ""); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, wanted the backoff to be cut short", err)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("got %v calls, wanted 1", calls.Load())
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	c, calls := newService(t, 500, 500, 500)
+	c.Retries = 0
+	c.FailureThreshold = 2
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	for range 2 {
+		if _, err := c.Get(context.Background(), ""); err == nil {
+			t.Fatal("expected the service to fail")
+		}
+	}
+
+	if _, err := c.Get(context.Background(), ""); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("got %v, wanted the circuit to be open", err)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("got %v calls, the service shouldn't be called while the circuit is open", calls.Load())
+	}
+
+	// after the cooldown it gets another chance, but one more failure
+	// opens the circuit again
+	now = now.Add(c.Cooldown)
+	if _, err := c.Get(context.Background(), ""); err == nil || errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("got %v, wanted the service to be called again", err)
+	}
+	if _, err := c.Get(context.Background(), ""); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("got %v, wanted the circuit to be open again", err)
+	}
+
+	now = now.Add(c.Cooldown)
+	if _, err := c.Get(context.Background(), ""); err != nil {
+		t.Errorf("got %v, wanted the service to have recovered", err)
+	}
+	if _, err := c.Get(context.Background(), ""); err != nil {
+		t.Errorf("got %v, wanted the circuit to be closed", err)
+	}
+}
+
+func TestCircuitIgnoresClientErrors(t *testing.T) {
+	c, _ := newService(t, 404, 404, 404)
+	c.FailureThreshold = 2
+
+	for range 3 {
+		c.Get(context.Background(), "")
+	}
+	if _, err := c.Get(context.Background(), ""); err != nil {
+		t.Errorf("got %v, 404s shouldn't open the circuit", err)
+	}
+}